@@ -1,11 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	commands "github.com/kekaadrenalin/dockhook/pkg/command"
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
 	argsType "github.com/kekaadrenalin/dockhook/pkg/types"
 	log "github.com/sirupsen/logrus"
 
@@ -19,7 +22,11 @@ func main() {
 	if subcommand != nil {
 		switch subcommand.(type) {
 		case *argsType.HealthcheckCmd:
-			if err := commands.Healthcheck(args.Addr, args.Base); err != nil {
+			if args.CommandCmd != nil {
+				log.Warn("The command subcommand is deprecated, use healthcheck instead")
+			}
+
+			if err := commands.Healthcheck(args.Addr, args.Base, args.TLSCert != ""); err != nil {
 				log.Fatal(err)
 			}
 
@@ -32,14 +39,116 @@ func main() {
 			log.Infof("User %s successfully saved", newUser.Username)
 			log.Infof("Password hash: %s", newUser.Password)
 
+		case *argsType.ListUsersCmd:
+			commands.PrintUsers(commands.ListUsers())
+
+		case *argsType.UpdateUserCmd:
+			updated, err := commands.UpdateUser(args)
+			if err != nil {
+				log.Fatalf("Could not update user: %s", err)
+			}
+
+			log.Infof("User %s successfully saved", updated.Username)
+
+		case *argsType.SetPasswordCmd:
+			if err := commands.SetPassword(args); err != nil {
+				log.Fatalf("Could not change password: %s", err)
+			}
+
+			log.Infof("Password of user %s successfully changed", args.SetPasswordCmd.Username)
+
+		case *argsType.DeleteUserCmd:
+			revoked, err := commands.DeleteUser(args)
+			if err != nil {
+				log.Fatalf("Could not delete user: %s", err)
+			}
+
+			log.Infof("User %s deleted, %d API tokens revoked", args.DeleteUserCmd.Username, revoked)
+
+		case *argsType.EnableTOTPCmd:
+			uri, codes, err := commands.EnableTOTP(args)
+			if err != nil {
+				log.Fatalf("Could not enable TOTP: %s", err)
+			}
+
+			log.Infof("TOTP enabled for user %s, add it to an authenticator app:", args.EnableTOTPCmd.Username)
+			fmt.Println(uri)
+			log.Info("Recovery codes, each can be used once instead of a code:")
+			fmt.Println(strings.Join(codes, "\n"))
+			log.Warn("Store the recovery codes now, they cannot be shown again")
+
+		case *argsType.DisableTOTPCmd:
+			if err := commands.DisableTOTP(args); err != nil {
+				log.Fatalf("Could not disable TOTP: %s", err)
+			}
+
+			log.Infof("TOTP disabled for user %s", args.DisableTOTPCmd.Username)
+
 		case *argsType.CreateWebhookCmd:
 			webhook, err := commands.CreateWebhook(args)
 			if err != nil {
 				log.Fatalf("Could not create new webhook: %s", err)
 			}
 
-			log.Infoln("Webhook successfully saved", webhook)
+			log.Infof("Webhook to %s container %s successfully saved", webhook.Action, webhook.ContainerName)
 			log.Infof("UUID: %s", webhook.UUID)
+
+		case *argsType.CreateTokenCmd:
+			token, secret, err := commands.CreateAPIToken(args)
+			if err != nil {
+				log.Fatalf("Could not create new token: %s", err)
+			}
+
+			log.Infof("Token %s successfully saved for user %s, expires %s", token.ID, token.Username, token.Expires.Format(time.RFC3339))
+			fmt.Println(secret)
+			log.Warn("Store the token now, it cannot be shown again")
+
+		case *argsType.ListTokensCmd:
+			commands.PrintAPITokens(commands.ListAPITokens(args))
+
+		case *argsType.RevokeTokenCmd:
+			if err := commands.RevokeAPIToken(args); err != nil {
+				log.Fatalf("Could not revoke token: %s", err)
+			}
+
+			log.Infof("Token %s successfully revoked", args.RevokeTokenCmd.ID)
+
+		case *argsType.RotateKeyCmd:
+			key, err := commands.RotateSessionKey(args)
+			if err != nil {
+				log.Fatalf("Could not rotate session key: %s", err)
+			}
+
+			log.Infof("Session key %s successfully saved", key.ID)
+
+		case *argsType.ListLockoutsCmd:
+			commands.PrintLockouts(commands.ListLockouts(args))
+
+		case *argsType.UnblockCmd:
+			removed, err := commands.Unblock(args)
+			if err != nil {
+				log.Fatalf("Could not unblock user: %s", err)
+			}
+
+			log.Infof("Removed %d lockouts of user %s", removed, args.UnblockCmd.Username)
+
+		case *argsType.AuditCmd:
+			if args.AuditCmd.Verify {
+				count, last, err := commands.VerifyAudit()
+				if err != nil {
+					log.Fatalf("Audit log verification failed after %d entries: %s", count, err)
+				}
+
+				log.Infof("Audit log is intact, %d entries verified, last hash %s", count, last)
+				break
+			}
+
+			entries, err := commands.QueryAudit(args)
+			if err != nil {
+				log.Fatalf("Could not read audit log: %s", err)
+			}
+
+			commands.PrintAudit(entries, args.AuditCmd.JSON)
 		}
 
 		os.Exit(0)
@@ -52,7 +161,7 @@ func parseArgs() (argsType.Args, interface{}) {
 	var args argsType.Args
 	parser := arg.MustParse(&args)
 
-	configureLogger(args.Level)
+	configureLogger(args.Level, args.LogFormat)
 
 	args.Filter = make(map[string][]string)
 
@@ -70,17 +179,26 @@ func parseArgs() (argsType.Args, interface{}) {
 	return args, parser.Subcommand()
 }
 
-func configureLogger(level string) {
+func configureLogger(level string, format string) {
 	if l, err := log.ParseLevel(level); err == nil {
 		log.SetLevel(l)
 	} else {
 		panic(any(err))
 	}
 
-	log.SetFormatter(&log.TextFormatter{
-		DisableLevelTruncation: true,
-	})
+	var formatter log.Formatter
+	switch format {
+	case "json":
+		formatter = &log.JSONFormatter{}
+	case "text":
+		formatter = &log.TextFormatter{
+			DisableLevelTruncation: true,
+		}
+	default:
+		panic(any(fmt.Errorf("invalid log format %s", format)))
+	}
 
+	log.SetFormatter(&helper.RedactingFormatter{Formatter: formatter})
 }
 
 func validateEnvVars() {
@@ -0,0 +1,347 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	EventWebhook      = "webhook"
+	EventUserCreate   = "user.create"
+	EventUserUpdate   = "user.update"
+	EventUserPassword = "user.password"
+	EventUserDelete   = "user.delete"
+	EventTOTPEnable   = "user.totp.enable"
+	EventTOTPDisable  = "user.totp.disable"
+	EventTokenCreate  = "token.create"
+	EventTokenRevoke  = "token.revoke"
+	EventUnblock      = "lockout.unblock"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// maxLineSize bounds a single entry, entries are far smaller
+const maxLineSize = 1024 * 1024
+
+var ErrTampered = errors.New("audit log was modified")
+
+// Entry is one line of the audit log. Hash covers the entry including the hash of the previous
+// entry, so that changing, removing or reordering lines breaks the chain. NewContainerID and NewImageID
+// are set when a pull recreated the container.
+type Entry struct {
+	Time           time.Time `json:"time"`
+	Event          string    `json:"event"`
+	User           string    `json:"user,omitempty"`
+	Token          string    `json:"token,omitempty"`
+	IP             string    `json:"ip,omitempty"`
+	RequestID      string    `json:"requestId,omitempty"`
+	Webhook        string    `json:"webhook,omitempty"`
+	Action         string    `json:"action,omitempty"`
+	Host           string    `json:"host,omitempty"`
+	Container      string    `json:"container,omitempty"`
+	ContainerID    string    `json:"containerId,omitempty"`
+	Image          string    `json:"image,omitempty"`
+	ImageID        string    `json:"imageId,omitempty"`
+	NewContainerID string    `json:"newContainerId,omitempty"`
+	NewImageID     string    `json:"newImageId,omitempty"`
+	Target         string    `json:"target,omitempty"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+	DurationMs     int64     `json:"durationMs"`
+	Previous       string    `json:"previous"`
+	Hash           string    `json:"hash"`
+}
+
+// Filter selects entries; empty fields match everything
+type Filter struct {
+	Event   string
+	Webhook string
+	User    string
+	Host    string
+	Since   time.Time
+	Until   time.Time
+	// Limit keeps only the newest entries
+	Limit int
+}
+
+// Log appends entries to a JSONL file. Entries appended by another process, e.g. a command run
+// next to the server, are chained to before the next entry is written.
+type Log struct {
+	Path string
+
+	mu   sync.Mutex
+	file *os.File
+	last string
+	size int64
+}
+
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (f Filter) Matches(e Entry) bool {
+	if f.Event != "" && e.Event != f.Event {
+		return false
+	}
+
+	if f.Webhook != "" && e.Webhook != f.Webhook {
+		return false
+	}
+
+	if f.User != "" && e.User != f.User && e.Target != f.User {
+		return false
+	}
+
+	if f.Host != "" && e.Host != f.Host {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// Open continues the chain of an existing log or starts a new one
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	l := &Log{Path: path}
+
+	var err error
+	l.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.readLast(); err != nil {
+		_ = l.file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// readLast picks up the hash of the last entry in the file; callers must hold l.mu unless l is not shared yet
+func (l *Log) readLast() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	last := ""
+	err = scan(l.Path, func(_ int, entry Entry, err error) error {
+		if err != nil {
+			// A crash can leave a partial line, Verify reports it
+			log.Warnf("Skipping unreadable audit log entry: %v", err)
+			return nil
+		}
+
+		last = entry.Hash
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.last = last
+	l.size = info.Size()
+
+	return nil
+}
+
+// Record chains the entry to the previous one and appends it
+func (l *Log) Record(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != l.size {
+		if err := l.readLast(); err != nil {
+			return err
+		}
+	}
+
+	entry.Time = entry.Time.UTC()
+	entry.Previous = l.last
+
+	hash, err := entry.computeHash()
+	if err != nil {
+		return err
+	}
+
+	entry.Hash = hash
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.last = hash
+	l.size = info.Size() + int64(len(data)) + 1
+
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Query returns the matching entries, oldest first
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	return Query(l.Path, filter)
+}
+
+// Query reads the matching entries of the log at path, oldest first
+func Query(path string, filter Filter) ([]Entry, error) {
+	entries := make([]Entry, 0)
+
+	err := scan(path, func(_ int, entry Entry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+
+		if filter.Limit > 0 && len(entries) > filter.Limit {
+			entries = entries[1:]
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// Verify checks the hash chain of the log at path and returns the number of entries and the last hash.
+// Removing entries from the end cannot be detected from the file alone, compare the last hash with a copy.
+func Verify(path string) (int, string, error) {
+	count := 0
+	previous := ""
+
+	err := scan(path, func(line int, entry Entry, err error) error {
+		if err != nil {
+			return fmt.Errorf("%w: line %d cannot be read: %v", ErrTampered, line, err)
+		}
+
+		if entry.Previous != previous {
+			return fmt.Errorf("%w: line %d does not follow the previous entry", ErrTampered, line)
+		}
+
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+
+		if hash != entry.Hash {
+			return fmt.Errorf("%w: line %d was changed", ErrTampered, line)
+		}
+
+		previous = entry.Hash
+		count++
+
+		return nil
+	})
+
+	return count, previous, err
+}
+
+// scan calls fn for every line of the file; a missing file has no lines
+func scan(path string, fn func(line int, entry Entry, err error) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for line := 1; ; line++ {
+		data, err := readLine(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry Entry
+		parseErr := json.Unmarshal(data, &entry)
+
+		if err := fn(line, entry, parseErr); err != nil {
+			return err
+		}
+	}
+}
+
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, chunk...)
+		if len(data) > maxLineSize {
+			return nil, errors.New("audit log entry is too long")
+		}
+
+		if !isPrefix {
+			return data, nil
+		}
+	}
+}
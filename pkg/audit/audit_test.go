@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLog(t *testing.T) *Log {
+	auditLog, err := Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = auditLog.Close() })
+
+	return auditLog
+}
+
+func Test_Log_Record_and_Verify(t *testing.T) {
+	auditLog := newTestLog(t)
+
+	require.NoError(t, auditLog.Record(Entry{Event: EventWebhook, Webhook: "a", Host: "localhost", Result: ResultSuccess}))
+	require.NoError(t, auditLog.Record(Entry{Event: EventUserCreate, User: "admin", Target: "bob", Result: ResultSuccess}))
+
+	count, last, err := Verify(auditLog.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	entries, err := auditLog.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Empty(t, entries[0].Previous)
+	assert.Equal(t, entries[0].Hash, entries[1].Previous)
+	assert.Equal(t, entries[1].Hash, last)
+}
+
+func Test_Open_continues_chain(t *testing.T) {
+	auditLog := newTestLog(t)
+	require.NoError(t, auditLog.Record(Entry{Event: EventWebhook, Result: ResultSuccess}))
+	require.NoError(t, auditLog.Close())
+
+	reopened, err := Open(auditLog.Path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = reopened.Close() })
+	require.NoError(t, reopened.Record(Entry{Event: EventWebhook, Result: ResultFailure}))
+
+	count, _, err := Verify(auditLog.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func Test_Log_Record_other_process(t *testing.T) {
+	server := newTestLog(t)
+	require.NoError(t, server.Record(Entry{Event: EventWebhook, Result: ResultSuccess}))
+
+	// A command appends to the log while the server keeps it open
+	cli, err := Open(server.Path)
+	require.NoError(t, err)
+	require.NoError(t, cli.Record(Entry{Event: EventUserDelete, User: "cli", Target: "bob", Result: ResultSuccess}))
+	require.NoError(t, cli.Close())
+
+	require.NoError(t, server.Record(Entry{Event: EventWebhook, Result: ResultSuccess}))
+
+	count, _, err := Verify(server.Path)
+	assert.NoError(t, err, "expected entries of both processes to be chained")
+	assert.Equal(t, 3, count)
+}
+
+func Test_Verify_detects_changes(t *testing.T) {
+	auditLog := newTestLog(t)
+	for _, webhook := range []string{"a", "b", "c"} {
+		require.NoError(t, auditLog.Record(Entry{Event: EventWebhook, Webhook: webhook, Result: ResultSuccess}))
+	}
+
+	data, err := os.ReadFile(auditLog.Path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+
+	changed := strings.Replace(string(data), `"webhook":"b"`, `"webhook":"x"`, 1)
+	require.NoError(t, os.WriteFile(auditLog.Path, []byte(changed), 0600))
+
+	_, _, err = Verify(auditLog.Path)
+	assert.ErrorIs(t, err, ErrTampered)
+	assert.ErrorContains(t, err, "line 2")
+
+	removed := lines[0] + lines[2]
+	require.NoError(t, os.WriteFile(auditLog.Path, []byte(removed), 0600))
+
+	_, _, err = Verify(auditLog.Path)
+	assert.ErrorIs(t, err, ErrTampered, "expected a removed line to be detected")
+}
+
+func Test_Query_filter(t *testing.T) {
+	auditLog := newTestLog(t)
+	now := time.Now()
+
+	require.NoError(t, auditLog.Record(Entry{Time: now.Add(-2 * time.Hour), Event: EventWebhook, Webhook: "a", Host: "h1", User: "alice"}))
+	require.NoError(t, auditLog.Record(Entry{Time: now.Add(-time.Hour), Event: EventWebhook, Webhook: "b", Host: "h2", User: "bob"}))
+	require.NoError(t, auditLog.Record(Entry{Time: now, Event: EventUserDelete, User: "alice", Target: "bob"}))
+
+	entries, err := auditLog.Query(Filter{Webhook: "a"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = auditLog.Query(Filter{User: "bob"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "expected entries by and about the user")
+
+	entries, err = auditLog.Query(Filter{Host: "h2"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = auditLog.Query(Filter{Event: EventWebhook, User: "alice"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a", entries[0].Webhook)
+
+	entries, err = auditLog.Query(Filter{Since: now.Add(-90 * time.Minute), Until: now.Add(-30 * time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].Webhook)
+
+	entries, err = auditLog.Query(Filter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, EventUserDelete, entries[1].Event, "expected the newest entries")
+}
@@ -0,0 +1,133 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	osuser "os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/goccy/go-json"
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func QueryAudit(args types.Args) ([]audit.Entry, error) {
+	filter := audit.Filter{
+		Webhook: args.AuditCmd.Webhook,
+		User:    args.AuditCmd.User,
+		Host:    args.AuditCmd.Host,
+		Limit:   args.AuditCmd.Limit,
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(args.AuditCmd.Since); err != nil {
+		return nil, fmt.Errorf("invalid --since: %w", err)
+	}
+
+	if filter.Until, err = parseAuditTime(args.AuditCmd.Until); err != nil {
+		return nil, fmt.Errorf("invalid --until: %w", err)
+	}
+
+	return audit.Query(auditLogPath(), filter)
+}
+
+func VerifyAudit() (int, string, error) {
+	return audit.Verify(auditLogPath())
+}
+
+// recordAudit appends a change made from the command line to the audit log of the server
+func recordAudit(event string, target string, err error) {
+	auditLog, openErr := audit.Open(auditLogPath())
+	if openErr != nil {
+		log.Errorf("Could not open audit log: %s", openErr)
+		return
+	}
+	defer auditLog.Close()
+
+	entry := audit.Entry{Event: event, User: cliActor(), Target: target, Result: audit.ResultSuccess}
+	if err != nil {
+		entry.Result = audit.ResultFailure
+		entry.Error = err.Error()
+	}
+
+	if err := auditLog.Record(entry); err != nil {
+		log.Errorf("Could not write audit log: %s", err)
+	}
+}
+
+// cliActor names changes made from the command line after the user of the operating system
+func cliActor() string {
+	if current, err := osuser.Current(); err == nil && current.Username != "" {
+		return "cli:" + current.Username
+	}
+
+	return "cli"
+}
+
+func PrintAudit(entries []audit.Entry, asJSON bool) {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, entry := range entries {
+			_ = encoder.Encode(entry)
+		}
+
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tEVENT\tUSER\tIP\tWEBHOOK\tACTION\tHOST\tCONTAINER\tTARGET\tRESULT\tDURATION")
+
+	for _, entry := range entries {
+		result := entry.Result
+		if entry.Error != "" {
+			result += ": " + entry.Error
+		}
+
+		actor := entry.User
+		if entry.Token != "" {
+			actor = strings.TrimSpace(actor + " (token " + entry.Token + ")")
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Time.Local().Format(time.RFC3339), entry.Event, orDash(actor), orDash(entry.IP), orDash(entry.Webhook),
+			orDash(entry.Action), orDash(entry.Host), orDash(containerChange(entry)), orDash(entry.Target), result,
+			time.Duration(entry.DurationMs)*time.Millisecond)
+	}
+
+	_ = w.Flush()
+}
+
+// containerChange shows the container and, after a pull, the image it runs now
+func containerChange(entry audit.Entry) string {
+	if entry.NewImageID == "" || entry.NewImageID == entry.ImageID {
+		return entry.Container
+	}
+
+	return fmt.Sprintf("%s (%s -> %s)", entry.Container, shortID(entry.ImageID), shortID(entry.NewImageID))
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+// parseAuditTime accepts an RFC 3339 time or a duration before now
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
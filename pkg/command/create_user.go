@@ -6,12 +6,21 @@ import (
 	argsType "github.com/kekaadrenalin/dockhook/pkg/types"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
 	"github.com/kekaadrenalin/dockhook/pkg/user"
 )
 
 func CreateUser(args argsType.Args) (user.User, error) {
-	if args.CreateUserCmd.Username == "" || args.CreateUserCmd.Password == "" {
-		log.Fatal("Username and password are required")
+	if args.CreateUserCmd.Username == "" {
+		log.Fatal("Username is required")
+	}
+
+	password := args.CreateUserCmd.Password
+	if password == "" {
+		var err error
+		if password, err = readPassword(); err != nil {
+			log.Fatalf("Could not read password: %s", err)
+		}
 	}
 
 	path, err := filepath.Abs("./data/users.yml")
@@ -19,10 +28,26 @@ func CreateUser(args argsType.Args) (user.User, error) {
 		log.Fatalf("Could not find absolute path to users.yml file: %s", err)
 	}
 
-	return user.CreateUser(path, user.User{
+	roles, err := user.ParseRoles(args.CreateUserCmd.Roles)
+	if err != nil {
+		log.Fatalf("Could not create new user: %s", err)
+	}
+
+	if len(roles) == 0 && len(args.CreateUserCmd.Webhooks) == 0 && len(args.CreateUserCmd.Hosts) == 0 {
+		log.Infof("No roles given, granting %s", user.RoleAdmin)
+		roles = []user.Role{user.RoleAdmin}
+	}
+
+	created, err := user.CreateUser(path, user.User{
 		Username: args.CreateUserCmd.Username,
-		Password: args.CreateUserCmd.Password,
+		Password: password,
 		Name:     args.CreateUserCmd.Name,
 		Email:    args.CreateUserCmd.Email,
+		Roles:    roles,
+		Webhooks: args.CreateUserCmd.Webhooks,
+		Hosts:    args.CreateUserCmd.Hosts,
 	}, true)
+	recordAudit(audit.EventUserCreate, args.CreateUserCmd.Username, err)
+
+	return created, err
 }
@@ -26,7 +26,11 @@ func CreateWebhook(args types.Args) (types.Webhook, error) {
 		args.Filter["label"] = append(args.Filter["label"], "com.docker.compose.project")
 	}
 
-	clients := docker.CreateClients(args)
+	clients, _ := docker.CreateClients(args)
+	if len(clients) == 0 {
+		log.Fatal("None of the Docker hosts is reachable")
+	}
+
 	storeClients := populateChoicesWithClients(clients)
 	client := storeClients[selectChoice()]
 
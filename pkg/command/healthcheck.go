@@ -1,6 +1,7 @@
 package command
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"strings"
@@ -8,7 +9,8 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func Healthcheck(addr string, base string) error {
+// Healthcheck requests the readiness endpoint of the local server, over HTTPS when it serves TLS
+func Healthcheck(addr string, base string, useTLS bool) error {
 	if strings.HasPrefix(addr, ":") {
 		addr = "localhost" + addr
 	}
@@ -17,14 +19,21 @@ func Healthcheck(addr string, base string) error {
 		base = ""
 	}
 
-	url := fmt.Sprintf("%s%s/command", addr, base)
+	url := fmt.Sprintf("%s%s/readyz", addr, base)
 
+	client := http.DefaultClient
 	if !strings.HasPrefix(url, "http") {
-		url = "http://" + url
+		if useTLS {
+			url = "https://" + url
+			// The certificate is issued for the public name, not for localhost
+			client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}} //nolint:gosec
+		} else {
+			url = "http://" + url
+		}
 	}
 
 	log.Info("Checking health of " + url)
-	resp, err := http.Get(url) //nolint:gosec
+	resp, err := client.Get(url) //nolint:gosec
 
 	if err != nil {
 		return err
@@ -36,5 +45,5 @@ func Healthcheck(addr string, base string) error {
 		return nil
 	}
 
-	return fmt.Errorf("command failed with status code %d", resp.StatusCode)
+	return fmt.Errorf("healthcheck failed with status code %d", resp.StatusCode)
 }
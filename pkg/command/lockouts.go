@@ -0,0 +1,40 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func ListLockouts(args types.Args) []user.Lockout {
+	return readLockouts(args, nil).List()
+}
+
+func Unblock(args types.Args) (int, error) {
+	removed, err := readLockouts(args, nil).Unblock(args.UnblockCmd.Username, args.UnblockCmd.IP)
+	recordAudit(audit.EventUnblock, args.UnblockCmd.Username, err)
+
+	return removed, err
+}
+
+func PrintLockouts(lockouts []user.Lockout) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "USER\tIP\tFAILURES\tLOCKOUTS\tLAST FAILURE\tBLOCKED UNTIL")
+
+	for _, lockout := range lockouts {
+		blockedUntil := "-"
+		if lockout.IsBlocked() {
+			blockedUntil = lockout.BlockedUntil.Format(time.RFC3339)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n",
+			lockout.Username, lockout.IP, lockout.Failures, lockout.Lockouts, lockout.LastFailure.Format(time.RFC3339), blockedUntil)
+	}
+
+	_ = w.Flush()
+}
@@ -2,6 +2,8 @@ package command
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,7 +13,9 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
 	"github.com/kekaadrenalin/dockhook/pkg/docker"
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
 	"github.com/kekaadrenalin/dockhook/pkg/server"
 	"github.com/kekaadrenalin/dockhook/pkg/types"
 	"github.com/kekaadrenalin/dockhook/pkg/user"
@@ -22,17 +26,45 @@ func Default(args types.Args) {
 		log.Fatalf("Invalid auth provider %s", args.AuthProvider)
 	}
 
+	if !server.ValidReadiness[args.Readiness] {
+		log.Fatalf("Invalid readiness %s, use all or any", args.Readiness)
+	}
+
 	log.Infof("DockHook version %s", types.Version)
 
-	clients := docker.CreateClients(args)
+	clients, supervisor := docker.CreateClients(args)
 
-	srv := createServer(args, clients)
+	srv := createServer(args, clients, supervisor)
 	go func() {
 		log.Infof("Accepting connections on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			// The certificate comes from TLSConfig.GetCertificate so that renewals are picked up
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+
+		if err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
+
+	var redirectSrv *http.Server
+	if args.HTTPRedirectAddr != "" {
+		if srv.TLSConfig == nil {
+			log.Fatal("--http-redirect-addr requires --tls-cert and --tls-key")
+		}
+
+		redirectSrv = server.CreateRedirectServer(args.HTTPRedirectAddr, args.Addr)
+		go func() {
+			log.Infof("Redirecting HTTP connections on %s to HTTPS", redirectSrv.Addr)
+			if err := redirectSrv.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -41,6 +73,11 @@ func Default(args types.Args) {
 
 	log.Info("shutting down gracefully, press Ctrl+C again to force")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal(err)
 	}
@@ -49,43 +86,314 @@ func Default(args types.Args) {
 	log.Debug("shutdown complete")
 }
 
-func createServer(args types.Args, clients map[string]types.Client) *http.Server {
+func createServer(args types.Args, clients map[string]types.Client, supervisor *docker.Supervisor) *http.Server {
 	var provider = server.ProviderNone
 	var authorizer server.Authorizer
+	var usersDatabase *user.UsersDatabase
+	var tokensDatabase *user.TokensDatabase
+	var sessionManager *user.SessionManager
+	var lockoutsDatabase *user.LockoutsDatabase
+
+	trustedProxies, err := helper.ParseCIDRs(args.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxy: %s", err)
+	}
 
 	if args.AuthProvider != string(server.ProviderNone) {
 		path, err := filepath.Abs("./data/users.yml")
 		if err != nil {
 			log.Fatalf("Could not find absolute path to users.yml file: %s", err)
 		}
-		if _, err := os.Stat(path); os.IsNotExist(err) {
+
+		_, err = os.Stat(path)
+		usersFileMissing := os.IsNotExist(err)
+		if usersFileMissing && requiresUsersFile(args) {
 			log.Fatalf("Could not find users.yml file at %s", path)
 		}
 
-		users, err := user.ReadUsersFromFile(path)
+		usersDatabase, err = user.ReadUsersFromFile(path)
 		if err != nil {
 			log.Fatalf("Could not read users.yml file at %s: %s", path, err)
 		}
 
-		if args.AuthProvider == string(server.ProviderSimple) {
+		tokensDatabase = readTokens()
+		lockoutsDatabase = readLockouts(args, trustedProxies)
+
+		groupMapping, err := user.ParseGroupMapping(args.GroupRoles)
+		if err != nil {
+			log.Fatalf("Invalid group mapping: %s", err)
+		}
+
+		switch server.AuthProvider(args.AuthProvider) {
+		case server.ProviderSimple:
 			provider = server.ProviderSimple
-			authorizer = user.NewSimpleAuth(users)
-		} else if args.AuthProvider == string(server.ProviderBasic) {
+			sessionManager = readSessions(args)
+			authorizer = user.NewSimpleAuth(usersDatabase, sessionManager)
+
+		case server.ProviderBasic:
 			provider = server.ProviderBasic
-			authorizer = user.NewBasicAuth(users)
+			authorizer = user.NewBasicAuth(usersDatabase, lockoutsDatabase)
+
+		case server.ProviderOIDC:
+			provider = server.ProviderOIDC
+			sessionManager = readSessions(args)
+			authorizer, err = user.NewOIDCAuth(context.Background(), user.OIDCConfig{
+				Issuer:         args.OIDCIssuer,
+				ClientID:       args.OIDCClientID,
+				ClientSecret:   args.OIDCClientSecret,
+				RedirectURL:    args.OIDCRedirectURL,
+				Scopes:         args.OIDCScopes,
+				Audience:       args.OIDCAudience,
+				UsernameClaim:  args.OIDCUsernameClaim,
+				GroupsClaim:    args.OIDCGroupsClaim,
+				LocalUserClaim: args.OIDCLocalUserClaim,
+				GroupMapping:   groupMapping,
+				Base:           args.Base,
+				Sessions:       sessionManager,
+				Cookies:        createCookieConfig(args),
+			}, usersDatabase)
+			if err != nil {
+				log.Fatalf("Could not configure oidc auth provider: %s", err)
+			}
+
+		case server.ProviderProxy:
+			if len(trustedProxies) == 0 {
+				log.Fatal("The forward-proxy auth provider requires at least one --trusted-proxy")
+			}
+
+			provider = server.ProviderProxy
+			authorizer = user.NewForwardAuth(user.ForwardAuthConfig{
+				UserHeader:     args.ForwardUserHeader,
+				EmailHeader:    args.ForwardEmailHeader,
+				NameHeader:     args.ForwardNameHeader,
+				GroupsHeader:   args.ForwardGroupsHeader,
+				TrustedProxies: trustedProxies,
+				GroupMapping:   groupMapping,
+			}, usersDatabase)
+
+		case server.ProviderLDAP:
+			provider = server.ProviderLDAP
+			authorizer, err = user.NewLDAPAuth(user.LDAPConfig{
+				URL:                args.LDAPURL,
+				StartTLS:           args.LDAPStartTLS,
+				InsecureSkipVerify: args.LDAPSkipVerify,
+				BindDN:             args.LDAPBindDN,
+				BindPassword:       args.LDAPBindPassword,
+				BaseDN:             args.LDAPBaseDN,
+				UserFilter:         args.LDAPUserFilter,
+				UserDNTemplate:     args.LDAPUserDN,
+				EmailAttribute:     args.LDAPEmailAttribute,
+				NameAttribute:      args.LDAPNameAttribute,
+				GroupAttribute:     args.LDAPGroupAttribute,
+				GroupMapping:       groupMapping,
+				CacheTTL:           args.LDAPCacheTTL,
+				Lockouts:           lockoutsDatabase,
+			}, usersDatabase)
+			if err != nil {
+				log.Fatalf("Could not configure ldap auth provider: %s", err)
+			}
+
+		case server.ProviderMTLS:
+			if args.TLSClientCA == "" {
+				log.Fatal("The mtls auth provider requires --tls-cert, --tls-key and --tls-client-ca")
+			}
+
+			mtlsUsers, err := user.ParseMTLSUsers(args.MTLSUsers)
+			if err != nil {
+				log.Fatalf("Invalid certificate user: %s", err)
+			}
+
+			config := user.MTLSConfig{Users: mtlsUsers, GroupMapping: groupMapping}
+			if args.MTLSBasicFallback {
+				config.Fallback = user.NewBasicAuth(usersDatabase, lockoutsDatabase)
+			}
+
+			provider = server.ProviderMTLS
+			authorizer = user.NewMTLSAuth(config, usersDatabase)
 		}
 	}
 
 	config := server.Config{
-		Addr:     args.Addr,
-		Base:     args.Base,
-		Version:  types.Version,
-		Hostname: args.Hostname,
+		Addr:           args.Addr,
+		Base:           args.Base,
+		Version:        types.Version,
+		Hostname:       args.Hostname,
+		TLSConfig:      createTLSConfig(args),
+		Cookies:        createCookieConfig(args),
+		TrustedOrigins: args.TrustedOrigins,
+		TrustedProxies: trustedProxies,
+		Metrics:        createMetricsConfig(args, trustedProxies),
+		Readiness:      server.Readiness(args.Readiness),
+		Supervisor:     supervisor,
+		Audit:          openAuditLog(),
 		Authorization: server.Authorization{
 			Provider:   provider,
 			Authorizer: authorizer,
+			Users:      usersDatabase,
+			Tokens:     tokensDatabase,
+			Sessions:   sessionManager,
+			Lockouts:   lockoutsDatabase,
 		},
 	}
 
 	return server.CreateServer(clients, config)
 }
+
+func readSessions(args types.Args) *user.SessionManager {
+	keysPath, err := filepath.Abs("./data/session_keys.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to session_keys.yml file: %s", err)
+	}
+
+	revokedPath, err := filepath.Abs("./data/revoked_sessions.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to revoked_sessions.yml file: %s", err)
+	}
+
+	sessions, err := user.NewSessionManager(keysPath, revokedPath, args.SessionTTL, args.SessionMaxAge)
+	if err != nil {
+		log.Fatalf("Could not read session keys: %s", err)
+	}
+
+	return sessions
+}
+
+func readLockouts(args types.Args, trustedProxies []*net.IPNet) *user.LockoutsDatabase {
+	path, err := filepath.Abs("./data/lockouts.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to lockouts.yml file: %s", err)
+	}
+
+	lockouts, err := user.ReadLockoutsFromFile(path)
+	if err != nil {
+		log.Fatalf("Could not read lockouts.yml file at %s: %s", path, err)
+	}
+
+	lockouts.TrustedProxies = trustedProxies
+	lockouts.Policy = user.LockoutPolicy{
+		MaxFailures: args.LockoutMaxFailures,
+		BaseDelay:   args.LockoutBaseDelay,
+		MaxDelay:    args.LockoutMaxDelay,
+		Window:      args.LockoutWindow,
+	}
+
+	return lockouts
+}
+
+func openAuditLog() *audit.Log {
+	auditLog, err := audit.Open(auditLogPath())
+	if err != nil {
+		log.Fatalf("Could not open audit log: %s", err)
+	}
+
+	return auditLog
+}
+
+func auditLogPath() string {
+	path, err := filepath.Abs("./data/audit.jsonl")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to audit.jsonl file: %s", err)
+	}
+
+	return path
+}
+
+func readUsers() *user.UsersDatabase {
+	path, err := filepath.Abs("./data/users.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to users.yml file: %s", err)
+	}
+
+	users, err := user.ReadUsersFromFile(path)
+	if err != nil {
+		log.Fatalf("Could not read users.yml file at %s: %s", path, err)
+	}
+
+	return users
+}
+
+func readTokens() *user.TokensDatabase {
+	path, err := filepath.Abs("./data/tokens.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to tokens.yml file: %s", err)
+	}
+
+	tokens, err := user.ReadTokensFromFile(path)
+	if err != nil {
+		log.Fatalf("Could not read tokens.yml file at %s: %s", path, err)
+	}
+
+	return tokens
+}
+
+// requiresUsersFile reports whether the auth provider checks passwords against users.yml
+func requiresUsersFile(args types.Args) bool {
+	switch server.AuthProvider(args.AuthProvider) {
+	case server.ProviderSimple, server.ProviderBasic:
+		return true
+	case server.ProviderMTLS:
+		return args.MTLSBasicFallback
+	default:
+		return false
+	}
+}
+
+func createMetricsConfig(args types.Args, trustedProxies []*net.IPNet) server.MetricsConfig {
+	allowedNetworks, err := helper.ParseCIDRs(args.MetricsAllow)
+	if err != nil {
+		log.Fatalf("Invalid metrics allowlist: %s", err)
+	}
+
+	return server.MetricsConfig{
+		Token:           args.MetricsToken,
+		AllowedNetworks: allowedNetworks,
+		TrustedProxies:  trustedProxies,
+		StatsInterval:   args.MetricsStats,
+	}
+}
+
+func createCookieConfig(args types.Args) user.CookieConfig {
+	path := args.CookiePath
+	if path == "" {
+		path = args.Base
+	}
+
+	return user.CookieConfig{
+		Domain: args.CookieDomain,
+		Path:   path,
+		Secure: args.CookieSecure || args.TLSCert != "",
+	}
+}
+
+func createTLSConfig(args types.Args) *tls.Config {
+	if args.TLSCert == "" {
+		if args.TLSClientCA != "" {
+			log.Fatal("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+
+		return nil
+	}
+
+	if args.TLSKey == "" {
+		log.Fatal("--tls-cert requires --tls-key")
+	}
+
+	certificates, err := helper.NewCertificateReloader(args.TLSCert, args.TLSKey)
+	if err != nil {
+		log.Fatalf("Could not read TLS certificate: %s", err)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificates.GetCertificate}
+
+	if args.TLSClientCA != "" {
+		clientCAs, err := helper.LoadCertPool(args.TLSClientCA)
+		if err != nil {
+			log.Fatalf("Could not read client CA certificates: %s", err)
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig
+}
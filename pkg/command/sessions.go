@@ -0,0 +1,10 @@
+package command
+
+import (
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func RotateSessionKey(args types.Args) (user.SessionKey, error) {
+	return readSessions(args).Rotate(args.RotateKeyCmd.RevokePrevious)
+}
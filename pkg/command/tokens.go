@@ -0,0 +1,91 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func CreateAPIToken(args types.Args) (user.Token, string, error) {
+	cmd := args.CreateTokenCmd
+	if cmd.Username == "" {
+		log.Fatal("Username is required")
+	}
+
+	if cmd.ExpiresIn <= 0 {
+		log.Fatal("Token lifetime must be positive")
+	}
+
+	path, err := filepath.Abs("./data/users.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to users.yml file: %s", err)
+	}
+
+	users, err := user.ReadUsersFromFile(path)
+	if err != nil {
+		return user.Token{}, "", err
+	}
+
+	if users.Find(cmd.Username) == nil {
+		return user.Token{}, "", fmt.Errorf("user %s does not exist", cmd.Username)
+	}
+
+	actions := make([]types.ContainerAction, 0, len(cmd.Actions))
+	for _, action := range cmd.Actions {
+		actions = append(actions, types.ContainerAction(action))
+	}
+
+	token, secret, err := readTokens().Issue(user.Token{
+		Name:     cmd.Name,
+		Username: cmd.Username,
+		Scope: user.TokenScope{
+			Webhooks: cmd.Webhooks,
+			Hosts:    cmd.Hosts,
+			Actions:  actions,
+		},
+		Expires: time.Now().Add(cmd.ExpiresIn),
+	})
+	recordAudit(audit.EventTokenCreate, token.ID, err)
+
+	return token, secret, err
+}
+
+func ListAPITokens(args types.Args) []user.Token {
+	return readTokens().List(args.ListTokensCmd.Username)
+}
+
+func RevokeAPIToken(args types.Args) error {
+	err := readTokens().Revoke(args.RevokeTokenCmd.ID)
+	recordAudit(audit.EventTokenRevoke, args.RevokeTokenCmd.ID, err)
+
+	return err
+}
+
+func PrintAPITokens(tokens []user.Token) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tUSER\tNAME\tSCOPE\tEXPIRES\tLAST USED")
+
+	for _, token := range tokens {
+		lastUsed := "never"
+		if token.LastUsed != nil {
+			lastUsed = token.LastUsed.Format(time.RFC3339)
+		}
+
+		expires := token.Expires.Format(time.RFC3339)
+		if token.IsExpired() {
+			expires += " (expired)"
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Username, token.Name, token.Scope, expires, lastUsed)
+	}
+
+	_ = w.Flush()
+}
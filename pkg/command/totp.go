@@ -0,0 +1,38 @@
+package command
+
+import (
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+// EnableTOTP replaces the second factor of the user and returns the otpauth URI and the recovery codes
+func EnableTOTP(args types.Args) (string, []string, error) {
+	cmd := args.EnableTOTPCmd
+
+	totp, codes, err := user.GenerateTOTP()
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = readUsers().Update(cmd.Username, func(u *user.User) error {
+		u.TOTP = &totp
+		return nil
+	})
+	recordAudit(audit.EventTOTPEnable, cmd.Username, err)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return totp.URI(cmd.Issuer, cmd.Username), codes, nil
+}
+
+func DisableTOTP(args types.Args) error {
+	_, err := readUsers().Update(args.DisableTOTPCmd.Username, func(u *user.User) error {
+		u.TOTP = nil
+		return nil
+	})
+	recordAudit(audit.EventTOTPDisable, args.DisableTOTPCmd.Username, err)
+
+	return err
+}
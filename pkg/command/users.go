@@ -0,0 +1,190 @@
+package command
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func ListUsers() []user.User {
+	return readUsers().List()
+}
+
+func UpdateUser(args types.Args) (user.User, error) {
+	cmd := args.UpdateUserCmd
+
+	roles, err := user.ParseRoles(cmd.Roles)
+	if err != nil {
+		return user.User{}, err
+	}
+
+	var before user.User
+	updated, err := readUsers().Update(cmd.Username, func(u *user.User) error {
+		before = *u
+
+		if cmd.Name != nil {
+			u.Name = *cmd.Name
+		}
+		if cmd.Email != nil {
+			u.Email = *cmd.Email
+		}
+		if cmd.ClearRoles || len(roles) > 0 {
+			u.Roles = roles
+		}
+		if cmd.ClearWebhooks || len(cmd.Webhooks) > 0 {
+			u.Webhooks = cmd.Webhooks
+		}
+		if cmd.ClearHosts || len(cmd.Hosts) > 0 {
+			u.Hosts = cmd.Hosts
+		}
+
+		return nil
+	})
+	recordAudit(audit.EventUserUpdate, cmd.Username, err)
+	if err != nil || !user.Demoted(before, updated) {
+		return updated, err
+	}
+
+	return updated, revokeSessions(args, updated.Username)
+}
+
+func SetPassword(args types.Args) error {
+	users := readUsers()
+	if users.Find(args.SetPasswordCmd.Username) == nil {
+		return user.ErrUserNotFound
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	err = users.SetPassword(args.SetPasswordCmd.Username, password)
+	recordAudit(audit.EventUserPassword, args.SetPasswordCmd.Username, err)
+
+	return err
+}
+
+// DeleteUser deletes the user and revokes their API tokens, returning how many were revoked
+func DeleteUser(args types.Args) (int, error) {
+	username := args.DeleteUserCmd.Username
+
+	err := readUsers().Delete(username)
+	recordAudit(audit.EventUserDelete, username, err)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := revokeSessions(args, username); err != nil {
+		return 0, err
+	}
+
+	tokens := readTokens()
+	revoked := 0
+	for _, token := range tokens.List(username) {
+		if err := tokens.Revoke(token.ID); err != nil {
+			return revoked, err
+		}
+
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+// revokeSessions ends the sessions of the user, a running server reads the revocation list again
+func revokeSessions(args types.Args, username string) error {
+	path, err := filepath.Abs("./data/revoked_sessions.yml")
+	if err != nil {
+		return err
+	}
+
+	sessions := &user.SessionManager{RevokedPath: path, TTL: args.SessionTTL}
+
+	return sessions.RevokeUser(username)
+}
+
+func PrintUsers(users []user.User) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "USER\tNAME\tEMAIL\tROLES\tWEBHOOKS\tHOSTS\tTOTP")
+
+	for _, u := range users {
+		roles := make([]string, 0, len(u.Roles))
+		for _, role := range u.Roles {
+			roles = append(roles, string(role))
+		}
+
+		totp := "no"
+		if u.TOTP != nil {
+			totp = "yes"
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			u.Username, u.Name, orDash(u.Email), orDash(strings.Join(roles, ",")), orDash(strings.Join(u.Webhooks, ",")), orDash(strings.Join(u.Hosts, ",")), totp)
+	}
+
+	_ = w.Flush()
+}
+
+// readPassword prompts for a password twice on a terminal and reads the first line of stdin otherwise,
+// so that passwords stay out of the shell history
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", errors.New("no password given on stdin")
+		}
+
+		return password, nil
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "New password: ")
+	password, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "Repeat password: ")
+	confirmation, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if len(password) == 0 {
+		return "", errors.New("password is required")
+	}
+
+	if string(password) != string(confirmation) {
+		return "", errors.New("passwords do not match")
+	}
+
+	return string(password), nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
 	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
 	log "github.com/sirupsen/logrus"
 
@@ -37,7 +38,7 @@ type httpClient struct {
 
 func NewClient(cli myTypes.DockerCLI, filters filters.Args, host *myTypes.Host) myTypes.Client {
 	clientItem := &httpClient{
-		cli:     cli,
+		cli:     &instrumentedCLI{DockerCLI: cli, host: host.ID},
 		filters: filters,
 		host:    host,
 	}
@@ -85,19 +86,27 @@ func NewClientWithTLSAndFilter(f map[string][]string, host myTypes.Host) (myType
 
 	log.Debugf("filterArgs = %v", filterArgs)
 
-	if host.URL.Scheme != "tcp" {
-		log.Fatal("Only tcp scheme is supported")
-	}
+	var opts []client.Opt
+	switch host.URL.Scheme {
+	case "tcp":
+		opts = append(opts, client.WithHost(host.URL.String()))
 
-	opts := []client.Opt{
-		client.WithHost(host.URL.String()),
-	}
+		if host.ValidCerts {
+			log.Debugf("Using TLS client config with certs at: %s", filepath.Dir(host.CertPath))
+			opts = append(opts, client.WithTLSClientConfig(host.CACertPath, host.CertPath, host.KeyPath))
+		} else {
+			log.Debugf("No valid certs found, using plain TCP")
+		}
+	case "ssh":
+		dialer, err := newSSHDialer(host)
+		if err != nil {
+			return nil, err
+		}
 
-	if host.ValidCerts {
-		log.Debugf("Using TLS client config with certs at: %s", filepath.Dir(host.CertPath))
-		opts = append(opts, client.WithTLSClientConfig(host.CACertPath, host.CertPath, host.KeyPath))
-	} else {
-		log.Debugf("No valid certs found, using plain TCP")
+		// The host only names the API, every connection goes through the tunnel
+		opts = append(opts, client.WithHost("http://docker"), client.WithDialContext(dialer.DialContext))
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", host.URL.Scheme)
 	}
 
 	opts = append(opts, client.WithAPIVersionNegotiation())
@@ -190,6 +199,7 @@ func (d *httpClient) ContainerActions(webhook *myTypes.Webhook) (*myTypes.Contai
 		return nil, &myErrors.HTTPError{
 			Err:        err,
 			StatusCode: http.StatusNotFound,
+			Code:       myErrors.CodeContainerNotFound,
 			Message:    fmt.Sprintf("no container found %s", webhook.ContainerId),
 		}
 	}
@@ -216,6 +226,7 @@ func (d *httpClient) ContainerActions(webhook *myTypes.Webhook) (*myTypes.Contai
 		return nil, &myErrors.HTTPError{
 			Err:        err,
 			StatusCode: http.StatusInternalServerError,
+			Code:       myErrors.CodeActionFailed,
 		}
 	}
 
@@ -267,21 +278,37 @@ func (d *httpClient) ListContainers() ([]myTypes.Container, error) {
 func (d *httpClient) ContainerLogs(ctx context.Context, id string, since *time.Time, stdType myTypes.StdType) (io.ReadCloser, error) {
 	log.WithField("id", id).WithField("since", since).WithField("stdType", stdType).Debug("streaming logs for container")
 
-	sinceQuery := ""
+	options := myTypes.LogOptions{
+		Follow:  true,
+		Tail:    strconv.Itoa(100),
+		StdType: stdType,
+	}
 	if since != nil {
-		sinceQuery = since.Add(time.Millisecond).Format(time.RFC3339Nano)
+		options.Since = since.Add(time.Millisecond)
 	}
 
-	options := container.LogsOptions{
-		ShowStdout: stdType&myTypes.STDOUT != 0,
-		ShowStderr: stdType&myTypes.STDERR != 0,
-		Follow:     true,
-		Tail:       strconv.Itoa(100),
+	return d.ContainerLogsWithOptions(ctx, id, options)
+}
+
+// ContainerLogsWithOptions returns the raw log stream, which is multiplexed unless the container has a TTY
+func (d *httpClient) ContainerLogsWithOptions(ctx context.Context, id string, options myTypes.LogOptions) (io.ReadCloser, error) {
+	logsOptions := container.LogsOptions{
+		ShowStdout: options.StdType&myTypes.STDOUT != 0,
+		ShowStderr: options.StdType&myTypes.STDERR != 0,
+		Follow:     options.Follow,
+		Tail:       options.Tail,
 		Timestamps: true,
-		Since:      sinceQuery,
 	}
+	if !options.Since.IsZero() {
+		logsOptions.Since = options.Since.Format(time.RFC3339Nano)
+	}
+	if !options.Until.IsZero() {
+		logsOptions.Until = options.Until.Format(time.RFC3339Nano)
+	}
+
+	log.Debugf("fetching logs from Docker with option: %+v", logsOptions)
 
-	reader, err := d.cli.ContainerLogs(ctx, id, options)
+	reader, err := d.cli.ContainerLogs(ctx, id, logsOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -302,9 +329,11 @@ func (d *httpClient) Events(ctx context.Context, messages chan<- myTypes.Contain
 		case message := <-dockerMessages:
 			if message.Type == events.ContainerEventType && len(message.Actor.ID) > 0 {
 				messages <- myTypes.ContainerEvent{
-					ActorID: message.Actor.ID[:12],
-					Name:    string(message.Action),
-					Host:    d.host.ID,
+					ActorID:    message.Actor.ID[:12],
+					Name:       string(message.Action),
+					Host:       d.host.ID,
+					Time:       time.Unix(0, message.TimeNano),
+					Attributes: message.Actor.Attributes,
 				}
 			}
 		}
@@ -313,22 +342,7 @@ func (d *httpClient) Events(ctx context.Context, messages chan<- myTypes.Contain
 }
 
 func (d *httpClient) ContainerLogsBetweenDates(ctx context.Context, id string, from time.Time, to time.Time, stdType myTypes.StdType) (io.ReadCloser, error) {
-	options := container.LogsOptions{
-		ShowStdout: stdType&myTypes.STDOUT != 0,
-		ShowStderr: stdType&myTypes.STDERR != 0,
-		Timestamps: true,
-		Since:      from.Format(time.RFC3339Nano),
-		Until:      to.Format(time.RFC3339Nano),
-	}
-
-	log.Debugf("fetching logs from Docker with option: %+v", options)
-
-	reader, err := d.cli.ContainerLogs(ctx, id, options)
-	if err != nil {
-		return nil, err
-	}
-
-	return reader, nil
+	return d.ContainerLogsWithOptions(ctx, id, myTypes.LogOptions{Since: from, Until: to, StdType: stdType})
 }
 
 func (d *httpClient) Ping(ctx context.Context) (types.Ping, error) {
@@ -351,6 +365,14 @@ func (d *httpClient) SystemInfo() system.Info {
 func (d *httpClient) PullLatestImage(ctx context.Context, imageName string, registryAuth string) error {
 	log.Debugf("Pulling latest image for %s", imageName)
 
+	start := time.Now()
+	err := d.pullImage(ctx, imageName, registryAuth)
+	metrics.ImagePullDuration.WithLabelValues(d.host.ID, metrics.Result(err)).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (d *httpClient) pullImage(ctx context.Context, imageName string, registryAuth string) error {
 	out, err := d.cli.ImagePull(ctx, imageName, image.PullOptions{RegistryAuth: registryAuth})
 	if err != nil {
 		return err
@@ -55,8 +55,10 @@ func (m *mockedProxy) ContainerInspect(ctx context.Context, containerID string)
 	return args.Get(0).(types.ContainerJSON), args.Error(1)
 }
 
-func (m *mockedProxy) ContainerStats(_ context.Context, _ string, _ bool) (container.StatsResponseReader, error) {
-	return container.StatsResponseReader{}, nil
+func (m *mockedProxy) ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error) {
+	args := m.Called(ctx, containerID, stream)
+
+	return args.Get(0).(container.StatsResponseReader), args.Error(1)
 }
 
 func (m *mockedProxy) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
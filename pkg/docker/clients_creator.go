@@ -8,16 +8,20 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func CreateClients(args myTypes.Args) map[string]myTypes.Client {
-	clients := createClients(args, NewClientWithFilters, NewClientWithTLSAndFilter, args.Hostname)
+// CreateClients connects to the Docker hosts; remote hosts that are down are left to the supervisor
+func CreateClients(args myTypes.Args) (map[string]myTypes.Client, *Supervisor) {
+	clients, supervisor := createClients(args, NewClientWithFilters, NewClientWithTLSAndFilter, args.Hostname)
 
-	if len(clients) == 0 {
+	if len(clients) == 0 && len(supervisor.Pending()) == 0 {
 		log.Fatal("Could not connect to any Docker Engines")
 	}
 
 	log.Infof("Connected to %d Docker Engine(s)", len(clients))
+	if pending := len(supervisor.Pending()); pending > 0 {
+		log.Warnf("Retrying %d remote host(s) in the background", pending)
+	}
 
-	return clients
+	return clients, supervisor
 }
 
 func createClients(
@@ -25,8 +29,9 @@ func createClients(
 	localClientFactory func(map[string][]string) (myTypes.Client, error),
 	remoteClientFactory func(map[string][]string, myTypes.Host) (myTypes.Client, error),
 	hostname string,
-) map[string]myTypes.Client {
+) (map[string]myTypes.Client, *Supervisor) {
 	clients := make(map[string]myTypes.Client)
+	supervisor := newSupervisor(args.Filter, remoteClientFactory)
 
 	if localClient, err := createLocalClient(args, localClientFactory); err == nil {
 		if hostname != "" {
@@ -42,22 +47,27 @@ func createClients(
 			log.Fatalf("Could not parse remote host %s: %s", remoteHost, err)
 		}
 
+		host.SSHKey = args.SSHKey
+		host.KnownHosts = args.SSHKnownHosts
+
 		log.Debugf("Creating remote client for %s with %+v", host.Name, host)
 		log.Infof("Creating client for %s with %s", host.Name, host.URL.String())
 
 		if client, err := remoteClientFactory(args.Filter, host); err == nil {
 			if _, err := client.ListContainers(); err == nil {
-				log.Debugf("Connected to local Docker Engine")
+				log.Debugf("Connected to remote Docker Engine %s", host.ID)
 				clients[client.Host().ID] = client
 			} else {
 				log.Warningf("Could not connect to remote host %s: %s", host.ID, err)
+				supervisor.add(host, err)
 			}
 		} else {
 			log.Warningf("Could not create client for %s: %s", host.ID, err)
+			supervisor.add(host, err)
 		}
 	}
 
-	return clients
+	return clients, supervisor
 }
 
 func createLocalClient(
@@ -84,7 +84,7 @@ func Test_valid_remote(t *testing.T) {
 		RemoteHost: []string{"tcp://test:2375"},
 	}
 
-	clients := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
+	clients, _ := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
 
 	assert.Equal(t, 1, len(clients))
 	assert.Contains(t, clients, "test")
@@ -113,7 +113,7 @@ func Test_valid_remote_and_local(t *testing.T) {
 		RemoteHost: []string{"tcp://test:2375"},
 	}
 
-	clients := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
+	clients, _ := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
 
 	assert.Equal(t, 2, len(clients))
 	assert.Contains(t, clients, "test")
@@ -140,7 +140,7 @@ func Test_no_clients(t *testing.T) {
 
 	args := myTypes.Args{}
 
-	clients := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
+	clients, _ := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
 
 	assert.Equal(t, 0, len(clients))
 	local.AssertExpectations(t)
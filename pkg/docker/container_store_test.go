@@ -2,8 +2,9 @@ package docker
 
 import (
 	"context"
-
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/kekaadrenalin/dockhook/pkg/types"
 	"github.com/stretchr/testify/assert"
@@ -97,3 +98,49 @@ func TestContainerStore_die(t *testing.T) {
 	containers, _ := store.List()
 	assert.Equal(t, containers[0].State, "exited")
 }
+
+func TestContainerStore_unreachable(t *testing.T) {
+	client := new(mockedClient)
+	client.On("ListContainers").Return([]types.Container{}, errors.New("connection refused"))
+	client.On("Events", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	})
+	client.On("Host").Return(&types.Host{ID: "remote", Name: "remote"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	store := types.NewContainerStore(ctx, client)
+
+	_, err := store.List()
+	assert.EqualError(t, err, "connection refused")
+	assert.Eventually(t, func() bool { return store.State().Attempts > 0 }, time.Second, 10*time.Millisecond)
+
+	state := store.State()
+	assert.False(t, state.Connected)
+	assert.Equal(t, "connection refused", state.LastError)
+	assert.NotNil(t, state.NextAttempt)
+}
+
+func TestContainerStore_reconnect(t *testing.T) {
+	client := new(mockedClient)
+	client.On("ListContainers").Return([]types.Container{{ID: "1234", Name: "old"}}, nil).Once()
+	client.On("ListContainers").Return([]types.Container{{ID: "5678", Name: "new"}}, nil)
+	client.On("Events", mock.Anything, mock.Anything).Return(errors.New("EOF")).Once()
+	client.On("Events", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	})
+	client.On("Host").Return(&types.Host{ID: "remote", Name: "remote"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	store := types.NewContainerStore(ctx, client)
+
+	assert.Eventually(t, func() bool {
+		containers := store.Containers()
+		return store.IsConnected() && len(containers) == 1 && containers[0].Name == "new"
+	}, 5*time.Second, 10*time.Millisecond, "expected the containers to be reloaded after reconnecting")
+
+	state := store.State()
+	assert.Zero(t, state.Attempts)
+	assert.Empty(t, state.LastError)
+}
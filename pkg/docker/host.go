@@ -28,6 +28,22 @@ func ParseConnection(connection string) (types.Host, error) {
 		name = parts[1]
 	}
 
+	switch remoteURL.Scheme {
+	case "tcp":
+	case "ssh":
+		if remoteURL.User.Username() == "" {
+			return types.Host{}, fmt.Errorf("missing user in ssh connection string: %s", connection)
+		}
+
+		return types.Host{
+			ID:   strings.ReplaceAll(remoteURL.String(), "/", ""),
+			Name: name,
+			URL:  remoteURL,
+		}, nil
+	default:
+		return types.Host{}, fmt.Errorf("unsupported scheme %q, use tcp or ssh: %s", remoteURL.Scheme, connection)
+	}
+
 	basePath, err := filepath.Abs("./certs")
 	if err != nil {
 		log.Fatalf("error converting certs path to absolute: %s", err)
@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
+	ociSpec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+// instrumentedCLI records the latency of Docker API requests. Streams such as events and logs
+// are passed through, only the time to open them would be measured.
+type instrumentedCLI struct {
+	myTypes.DockerCLI
+	host string
+}
+
+func (c *instrumentedCLI) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+	start := time.Now()
+	containers, err := c.DockerCLI.ContainerList(ctx, options)
+	metrics.ObserveDockerRequest(c.host, "container_list", start, err)
+
+	return containers, err
+}
+
+func (c *instrumentedCLI) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	start := time.Now()
+	inspect, err := c.DockerCLI.ContainerInspect(ctx, containerID)
+	metrics.ObserveDockerRequest(c.host, "container_inspect", start, err)
+
+	return inspect, err
+}
+
+func (c *instrumentedCLI) Ping(ctx context.Context) (types.Ping, error) {
+	start := time.Now()
+	ping, err := c.DockerCLI.Ping(ctx)
+	metrics.ObserveDockerRequest(c.host, "ping", start, err)
+
+	return ping, err
+}
+
+func (c *instrumentedCLI) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	start := time.Now()
+	err := c.DockerCLI.ContainerStart(ctx, containerID, options)
+	metrics.ObserveDockerRequest(c.host, "container_start", start, err)
+
+	return err
+}
+
+func (c *instrumentedCLI) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	start := time.Now()
+	err := c.DockerCLI.ContainerStop(ctx, containerID, options)
+	metrics.ObserveDockerRequest(c.host, "container_stop", start, err)
+
+	return err
+}
+
+func (c *instrumentedCLI) ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error {
+	start := time.Now()
+	err := c.DockerCLI.ContainerRestart(ctx, containerID, options)
+	metrics.ObserveDockerRequest(c.host, "container_restart", start, err)
+
+	return err
+}
+
+func (c *instrumentedCLI) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	start := time.Now()
+	err := c.DockerCLI.ContainerRemove(ctx, containerID, options)
+	metrics.ObserveDockerRequest(c.host, "container_remove", start, err)
+
+	return err
+}
+
+func (c *instrumentedCLI) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ociSpec.Platform, containerName string) (container.CreateResponse, error) {
+	start := time.Now()
+	response, err := c.DockerCLI.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+	metrics.ObserveDockerRequest(c.host, "container_create", start, err)
+
+	return response, err
+}
+
+func (c *instrumentedCLI) Info(ctx context.Context) (system.Info, error) {
+	start := time.Now()
+	info, err := c.DockerCLI.Info(ctx)
+	metrics.ObserveDockerRequest(c.host, "info", start, err)
+
+	return info, err
+}
+
+func (c *instrumentedCLI) ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := c.DockerCLI.ImagePull(ctx, refStr, options)
+	metrics.ObserveDockerRequest(c.host, "image_pull", start, err)
+
+	return reader, err
+}
+
+func (c *instrumentedCLI) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	start := time.Now()
+	inspect, raw, err := c.DockerCLI.ImageInspectWithRaw(ctx, imageID)
+	metrics.ObserveDockerRequest(c.host, "image_inspect", start, err)
+
+	return inspect, raw, err
+}
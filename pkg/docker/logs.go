@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+// ReadLogs passes every line of a log stream with timestamps to emit. Streams of containers without a TTY are
+// multiplexed and split into stdout and stderr; with a TTY everything is stdout.
+func ReadLogs(reader io.Reader, tty bool, emit func(myTypes.LogEntry) error) error {
+	if tty {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if err := emit(parseLogLine(myTypes.STDOUT, scanner.Text())); err != nil {
+				return err
+			}
+		}
+
+		return scanner.Err()
+	}
+
+	stdout := &lineWriter{stream: myTypes.STDOUT, emit: emit}
+	stderr := &lineWriter{stream: myTypes.STDERR, emit: emit}
+
+	_, err := stdcopy.StdCopy(stdout, stderr, reader)
+
+	return errors.Join(err, stdout.flush(), stderr.flush())
+}
+
+// lineWriter emits complete lines; frames of the multiplexed stream do not have to end with a line
+type lineWriter struct {
+	stream  myTypes.StdType
+	emit    func(myTypes.LogEntry) error
+	pending []byte
+}
+
+func (w *lineWriter) Write(data []byte) (int, error) {
+	w.pending = append(w.pending, data...)
+
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			return len(data), nil
+		}
+
+		line := string(w.pending[:end])
+		w.pending = w.pending[end+1:]
+
+		if err := w.emit(parseLogLine(w.stream, line)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (w *lineWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	line := string(w.pending)
+	w.pending = nil
+
+	return w.emit(parseLogLine(w.stream, line))
+}
+
+// parseLogLine splits the timestamp that Docker puts in front of every line
+func parseLogLine(stream myTypes.StdType, line string) myTypes.LogEntry {
+	entry := myTypes.LogEntry{Stream: stream.String(), Message: strings.TrimSuffix(line, "\r")}
+
+	if timestamp, message, found := strings.Cut(entry.Message, " "); found {
+		if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			entry.Time = parsed
+			entry.Message = message
+		}
+	}
+
+	return entry
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func collectLogs(t *testing.T, data []byte, tty bool) []myTypes.LogEntry {
+	entries := make([]myTypes.LogEntry, 0)
+	err := ReadLogs(bytes.NewReader(data), tty, func(entry myTypes.LogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return entries
+}
+
+func Test_ReadLogs_multiplexed(t *testing.T) {
+	var data bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&data, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(&data, stdcopy.Stderr)
+
+	_, _ = stdout.Write([]byte("2024-05-01T10:00:00.000000001Z starting\n"))
+	_, _ = stderr.Write([]byte("2024-05-01T10:00:01Z panic: config "))
+	_, _ = stderr.Write([]byte("missing\n"))
+	_, _ = stdout.Write([]byte("2024-05-01T10:00:02Z no newline"))
+
+	entries := collectLogs(t, data.Bytes(), false)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, myTypes.LogEntry{Time: time.Date(2024, 5, 1, 10, 0, 0, 1, time.UTC), Stream: "stdout", Message: "starting"}, entries[0])
+	assert.Equal(t, "stderr", entries[1].Stream)
+	assert.Equal(t, "panic: config missing", entries[1].Message, "expected a line split across frames to be joined")
+	assert.Equal(t, "no newline", entries[2].Message)
+}
+
+func Test_ReadLogs_tty(t *testing.T) {
+	entries := collectLogs(t, []byte("2024-05-01T10:00:00Z \x1b[32mready\x1b[0m\r\nnot a timestamp\n"), true)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "stdout", entries[0].Stream)
+	assert.Equal(t, "\x1b[32mready\x1b[0m", entries[0].Message)
+	assert.Equal(t, "not a timestamp", entries[1].Message)
+	assert.True(t, entries[1].Time.IsZero())
+}
+
+func Test_ReadLogs_multiplexed_without_headers(t *testing.T) {
+	err := ReadLogs(strings.NewReader("2024-05-01T10:00:00Z plain text\n"), false, func(myTypes.LogEntry) error { return nil })
+	assert.Error(t, err, "expected a TTY stream read as multiplexed to fail instead of returning garbage")
+}
@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+const (
+	sshDefaultPort   = "22"
+	sshDefaultSocket = "/var/run/docker.sock"
+	sshDialTimeout   = 10 * time.Second
+)
+
+// sshDialer tunnels connections to the Docker socket of a remote host over one SSH connection,
+// which is opened again when it is lost
+type sshDialer struct {
+	addr   string
+	socket string
+	config ssh.ClientConfig
+	// agent is the socket of the ssh agent asked for keys when no key file is set
+	agent string
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func newSSHDialer(host myTypes.Host) (*sshDialer, error) {
+	var auth []ssh.AuthMethod
+	agentSocket := ""
+	if host.SSHKey != "" {
+		signer, err := sshKey(host.SSHKey)
+		if err != nil {
+			return nil, err
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if agentSocket = os.Getenv("SSH_AUTH_SOCK"); agentSocket == "" {
+		return nil, errors.New("no ssh key, set --ssh-key or SSH_AUTH_SOCK")
+	}
+
+	hostKeys, err := sshKnownHosts(host.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	port := host.URL.Port()
+	if port == "" {
+		port = sshDefaultPort
+	}
+
+	// ssh://user@host/run/user/1000/docker.sock reaches a rootless daemon
+	socket := host.URL.Path
+	if socket == "" || socket == "/" {
+		socket = sshDefaultSocket
+	}
+
+	return &sshDialer{
+		addr:   net.JoinHostPort(host.URL.Hostname(), port),
+		socket: socket,
+		config: ssh.ClientConfig{
+			User:            host.URL.User.Username(),
+			Auth:            auth,
+			HostKeyCallback: hostKeys,
+			Timeout:         sshDialTimeout,
+		},
+		agent: agentSocket,
+	}, nil
+}
+
+// DialContext ignores the address asked for by the Docker client and opens the remote socket instead
+func (d *sshDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.Dial("unix", d.socket)
+	if err == nil {
+		return conn, nil
+	}
+
+	// A refused channel comes from a live connection, e.g. when the socket does not exist
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		return nil, err
+	}
+
+	// The connection may have died without Wait returning yet, try once more on a new one
+	d.reset(client)
+	if client, err = d.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	return client.Dial("unix", d.socket)
+}
+
+func (d *sshDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	config := d.config
+	if d.agent != "" {
+		// The agent is asked on every handshake, so keys added to it later are used too
+		agentConn, err := net.Dial("unix", d.agent)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to ssh agent: %w", err)
+		}
+		defer agentConn.Close()
+
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers)}
+	}
+
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake does not take a context, a deadline keeps a silent server from blocking it
+	deadline := time.Now().Add(config.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, d.addr, &config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	log.Debugf("Opened SSH connection to %s", d.addr)
+	client := ssh.NewClient(sshConn, channels, requests)
+	go func() {
+		err := client.Wait()
+		log.Debugf("SSH connection to %s closed: %v", d.addr, err)
+		d.reset(client)
+	}()
+
+	d.client = client
+
+	return client, nil
+}
+
+func (d *sshDialer) reset(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == client {
+		d.client = nil
+		_ = client.Close()
+	}
+}
+
+func sshKey(path string) (ssh.Signer, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var passphraseErr *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseErr) {
+		return nil, fmt.Errorf("ssh key %s is protected by a passphrase, add it to an ssh agent instead", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read ssh key %s: %w", path, err)
+	}
+
+	return signer, nil
+}
+
+func sshKnownHosts(path string) (ssh.HostKeyCallback, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known hosts: %w", err)
+	}
+
+	return callback, nil
+}
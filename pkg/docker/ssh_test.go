@@ -0,0 +1,286 @@
+package docker
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_ParseConnection_ssh(t *testing.T) {
+	host, err := ParseConnection("ssh://deploy@edge-1:2222|edge")
+	require.NoError(t, err)
+	assert.Equal(t, "ssh:deploy@edge-1:2222", host.ID)
+	assert.Equal(t, "edge", host.Name)
+	assert.Equal(t, "ssh", host.URL.Scheme)
+	assert.False(t, host.ValidCerts)
+
+	_, err = ParseConnection("ssh://edge-1")
+	assert.ErrorContains(t, err, "missing user")
+
+	_, err = ParseConnection("unix:///var/run/docker.sock")
+	assert.ErrorContains(t, err, "unsupported scheme")
+}
+
+func Test_sshDialer_key(t *testing.T) {
+	clientKey := newSSHKey(t)
+	server := newSSHServer(t, clientKey.PublicKey())
+
+	host := server.host(t, "")
+	host.SSHKey = writeSSHKey(t, clientKey)
+
+	client, err := NewClientWithTLSAndFilter(nil, host)
+	require.NoError(t, err)
+
+	containers, err := client.ListContainers()
+	require.NoError(t, err)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "web", containers[0].Name)
+	assert.Equal(t, host.ID, containers[0].Host)
+	assert.Equal(t, 2, client.Host().NCPU)
+}
+
+func Test_sshDialer_agent(t *testing.T) {
+	clientKey := newSSHKey(t)
+	server := newSSHServer(t, clientKey.PublicKey())
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: clientKey.private}))
+
+	// Unix socket paths are short, t.TempDir can be too long for them
+	dir, err := os.MkdirTemp("", "agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", listener.Addr().String())
+
+	client, err := NewClientWithTLSAndFilter(nil, server.host(t, ""))
+	require.NoError(t, err)
+
+	_, err = client.ListContainers()
+	assert.NoError(t, err)
+}
+
+func Test_sshDialer_known_hosts(t *testing.T) {
+	clientKey := newSSHKey(t)
+	server := newSSHServer(t, clientKey.PublicKey())
+
+	host := server.host(t, "")
+	host.SSHKey = writeSSHKey(t, clientKey)
+	host.KnownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{server.addr}, newSSHKey(t).PublicKey())
+	require.NoError(t, os.WriteFile(host.KnownHosts, []byte(line+"\n"), 0600))
+
+	client, err := NewClientWithTLSAndFilter(nil, host)
+	require.NoError(t, err)
+
+	_, err = client.ListContainers()
+	assert.ErrorContains(t, err, "knownhosts: key mismatch")
+
+	require.NoError(t, os.WriteFile(host.KnownHosts, nil, 0600))
+	client, err = NewClientWithTLSAndFilter(nil, host)
+	require.NoError(t, err)
+
+	_, err = client.ListContainers()
+	assert.ErrorContains(t, err, "knownhosts: key is unknown")
+}
+
+func Test_sshDialer_socket(t *testing.T) {
+	clientKey := newSSHKey(t)
+	server := newSSHServer(t, clientKey.PublicKey())
+
+	host := server.host(t, "/run/user/1000/docker.sock")
+	host.SSHKey = writeSSHKey(t, clientKey)
+
+	client, err := NewClientWithTLSAndFilter(nil, host)
+	require.NoError(t, err)
+
+	_, err = client.ListContainers()
+	assert.ErrorContains(t, err, "no such socket")
+}
+
+func Test_sshDialer_missing_auth(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	_, err := NewClientWithTLSAndFilter(nil, myTypes.Host{URL: &url.URL{Scheme: "ssh", User: url.User("deploy"), Host: "edge-1"}})
+	assert.ErrorContains(t, err, "no ssh key")
+}
+
+type testSSHKey struct {
+	private ed25519.PrivateKey
+	signer  ssh.Signer
+}
+
+func (k testSSHKey) PublicKey() ssh.PublicKey {
+	return k.signer.PublicKey()
+}
+
+func newSSHKey(t *testing.T) testSSHKey {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(private)
+	require.NoError(t, err)
+
+	return testSSHKey{private: private, signer: signer}
+}
+
+func writeSSHKey(t *testing.T, key testSSHKey) string {
+	t.Helper()
+
+	block, err := ssh.MarshalPrivateKey(key.private, "")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+
+	return path
+}
+
+// sshServer stands in for sshd on a Docker host, its Docker socket is a fake Docker API
+type sshServer struct {
+	addr    string
+	hostKey testSSHKey
+}
+
+func newSSHServer(t *testing.T, authorized ssh.PublicKey) *sshServer {
+	t.Helper()
+
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_ping":
+			w.Header().Set("API-Version", "1.46")
+			_, _ = io.WriteString(w, "OK")
+		case strings.HasSuffix(r.URL.Path, "/info"):
+			_, _ = io.WriteString(w, `{"NCPU": 2, "MemTotal": 1024}`)
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			_, _ = io.WriteString(w, `[{"Id": "0123456789abcdef", "Names": ["/web"], "Image": "nginx", "State": "running"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(docker.Close)
+
+	server := &sshServer{hostKey: newSSHKey(t)}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(server.hostKey.signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	server.addr = listener.Addr().String()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config, docker.Listener.Addr().String())
+		}
+	}()
+
+	return server
+}
+
+func (s *sshServer) serve(conn net.Conn, config *ssh.ServerConfig, docker string) {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		var forward struct {
+			SocketPath string
+			Reserved0  string
+			Reserved1  uint32
+		}
+		if newChannel.ChannelType() != "direct-streamlocal@openssh.com" || ssh.Unmarshal(newChannel.ExtraData(), &forward) != nil {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+
+		if forward.SocketPath != "/var/run/docker.sock" {
+			_ = newChannel.Reject(ssh.ConnectionFailed, "no such socket")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+
+		backend, err := net.Dial("tcp", docker)
+		if err != nil {
+			_ = channel.Close()
+			continue
+		}
+
+		go func() {
+			_, _ = io.Copy(backend, channel)
+			_ = backend.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(channel, backend)
+			_ = channel.Close()
+		}()
+	}
+}
+
+// host returns a remote host for the server that trusts its host key
+func (s *sshServer) host(t *testing.T, socket string) myTypes.Host {
+	t.Helper()
+
+	host, err := ParseConnection("ssh://deploy@" + s.addr + socket)
+	require.NoError(t, err)
+
+	host.KnownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{s.addr}, s.hostKey.PublicKey())
+	require.NoError(t, os.WriteFile(host.KnownHosts, []byte(line+"\n"), 0600))
+
+	return host
+}
@@ -0,0 +1,206 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+// statsConcurrency limits the one-shot samples taken at once per host, Docker needs about a second for each
+const statsConcurrency = 8
+
+// ContainerStats sends the samples of a container to stats, only the first one unless stream is set
+func (d *httpClient) ContainerStats(ctx context.Context, id string, stream bool, stats chan<- myTypes.ContainerStats) error {
+	response, err := d.cli.ContainerStats(ctx, id, stream)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var sample container.StatsResponse
+		if err := decoder.Decode(&sample); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		select {
+		case stats <- calculateStats(d.host.ID, response.OSType, sample):
+		case <-ctx.Done():
+			return nil
+		}
+
+		if !stream {
+			return nil
+		}
+	}
+}
+
+func calculateStats(host string, osType string, sample container.StatsResponse) myTypes.ContainerStats {
+	stats := myTypes.ContainerStats{
+		ID:   sample.ID,
+		Name: strings.TrimPrefix(sample.Name, "/"),
+		Host: host,
+		Time: sample.Read,
+		PIDs: sample.PidsStats.Current,
+	}
+	if len(stats.ID) > 12 {
+		stats.ID = stats.ID[:12]
+	}
+
+	if osType == "windows" {
+		stats.CPUPercent = windowsCPUPercent(sample)
+		stats.MemoryUsage = sample.MemoryStats.PrivateWorkingSet
+		stats.BlockRead = sample.StorageStats.ReadSizeBytes
+		stats.BlockWrite = sample.StorageStats.WriteSizeBytes
+	} else {
+		stats.CPUPercent = unixCPUPercent(sample)
+		stats.MemoryUsage = memoryUsage(sample.MemoryStats)
+		stats.MemoryLimit = sample.MemoryStats.Limit
+		stats.BlockRead, stats.BlockWrite = blockIO(sample.BlkioStats)
+	}
+
+	if stats.MemoryLimit != 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+
+	for _, network := range sample.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+
+	return stats
+}
+
+func unixCPUPercent(sample container.StatsResponse) float64 {
+	cpuDelta := float64(sample.CPUStats.CPUUsage.TotalUsage) - float64(sample.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(sample.CPUStats.SystemUsage) - float64(sample.PreCPUStats.SystemUsage)
+
+	cpus := float64(sample.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(sample.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+func windowsCPUPercent(sample container.StatsResponse) float64 {
+	// CPU usage is counted in 100ns intervals
+	possible := float64(sample.Read.Sub(sample.PreRead).Nanoseconds()) / 100 * float64(sample.NumProcs)
+	used := float64(sample.CPUStats.CPUUsage.TotalUsage) - float64(sample.PreCPUStats.CPUUsage.TotalUsage)
+
+	if possible <= 0 || used <= 0 {
+		return 0
+	}
+
+	return used / possible * 100
+}
+
+// memoryUsage leaves out the page cache that can be reclaimed, cgroup v1 and v2 name it differently
+func memoryUsage(memory container.MemoryStats) uint64 {
+	if inactive, ok := memory.Stats["total_inactive_file"]; ok && inactive < memory.Usage {
+		return memory.Usage - inactive
+	}
+
+	if inactive := memory.Stats["inactive_file"]; inactive < memory.Usage {
+		return memory.Usage - inactive
+	}
+
+	return memory.Usage
+}
+
+func blockIO(blkio container.BlkioStats) (read uint64, write uint64) {
+	for _, entry := range blkio.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += entry.Value
+		case "write":
+			write += entry.Value
+		}
+	}
+
+	return read, write
+}
+
+// CollectStats takes a one-shot sample of every container; containers that fail, e.g. because they stopped, are left out
+func CollectStats(ctx context.Context, client myTypes.Client, ids []string) []myTypes.ContainerStats {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make([]myTypes.ContainerStats, 0, len(ids))
+		limit   = make(chan struct{}, statsConcurrency)
+	)
+
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			sample := make(chan myTypes.ContainerStats, 1)
+			if err := client.ContainerStats(ctx, id, false, sample); err != nil {
+				log.Debugf("Could not read stats of container %s: %v", id, err)
+				return
+			}
+
+			select {
+			case stats := <-sample:
+				mu.Lock()
+				results = append(results, stats)
+				mu.Unlock()
+			default:
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// AggregateStats sums container stats into the stats of their host; memory is relative to the memory of the host
+func AggregateStats(host *myTypes.Host, stats []myTypes.ContainerStats) myTypes.HostStats {
+	aggregate := myTypes.HostStats{
+		Host:        host.ID,
+		Time:        time.Now().UTC(),
+		Containers:  len(stats),
+		CPUs:        host.NCPU,
+		MemoryTotal: uint64(max(host.MemTotal, 0)),
+		Stats:       stats,
+	}
+
+	for _, item := range stats {
+		aggregate.CPUPercent += item.CPUPercent
+		aggregate.MemoryUsage += item.MemoryUsage
+		aggregate.NetworkRx += item.NetworkRx
+		aggregate.NetworkTx += item.NetworkTx
+		aggregate.BlockRead += item.BlockRead
+		aggregate.BlockWrite += item.BlockWrite
+		aggregate.PIDs += item.PIDs
+	}
+
+	if aggregate.MemoryTotal != 0 {
+		aggregate.MemoryPercent = float64(aggregate.MemoryUsage) / float64(aggregate.MemoryTotal) * 100
+	}
+
+	return aggregate
+}
@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/system"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+const statsSample = `{
+	"read": "2024-08-01T10:00:01Z",
+	"preread": "2024-08-01T10:00:00Z",
+	"id": "0123456789abcdef",
+	"name": "/web",
+	"pids_stats": {"current": 7},
+	"cpu_stats": {"cpu_usage": {"total_usage": 300000000}, "system_cpu_usage": 4000000000, "online_cpus": 4},
+	"precpu_stats": {"cpu_usage": {"total_usage": 100000000}, "system_cpu_usage": 2000000000},
+	"memory_stats": {"usage": 104857600, "limit": 1048576000, "stats": {"inactive_file": 52428800}},
+	"networks": {"eth0": {"rx_bytes": 100, "tx_bytes": 200}, "eth1": {"rx_bytes": 10, "tx_bytes": 20}},
+	"blkio_stats": {"io_service_bytes_recursive": [
+		{"major": 8, "minor": 0, "op": "Read", "value": 1000},
+		{"major": 8, "minor": 0, "op": "write", "value": 2000},
+		{"major": 8, "minor": 0, "op": "Total", "value": 3000}
+	]}
+}`
+
+func Test_calculateStats_linux(t *testing.T) {
+	client := &httpClient{mockStats(t, statsSample), filters.NewArgs(), &myTypes.Host{ID: "localhost"}, system.Info{}}
+
+	stats := make(chan myTypes.ContainerStats, 1)
+	require.NoError(t, client.ContainerStats(context.Background(), "0123456789abcdef", false, stats))
+
+	actual := <-stats
+	assert.Equal(t, "0123456789ab", actual.ID)
+	assert.Equal(t, "web", actual.Name)
+	assert.Equal(t, "localhost", actual.Host)
+	assert.Equal(t, time.Date(2024, time.August, 1, 10, 0, 1, 0, time.UTC), actual.Time)
+	assert.InDelta(t, 40, actual.CPUPercent, 0.001)
+	assert.Equal(t, uint64(52428800), actual.MemoryUsage)
+	assert.Equal(t, uint64(1048576000), actual.MemoryLimit)
+	assert.InDelta(t, 5, actual.MemoryPercent, 0.001)
+	assert.Equal(t, uint64(110), actual.NetworkRx)
+	assert.Equal(t, uint64(220), actual.NetworkTx)
+	assert.Equal(t, uint64(1000), actual.BlockRead)
+	assert.Equal(t, uint64(2000), actual.BlockWrite)
+	assert.Equal(t, uint64(7), actual.PIDs)
+}
+
+func Test_calculateStats_cgroup_v1(t *testing.T) {
+	memory := container.MemoryStats{Usage: 1000, Stats: map[string]uint64{"total_inactive_file": 300, "inactive_file": 100}}
+	assert.Equal(t, uint64(700), memoryUsage(memory))
+
+	memory = container.MemoryStats{Usage: 1000, Stats: map[string]uint64{"total_inactive_file": 3000}}
+	assert.Equal(t, uint64(1000), memoryUsage(memory))
+}
+
+func Test_calculateStats_percpu(t *testing.T) {
+	sample := container.StatsResponse{}
+	sample.CPUStats.CPUUsage.TotalUsage = 200
+	sample.CPUStats.CPUUsage.PercpuUsage = []uint64{100, 100}
+	sample.CPUStats.SystemUsage = 1000
+
+	assert.InDelta(t, 40, unixCPUPercent(sample), 0.001)
+}
+
+func Test_calculateStats_windows(t *testing.T) {
+	sample := container.StatsResponse{}
+	sample.PreRead = time.Date(2024, time.August, 1, 10, 0, 0, 0, time.UTC)
+	sample.Read = sample.PreRead.Add(time.Second)
+	sample.NumProcs = 2
+	sample.CPUStats.CPUUsage.TotalUsage = 5_000_000
+	sample.MemoryStats.PrivateWorkingSet = 4096
+	sample.StorageStats.ReadSizeBytes = 10
+
+	actual := calculateStats("localhost", "windows", sample)
+	assert.InDelta(t, 25, actual.CPUPercent, 0.001)
+	assert.Equal(t, uint64(4096), actual.MemoryUsage)
+	assert.Equal(t, uint64(10), actual.BlockRead)
+}
+
+func Test_dockerClient_ContainerStats_stream(t *testing.T) {
+	body := strings.ReplaceAll(statsSample, "\n", "") + "\n" + strings.ReplaceAll(statsSample, "\n", "") + "\n"
+	client := &httpClient{mockStats(t, body), filters.NewArgs(), &myTypes.Host{ID: "localhost"}, system.Info{}}
+
+	stats := make(chan myTypes.ContainerStats, 2)
+	require.NoError(t, client.ContainerStats(context.Background(), "0123456789abcdef", true, stats))
+	assert.Len(t, stats, 2)
+}
+
+func Test_dockerClient_ContainerStats_error(t *testing.T) {
+	proxy := new(mockedProxy)
+	proxy.On("ContainerStats", mock.Anything, "missing", false).Return(container.StatsResponseReader{}, errors.New("no such container"))
+	client := &httpClient{proxy, filters.NewArgs(), &myTypes.Host{ID: "localhost"}, system.Info{}}
+
+	assert.Error(t, client.ContainerStats(context.Background(), "missing", false, make(chan myTypes.ContainerStats, 1)))
+	assert.Empty(t, CollectStats(context.Background(), client, []string{"missing"}))
+}
+
+func Test_AggregateStats(t *testing.T) {
+	host := &myTypes.Host{ID: "localhost", NCPU: 4, MemTotal: 1000}
+	stats := []myTypes.ContainerStats{
+		{ID: "a", CPUPercent: 10, MemoryUsage: 100, NetworkRx: 1, NetworkTx: 2, BlockRead: 3, BlockWrite: 4, PIDs: 5},
+		{ID: "b", CPUPercent: 30, MemoryUsage: 150, NetworkRx: 1, NetworkTx: 2, BlockRead: 3, BlockWrite: 4, PIDs: 5},
+	}
+
+	actual := AggregateStats(host, stats)
+	assert.Equal(t, "localhost", actual.Host)
+	assert.Equal(t, 2, actual.Containers)
+	assert.Equal(t, 4, actual.CPUs)
+	assert.InDelta(t, 40, actual.CPUPercent, 0.001)
+	assert.Equal(t, uint64(250), actual.MemoryUsage)
+	assert.InDelta(t, 25, actual.MemoryPercent, 0.001)
+	assert.Equal(t, uint64(2), actual.NetworkRx)
+	assert.Equal(t, uint64(8), actual.BlockWrite)
+	assert.Equal(t, uint64(10), actual.PIDs)
+}
+
+func mockStats(t *testing.T, body string) *mockedProxy {
+	t.Helper()
+
+	proxy := new(mockedProxy)
+	proxy.On("ContainerStats", mock.Anything, mock.Anything, mock.Anything).Return(container.StatsResponseReader{
+		Body:   io.NopCloser(strings.NewReader(body)),
+		OSType: "linux",
+	}, nil)
+
+	return proxy
+}
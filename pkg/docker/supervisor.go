@@ -0,0 +1,158 @@
+package docker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+// Waits between attempts to connect to a remote host that was down at startup
+const (
+	supervisorMinWait = 5 * time.Second
+	supervisorMaxWait = 5 * time.Minute
+)
+
+// PendingHost is a remote host that has not been reachable yet
+type PendingHost struct {
+	Host  myTypes.Host
+	State myTypes.ConnectionState
+}
+
+// Supervisor retries remote hosts that could not be reached at startup and hands out their clients once they answer
+type Supervisor struct {
+	filters map[string][]string
+	factory func(map[string][]string, myTypes.Host) (myTypes.Client, error)
+	mu      sync.RWMutex
+	pending map[string]*PendingHost
+	clients chan myTypes.Client
+	minWait time.Duration
+	maxWait time.Duration
+}
+
+func newSupervisor(filters map[string][]string, factory func(map[string][]string, myTypes.Host) (myTypes.Client, error)) *Supervisor {
+	return &Supervisor{
+		filters: filters,
+		factory: factory,
+		pending: make(map[string]*PendingHost),
+		clients: make(chan myTypes.Client),
+		minWait: supervisorMinWait,
+		maxWait: supervisorMaxWait,
+	}
+}
+
+func (s *Supervisor) add(host myTypes.Host, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[host.ID] = &PendingHost{Host: host, State: myTypes.ConnectionState{Since: time.Now(), Attempts: 1, LastError: err.Error()}}
+}
+
+// Start retries every pending host until it is connected or ctx is done
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for id := range s.pending {
+		go s.watch(ctx, id)
+	}
+}
+
+// Clients receives the client of each pending host once it is connected
+func (s *Supervisor) Clients() <-chan myTypes.Client {
+	return s.clients
+}
+
+// Pending returns the hosts that are not connected yet, sorted by ID
+func (s *Supervisor) Pending() []PendingHost {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hosts := make([]PendingHost, 0, len(s.pending))
+	for _, pending := range s.pending {
+		hosts = append(hosts, *pending)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host.ID < hosts[j].Host.ID
+	})
+
+	return hosts
+}
+
+func (s *Supervisor) watch(ctx context.Context, id string) {
+	for {
+		wait := s.schedule(id)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		client, err := s.connect(id)
+		if err == nil {
+			log.Infof("Connected to remote host %s", client.Host().Name)
+			select {
+			case s.clients <- client:
+			case <-ctx.Done():
+				return
+			}
+
+			// Removed only now so that the host is always listed somewhere
+			s.mu.Lock()
+			delete(s.pending, id)
+			s.mu.Unlock()
+
+			return
+		}
+
+		log.Debugf("Could not connect to remote host %s: %v", id, err)
+		s.failed(id, err)
+	}
+}
+
+func (s *Supervisor) schedule(id string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pending[id]
+	wait := helper.Backoff(pending.State.Attempts, s.minWait, s.maxWait)
+	next := time.Now().Add(wait)
+	pending.State.NextAttempt = &next
+
+	return wait
+}
+
+func (s *Supervisor) connect(id string) (myTypes.Client, error) {
+	s.mu.RLock()
+	host := s.pending[id].Host
+	s.mu.RUnlock()
+
+	client, err := s.factory(s.filters, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := client.ListContainers(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (s *Supervisor) failed(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pending[id]
+	pending.State.Attempts++
+	pending.State.LastError = err.Error()
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	myTypes "github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_Supervisor_connects_later(t *testing.T) {
+	local := new(fakeCLI)
+	local.On("ContainerList").Return([]types.Container{}, errors.New("no local docker"))
+	fakeLocalClientFactory := func(_ map[string][]string) (myTypes.Client, error) {
+		return NewClient(local, filters.NewArgs(), &myTypes.Host{ID: "localhost"}), nil
+	}
+
+	remote := new(fakeCLI)
+	remote.On("ContainerList").Return([]types.Container{}, errors.New("connection refused")).Twice()
+	remote.On("ContainerList").Return([]types.Container{}, nil)
+	fakeRemoteClientFactory := func(_ map[string][]string, host myTypes.Host) (myTypes.Client, error) {
+		return NewClient(remote, filters.NewArgs(), &host), nil
+	}
+
+	args := myTypes.Args{RemoteHost: []string{"tcp://test:2375"}}
+	clients, supervisor := createClients(args, fakeLocalClientFactory, fakeRemoteClientFactory, "")
+	assert.Empty(t, clients)
+
+	pending := supervisor.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, "tcp:test:2375", pending[0].Host.ID)
+	assert.Equal(t, "connection refused", pending[0].State.LastError)
+	assert.Equal(t, 1, pending[0].State.Attempts)
+
+	supervisor.minWait = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	supervisor.Start(ctx)
+
+	select {
+	case client := <-supervisor.Clients():
+		assert.Equal(t, "tcp:test:2375", client.Host().ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the remote host to connect")
+	}
+
+	assert.Eventually(t, func() bool { return len(supervisor.Pending()) == 0 }, time.Second, time.Millisecond)
+	remote.AssertExpectations(t)
+}
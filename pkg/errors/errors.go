@@ -1,15 +1,90 @@
 package errors
 
+import "net/http"
+
+// Codes are stable, machine-readable identifiers of API errors
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeTooManyRequests      = "too_many_requests"
+	CodeInternal             = "internal_error"
+	CodeInvalidWebhookUUID   = "invalid_webhook_uuid"
+	CodeWebhookNotFound      = "webhook_not_found"
+	CodeHostNotFound         = "host_not_found"
+	CodeContainerNotFound    = "container_not_found"
+	CodeActionFailed         = "container_action_failed"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeSecondFactorRequired = "second_factor_required"
+	CodeSessionExpired       = "session_expired"
+	CodeAPITokenNotAllowed   = "api_token_not_allowed"
+	CodeUserNotFound         = "user_not_found"
+	CodeUserExists           = "user_exists"
+	CodeInvalidUser          = "invalid_user"
+	CodeLastAdmin            = "last_admin"
+	CodeTokenNotFound        = "token_not_found"
+	CodeInvalidToken         = "invalid_token"
+	CodeTokenOwnerNotLocal   = "token_owner_not_local"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeBadRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	http.StatusConflict:            CodeConflict,
+	http.StatusTooManyRequests:     CodeTooManyRequests,
+	http.StatusInternalServerError: CodeInternal,
+}
+
 type HTTPError struct {
 	StatusCode int
+	Code       string
 	Message    string
 	Err        error
 }
 
+func New(statusCode int, code string, message string) *HTTPError {
+	return &HTTPError{StatusCode: statusCode, Code: code, Message: message}
+}
+
 func (m *HTTPError) Error() string {
 	if m.Message != "" {
 		return m.Message
 	}
 
+	if m.Err == nil {
+		return http.StatusText(m.StatusCode)
+	}
+
 	return m.Err.Error()
 }
+
+func (m *HTTPError) Unwrap() error {
+	return m.Err
+}
+
+// ErrorCode returns the code of the error or a generic one for its status
+func (m *HTTPError) ErrorCode() string {
+	if m.Code != "" {
+		return m.Code
+	}
+
+	return CodeForStatus(m.StatusCode)
+}
+
+func CodeForStatus(statusCode int) string {
+	if code, ok := statusCodes[statusCode]; ok {
+		return code
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return CodeBadRequest
+}
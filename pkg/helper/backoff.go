@@ -0,0 +1,21 @@
+package helper
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff returns how long to wait before the given retry, counted from 1: base doubles with every attempt up to limit.
+// Up to a fifth is taken off at random so that hosts that failed together do not retry together.
+func Backoff(attempt int, base time.Duration, limit time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+
+	if wait > limit {
+		wait = limit
+	}
+
+	return wait - time.Duration(rand.Int64N(int64(wait)/5+1))
+}
@@ -0,0 +1,27 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Backoff(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, time.Minute},
+		{1000, time.Minute},
+	}
+
+	for _, test := range tests {
+		wait := Backoff(test.attempt, time.Second, time.Minute)
+		assert.LessOrEqual(t, wait, test.expected, "attempt %d", test.attempt)
+		assert.GreaterOrEqual(t, wait, test.expected*4/5, "attempt %d", test.attempt)
+	}
+}
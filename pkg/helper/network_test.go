@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseCIDRs_happy(t *testing.T) {
+	networks, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.10", "::1", ""})
+	require.NoError(t, err, "expected no error")
+	require.Len(t, networks, 3)
+
+	assert.True(t, ContainsIP(networks, net.ParseIP("10.1.2.3")))
+	assert.True(t, ContainsIP(networks, net.ParseIP("192.168.1.10")))
+	assert.False(t, ContainsIP(networks, net.ParseIP("192.168.1.11")))
+	assert.True(t, ContainsIP(networks, net.ParseIP("::1")))
+}
+
+func Test_ParseCIDRs_error(t *testing.T) {
+	_, err := ParseCIDRs([]string{"not-an-ip"})
+	assert.Error(t, err, "expected error for invalid address")
+
+	_, err = ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.Error(t, err, "expected error for invalid network")
+}
+
+func Test_ClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err, "expected no error")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"direct", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"untrusted peer", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:1234", "198.51.100.1, 203.0.113.9, 10.0.0.3", "203.0.113.9"},
+		{"only proxies", "10.0.0.2:1234", "10.0.0.3", "10.0.0.3"},
+		{"garbage", "10.0.0.2:1234", "unknown", "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+
+			assert.Equal(t, test.expected, ClientIP(req, trusted).String())
+		})
+	}
+}
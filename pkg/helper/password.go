@@ -0,0 +1,168 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2id parameters follow the OWASP recommendation for interactive logins
+const (
+	argon2Memory  uint32 = 19 * 1024
+	argon2Time    uint32 = 2
+	argon2Threads uint8  = 1
+	argon2SaltLen        = 16
+	argon2KeyLen  uint32 = 32
+)
+
+// Ceilings for parameters read from a hash, so that one crafted hash cannot make a login exhaust memory or CPU
+const (
+	argon2MaxMemory  uint32 = 256 * 1024
+	argon2MaxTime    uint32 = 16
+	argon2MaxThreads uint8  = 16
+	argon2MaxKeyLen         = 64
+)
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// HashPassword hashes the password with argon2id and returns it in PHC string format
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		argon2Memory,
+		argon2Time,
+		argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword checks the password against an argon2id, bcrypt or legacy SHA-512 hash.
+// The second result reports whether the hash should be replaced with a fresh HashPassword one.
+func VerifyPassword(hash, password string) (bool, bool) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return false, false
+		}
+
+		actual := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false
+		}
+
+		return true, params.memory < argon2Memory || params.time < argon2Time
+
+	case isBcryptHash(hash):
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, false
+		}
+
+		return true, false
+
+	case IsLegacyPasswordHash(hash):
+		ok := subtle.ConstantTimeCompare([]byte(hash), []byte(Sha512sum(password))) == 1
+
+		return ok, ok
+	}
+
+	return false, false
+}
+
+// ValidatePasswordHash reports whether the hash is in one of the supported formats
+func ValidatePasswordHash(hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, _, _, err := decodeArgon2Hash(hash)
+
+		return err
+
+	case isBcryptHash(hash):
+		_, err := bcrypt.Cost([]byte(hash))
+
+		return err
+
+	case IsLegacyPasswordHash(hash):
+		return nil
+	}
+
+	return ErrUnknownPasswordHash
+}
+
+// IsLegacyPasswordHash reports whether the hash is an unsalted hex-encoded SHA-512 sum
+func IsLegacyPasswordHash(hash string) bool {
+	if len(hash) != 128 {
+		return false
+	}
+
+	_, err := hex.DecodeString(hash)
+
+	return err == nil
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	var version int
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	if len(key) == 0 || params.time == 0 || params.threads == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	if params.memory > argon2MaxMemory || params.time > argon2MaxTime || params.threads > argon2MaxThreads || len(key) > argon2MaxKeyLen {
+		return params, nil, nil, fmt.Errorf("argon2 parameters exceed m=%d,t=%d,p=%d", argon2MaxMemory, argon2MaxTime, argon2MaxThreads)
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_HashPassword_happy(t *testing.T) {
+	hash, err := HashPassword("password")
+	require.NoError(t, err, "expected no error")
+
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$"), "expected PHC argon2id string")
+	assert.NoError(t, ValidatePasswordHash(hash), "expected hash to be valid")
+
+	other, err := HashPassword("password")
+	require.NoError(t, err, "expected no error")
+	assert.NotEqual(t, hash, other, "expected hashes to be salted")
+}
+
+func Test_VerifyPassword_argon2id(t *testing.T) {
+	hash, err := HashPassword("password")
+	require.NoError(t, err, "expected no error")
+
+	ok, rehash := VerifyPassword(hash, "password")
+	assert.True(t, ok, "expected password to match")
+	assert.False(t, rehash, "expected no rehash for current parameters")
+
+	ok, _ = VerifyPassword(hash, "wrong")
+	assert.False(t, ok, "expected wrong password to fail")
+}
+
+func Test_VerifyPassword_bcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err, "expected no error")
+
+	ok, rehash := VerifyPassword(string(hash), "password")
+	assert.True(t, ok, "expected password to match")
+	assert.False(t, rehash, "expected bcrypt hashes to be kept")
+
+	ok, _ = VerifyPassword(string(hash), "wrong")
+	assert.False(t, ok, "expected wrong password to fail")
+}
+
+func Test_VerifyPassword_legacy(t *testing.T) {
+	ok, rehash := VerifyPassword(Sha512sum("password"), "password")
+	assert.True(t, ok, "expected password to match")
+	assert.True(t, rehash, "expected legacy hash to be upgraded")
+
+	ok, rehash = VerifyPassword(Sha512sum("password"), "wrong")
+	assert.False(t, ok, "expected wrong password to fail")
+	assert.False(t, rehash, "expected no upgrade on failure")
+}
+
+func Test_ValidatePasswordHash_error(t *testing.T) {
+	tests := []string{
+		"",
+		"plain-text",
+		strings.Repeat("z", 128),
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+		"$argon2id$v=18$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=4194304,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=100000,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=255$c2FsdA$a2V5",
+		"$2b$10$short",
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			assert.Error(t, ValidatePasswordHash(test))
+		})
+	}
+}
+
+func Test_VerifyPassword_argon2id_limits(t *testing.T) {
+	// Rejected before hashing, otherwise the login would allocate 4 GiB
+	ok, rehash := VerifyPassword("$argon2id$v=19$m=4194304,t=2,p=1$c2FsdA$a2V5", "password")
+	assert.False(t, ok, "expected oversized parameters to be rejected")
+	assert.False(t, rehash)
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Header dumps such as map[Authorization:[Basic ...] Cookie:[jwt=...]]
+	{regexp.MustCompile(`(?i)\b(authorization|proxy-authorization|cookie|set-cookie|x-registry-auth):\[[^\]]*\]`), "$1:" + redacted},
+	{regexp.MustCompile(`(?i)\b((?:proxy-)?authorization["']?\s*[:=]\s*["']?(?:bearer|basic)\s+)[^\s"',;\]]+`), "${1}" + redacted},
+	// Credentials outside of a header only when they look like one, so that "basic auth failed" stays readable
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+(?:dh_[a-z0-9_\-]{8,}|[a-z0-9\-._~+/]{16,}=*|[a-z0-9\-._~+/]+=+)`), "$1 " + redacted},
+	{regexp.MustCompile(`(?i)(["']?\b(?:password|passwd|current_password|client_secret|secret|jwt|otp|access_token|id_token|refresh_token|registry_?auth|x-registry-auth)["']?\s*[:=]\s*["']?)[^\s"'&,;\]]+`), "${1}" + redacted},
+	// Registry credentials in JSON, e.g. a decoded X-Registry-Auth or a Docker config
+	{regexp.MustCompile(`(?i)("auth"\s*:\s*")[^"]*`), "${1}" + redacted},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + redacted + "@"},
+}
+
+// Redact masks credentials, session cookies and registry auth in s
+func Redact(s string) string {
+	for _, redaction := range redactions {
+		s = redaction.pattern.ReplaceAllString(s, redaction.replacement)
+	}
+
+	return s
+}
+
+// RedactingFormatter redacts the message and fields of every entry before formatting it
+type RedactingFormatter struct {
+	log.Formatter
+}
+
+func (f *RedactingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	entry.Message = Redact(entry.Message)
+
+	data := make(log.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			data[key] = Redact(v)
+		case error:
+			data[key] = Redact(v.Error())
+		default:
+			data[key] = value
+		}
+	}
+	entry.Data = data
+
+	return f.Formatter.Format(entry)
+}
@@ -0,0 +1,115 @@
+package helper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LoadCertPool reads PEM encoded CA certificates from a file
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// CertificateReloader serves a certificate from PEM files and loads it again when the files change,
+// e.g. after a renewal by certbot or cert-manager
+type CertificateReloader struct {
+	certPath    string
+	keyPath     string
+	certificate *tls.Certificate
+	modTime     time.Time
+	mu          sync.Mutex
+}
+
+func NewCertificateReloader(certPath, keyPath string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certPath: certPath, keyPath: keyPath}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate. The previous certificate stays in use
+// while the files cannot be loaded, for example when only one of them has been replaced yet.
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if c.changed() {
+		if err := c.load(); err != nil {
+			log.Errorf("Could not reload TLS certificate: %s", err)
+		} else {
+			log.Infof("Reloaded TLS certificate %s", c.certPath)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.certificate, nil
+}
+
+func (c *CertificateReloader) changed() bool {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return modTime.After(c.modTime)
+}
+
+func (c *CertificateReloader) load() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Broken files are not retried on every handshake, only after the next change
+	c.modTime = modTime
+	if err != nil {
+		return err
+	}
+
+	c.certificate = &certificate
+
+	return nil
+}
+
+func (c *CertificateReloader) latestModTime() (time.Time, error) {
+	cert, err := os.Stat(c.certPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	key, err := os.Stat(c.keyPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if key.ModTime().After(cert.ModTime()) {
+		return key.ModTime(), nil
+	}
+
+	return cert.ModTime(), nil
+}
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCertificate(t *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return certPath, keyPath
+}
+
+func commonName(t *testing.T, reloader *CertificateReloader) string {
+	certificate, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+
+	return parsed.Subject.CommonName
+}
+
+func Test_CertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCertificate(t, dir, "first")
+
+	reloader, err := NewCertificateReloader(certPath, keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, reloader))
+
+	writeTestCertificate(t, dir, "second")
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certPath, future, future))
+	assert.Equal(t, "second", commonName(t, reloader), "expected renewed certificate to be served")
+
+	require.NoError(t, os.WriteFile(keyPath, []byte("broken"), 0600))
+	future = future.Add(time.Second)
+	require.NoError(t, os.Chtimes(keyPath, future, future))
+	assert.Equal(t, "second", commonName(t, reloader), "expected previous certificate to stay while files are broken")
+
+	_, err = NewCertificateReloader(certPath, filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err, "expected missing key to be rejected")
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dockhook"
+
+// Registry holds every DockHook metric; it is separate from the default registry so that
+// dependencies cannot add metrics behind our back
+var Registry = prometheus.NewRegistry()
+
+var (
+	WebhookCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_calls_total",
+		Help:      "Webhook calls by webhook, action, host and result.",
+	}, []string{"webhook", "action", "host", "result"})
+
+	WebhookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_duration_seconds",
+		Help:      "Duration of webhook calls by webhook, action, host and result.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"webhook", "action", "host", "result"})
+
+	DockerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "docker_request_duration_seconds",
+		Help:      "Latency of Docker API requests by host, operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "operation", "result"})
+
+	ImagePullDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_pull_duration_seconds",
+		Help:      "Duration of image pulls including the download by host and result.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"host", "result"})
+
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Rejected credentials by kind, e.g. password or api_token.",
+	}, []string{"kind"})
+
+	Lockouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lockouts_total",
+		Help:      "Logins blocked after too many failures.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		WebhookCalls,
+		WebhookDuration,
+		DockerRequestDuration,
+		ImagePullDuration,
+		AuthFailures,
+		Lockouts,
+	)
+}
+
+// Handler serves the metrics of the Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Result converts an error to the result label
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
+
+// ObserveDockerRequest records the latency of a Docker API request started at start
+func ObserveDockerRequest(host, operation string, start time.Time, err error) {
+	DockerRequestDuration.WithLabelValues(host, operation, Result(err)).Observe(time.Since(start).Seconds())
+}
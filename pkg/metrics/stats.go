@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+var (
+	containerCPUDesc = prometheus.NewDesc(
+		namespace+"_container_cpu_percent",
+		"CPU usage of a running container as shown by docker stats, 100 per core.",
+		[]string{"host", "container"}, nil,
+	)
+	containerMemoryDesc = prometheus.NewDesc(
+		namespace+"_container_memory_usage_bytes",
+		"Memory used by a running container without the reclaimable page cache.",
+		[]string{"host", "container"}, nil,
+	)
+	containerMemoryLimitDesc = prometheus.NewDesc(
+		namespace+"_container_memory_limit_bytes",
+		"Memory limit of a running container.",
+		[]string{"host", "container"}, nil,
+	)
+	containerNetworkRxDesc = prometheus.NewDesc(
+		namespace+"_container_network_receive_bytes_total",
+		"Bytes received by a running container on all networks.",
+		[]string{"host", "container"}, nil,
+	)
+	containerNetworkTxDesc = prometheus.NewDesc(
+		namespace+"_container_network_transmit_bytes_total",
+		"Bytes sent by a running container on all networks.",
+		[]string{"host", "container"}, nil,
+	)
+	containerBlockReadDesc = prometheus.NewDesc(
+		namespace+"_container_block_read_bytes_total",
+		"Bytes read from block devices by a running container.",
+		[]string{"host", "container"}, nil,
+	)
+	containerBlockWriteDesc = prometheus.NewDesc(
+		namespace+"_container_block_write_bytes_total",
+		"Bytes written to block devices by a running container.",
+		[]string{"host", "container"}, nil,
+	)
+	containerPIDsDesc = prometheus.NewDesc(
+		namespace+"_container_pids",
+		"Processes of a running container.",
+		[]string{"host", "container"}, nil,
+	)
+	hostCPUDesc = prometheus.NewDesc(
+		namespace+"_host_containers_cpu_percent",
+		"CPU usage of all running containers of a host, 100 per core.",
+		[]string{"host"}, nil,
+	)
+	hostMemoryDesc = prometheus.NewDesc(
+		namespace+"_host_containers_memory_usage_bytes",
+		"Memory used by all running containers of a host.",
+		[]string{"host"}, nil,
+	)
+)
+
+// statsCollector exports the latest container stats sampled for each host
+type statsCollector struct {
+	hosts map[string]types.HostStats
+	mu    sync.RWMutex
+}
+
+var stats = &statsCollector{hosts: make(map[string]types.HostStats)}
+
+func init() {
+	Registry.MustRegister(stats)
+}
+
+// SetHostStats replaces the stats of a host; containers missing from the sample are no longer exported
+func SetHostStats(host string, hostStats types.HostStats) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.hosts[host] = hostStats
+}
+
+// RemoveHostStats stops exporting the stats of a host, e.g. while it is not connected
+func RemoveHostStats(host string) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	delete(stats.hosts, host)
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		containerCPUDesc, containerMemoryDesc, containerMemoryLimitDesc, containerNetworkRxDesc, containerNetworkTxDesc,
+		containerBlockReadDesc, containerBlockWriteDesc, containerPIDsDesc, hostCPUDesc, hostMemoryDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for host, hostStats := range c.hosts {
+		ch <- prometheus.MustNewConstMetric(hostCPUDesc, prometheus.GaugeValue, hostStats.CPUPercent, host)
+		ch <- prometheus.MustNewConstMetric(hostMemoryDesc, prometheus.GaugeValue, float64(hostStats.MemoryUsage), host)
+
+		for _, container := range hostStats.Stats {
+			ch <- prometheus.MustNewConstMetric(containerCPUDesc, prometheus.GaugeValue, container.CPUPercent, host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerMemoryDesc, prometheus.GaugeValue, float64(container.MemoryUsage), host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerMemoryLimitDesc, prometheus.GaugeValue, float64(container.MemoryLimit), host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerNetworkRxDesc, prometheus.CounterValue, float64(container.NetworkRx), host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerNetworkTxDesc, prometheus.CounterValue, float64(container.NetworkTx), host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerBlockReadDesc, prometheus.CounterValue, float64(container.BlockRead), host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerBlockWriteDesc, prometheus.CounterValue, float64(container.BlockWrite), host, container.Name)
+			ch <- prometheus.MustNewConstMetric(containerPIDsDesc, prometheus.GaugeValue, float64(container.PIDs), host, container.Name)
+		}
+	}
+}
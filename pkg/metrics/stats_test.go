@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_statsCollector(t *testing.T) {
+	SetHostStats("localhost", types.HostStats{
+		CPUPercent:  12.5,
+		MemoryUsage: 2048,
+		Stats: []types.ContainerStats{
+			{Name: "web", CPUPercent: 12.5, MemoryUsage: 2048, MemoryLimit: 4096, NetworkRx: 10, NetworkTx: 20, BlockRead: 30, BlockWrite: 40, PIDs: 3},
+		},
+	})
+	t.Cleanup(func() { RemoveHostStats("localhost") })
+
+	expected := `
+# HELP dockhook_container_cpu_percent CPU usage of a running container as shown by docker stats, 100 per core.
+# TYPE dockhook_container_cpu_percent gauge
+dockhook_container_cpu_percent{container="web",host="localhost"} 12.5
+# HELP dockhook_container_network_receive_bytes_total Bytes received by a running container on all networks.
+# TYPE dockhook_container_network_receive_bytes_total counter
+dockhook_container_network_receive_bytes_total{container="web",host="localhost"} 10
+# HELP dockhook_host_containers_memory_usage_bytes Memory used by all running containers of a host.
+# TYPE dockhook_host_containers_memory_usage_bytes gauge
+dockhook_host_containers_memory_usage_bytes{host="localhost"} 2048
+`
+	assert.NoError(t, testutil.CollectAndCompare(stats, strings.NewReader(expected),
+		"dockhook_container_cpu_percent", "dockhook_container_network_receive_bytes_total", "dockhook_host_containers_memory_usage_bytes"))
+	assert.Equal(t, 10, testutil.CollectAndCount(stats))
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+var (
+	hostConnectedDesc = prometheus.NewDesc(
+		namespace+"_host_connected",
+		"Whether DockHook receives events from the Docker host.",
+		[]string{"host"}, nil,
+	)
+	containerStateDesc = prometheus.NewDesc(
+		namespace+"_container_state",
+		"State of each container, always 1 for the current state.",
+		[]string{"host", "container", "state"}, nil,
+	)
+	containerHealthyDesc = prometheus.NewDesc(
+		namespace+"_container_healthy",
+		"Whether a container with a health check is healthy.",
+		[]string{"host", "container"}, nil,
+	)
+)
+
+// storeCollector reads container states from the container stores on every scrape
+type storeCollector struct {
+	stores map[string]*types.ContainerStore
+	mu     sync.RWMutex
+}
+
+var stores = &storeCollector{}
+
+func init() {
+	Registry.MustRegister(stores)
+}
+
+// WatchStore exports the containers and connection state of the store of a host once it is connected
+func WatchStore(host string, store *types.ContainerStore) {
+	stores.mu.Lock()
+	defer stores.mu.Unlock()
+
+	watched := make(map[string]*types.ContainerStore, len(stores.stores)+1)
+	for id, existing := range stores.stores {
+		watched[id] = existing
+	}
+	watched[host] = store
+
+	stores.stores = watched
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hostConnectedDesc
+	ch <- containerStateDesc
+	ch <- containerHealthyDesc
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for host, store := range c.stores {
+		ch <- prometheus.MustNewConstMetric(hostConnectedDesc, prometheus.GaugeValue, boolValue(store.IsConnected()), host)
+
+		for _, container := range store.Containers() {
+			ch <- prometheus.MustNewConstMetric(containerStateDesc, prometheus.GaugeValue, 1, host, container.Name, container.State)
+
+			if container.Health != "" {
+				ch <- prometheus.MustNewConstMetric(containerHealthyDesc, prometheus.GaugeValue, boolValue(container.Health == "healthy"), host, container.Name)
+			}
+		}
+	}
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
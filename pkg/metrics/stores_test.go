@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+type fakeClient struct {
+	types.Client
+	containers []types.Container
+}
+
+func (c *fakeClient) ListContainers() ([]types.Container, error) {
+	return c.containers, nil
+}
+
+func (c *fakeClient) Events(ctx context.Context, _ chan<- types.ContainerEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c *fakeClient) Host() *types.Host {
+	return &types.Host{ID: "localhost"}
+}
+
+func Test_storeCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	store := types.NewContainerStore(ctx, &fakeClient{containers: []types.Container{
+		{ID: "1234", Name: "web", State: "running", Health: "healthy"},
+		{ID: "5678", Name: "worker", State: "exited"},
+	}})
+	_, err := store.List()
+	require.NoError(t, err)
+
+	WatchStore("localhost", store)
+	t.Cleanup(func() {
+		stores.mu.Lock()
+		defer stores.mu.Unlock()
+
+		stores.stores = nil
+	})
+
+	expected := `
+# HELP dockhook_container_healthy Whether a container with a health check is healthy.
+# TYPE dockhook_container_healthy gauge
+dockhook_container_healthy{container="web",host="localhost"} 1
+# HELP dockhook_container_state State of each container, always 1 for the current state.
+# TYPE dockhook_container_state gauge
+dockhook_container_state{container="web",host="localhost",state="running"} 1
+dockhook_container_state{container="worker",host="localhost",state="exited"} 1
+# HELP dockhook_host_connected Whether DockHook receives events from the Docker host.
+# TYPE dockhook_host_connected gauge
+dockhook_host_connected{host="localhost"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(stores, strings.NewReader(expected)))
+}
+
+func Test_ObserveDockerRequest(t *testing.T) {
+	before := testutil.CollectAndCount(DockerRequestDuration)
+
+	ObserveDockerRequest("test-host", "ping", time.Now(), nil)
+
+	assert.Equal(t, before+1, testutil.CollectAndCount(DockerRequestDuration), "expected a series for the new host")
+}
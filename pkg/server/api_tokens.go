@@ -0,0 +1,131 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+const defaultAPITokenLifetime = 90 * 24 * time.Hour
+
+type createdAPIToken struct {
+	Token  user.Token `json:"token"`
+	Secret string     `json:"secret"`
+}
+
+func (h *handler) listAPITokens(w http.ResponseWriter, r *http.Request) {
+	owner, ok := tokenOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	username := owner.Username
+	if r.URL.Query().Get("all") == "true" && owner.Can(user.PermissionManage) {
+		username = ""
+	}
+
+	writeData(w, r, http.StatusOK, h.config.Authorization.Tokens.List(username))
+}
+
+func (h *handler) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	owner, ok := tokenOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Tokens take the roles of their owner from users.yml on every request, users of other providers are not there
+	if h.config.Authorization.Users == nil || h.config.Authorization.Users.Find(owner.Username) == nil {
+		writeError(w, r, myErrors.New(http.StatusForbidden, myErrors.CodeTokenOwnerNotLocal, "API tokens can only be created for users in users.yml"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	lifetime := defaultAPITokenLifetime
+	if value := r.PostFormValue("expires_in"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, "expires_in must be a positive duration"))
+			return
+		}
+
+		lifetime = parsed
+	}
+
+	actions := make([]types.ContainerAction, 0, len(r.PostForm["action"]))
+	for _, action := range r.PostForm["action"] {
+		actions = append(actions, types.ContainerAction(action))
+	}
+
+	token, secret, err := h.config.Authorization.Tokens.Issue(user.Token{
+		Name:     r.PostFormValue("name"),
+		Username: owner.Username,
+		Scope: user.TokenScope{
+			Webhooks: r.PostForm["webhook"],
+			Hosts:    r.PostForm["host"],
+			Actions:  actions,
+		},
+		Expires: time.Now().Add(lifetime),
+	})
+	result, message := auditResult(err)
+	h.audit(r, audit.Entry{Event: audit.EventTokenCreate, Target: token.ID, Result: result, Error: message})
+	if err != nil {
+		logFromRequest(r).Errorf("Error while creating API token: %v", err)
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeInvalidToken, err.Error()))
+		return
+	}
+
+	logFromRequest(r).Infof("API token %s created for user %s", token.ID, owner.Username)
+	writeData(w, r, http.StatusCreated, createdAPIToken{Token: token, Secret: secret})
+}
+
+func (h *handler) revokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	owner, ok := tokenOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID := chi.URLParam(r, "tokenID")
+
+	token := h.config.Authorization.Tokens.Find(tokenID)
+	if token == nil || (token.Username != owner.Username && !owner.Can(user.PermissionManage)) {
+		writeError(w, r, myErrors.New(http.StatusNotFound, myErrors.CodeTokenNotFound, http.StatusText(http.StatusNotFound)))
+		return
+	}
+
+	err := h.config.Authorization.Tokens.Revoke(tokenID)
+	result, message := auditResult(err)
+	h.audit(r, audit.Entry{Event: audit.EventTokenRevoke, Target: tokenID, Result: result, Error: message})
+	if err != nil {
+		logFromRequest(r).Errorf("Error while revoking API token: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, err.Error()))
+		return
+	}
+
+	logFromRequest(r).Infof("API token %s revoked by user %s", tokenID, owner.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tokenOwnerFromRequest returns the logged-in user; API tokens cannot manage other tokens
+func tokenOwnerFromRequest(w http.ResponseWriter, r *http.Request) (*user.User, bool) {
+	if user.TokenFromContext(r.Context()) != nil {
+		writeError(w, r, myErrors.New(http.StatusForbidden, myErrors.CodeAPITokenNotAllowed, "API tokens cannot manage tokens"))
+		return nil, false
+	}
+
+	owner := user.UserFromContext(r.Context())
+	if owner == nil {
+		writeError(w, r, myErrors.New(http.StatusUnauthorized, myErrors.CodeUnauthorized, http.StatusText(http.StatusUnauthorized)))
+		return nil, false
+	}
+
+	return owner, true
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func Test_createAPIToken_external_owner(t *testing.T) {
+	trusted, err := helper.ParseCIDRs([]string{"192.0.2.0/24"})
+	require.NoError(t, err)
+
+	users := &user.UsersDatabase{Users: map[string]*user.User{
+		"alice": {Username: "alice", Roles: []user.Role{user.RoleOperator}},
+	}}
+
+	h := newTestHandler("/")
+	h.config.Authorization.Provider = ProviderProxy
+	h.config.Authorization.Authorizer = user.NewForwardAuth(user.ForwardAuthConfig{TrustedProxies: trusted}, users)
+	h.config.Authorization.Users = users
+	h.config.Authorization.Sessions = nil
+
+	createToken := func(username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", strings.NewReader(url.Values{"name": {"ci"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Remote-User", username)
+
+		w := httptest.NewRecorder()
+		createRouter(h).ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := createToken("bob")
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "token_owner_not_local", body.Error.Code)
+	assert.Empty(t, h.config.Authorization.Tokens.List(""), "expected no token for users outside users.yml")
+
+	w = createToken("alice")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
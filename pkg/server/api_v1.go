@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+)
+
+const apiV1Key contextKey = "apiV1"
+
+// envelope wraps every /api/v1 response; exactly one of Data and Error is set
+type envelope struct {
+	Data      any       `json:"data,omitempty"`
+	Error     *apiError `json:"error,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiV1 marks requests of the versioned API and turns plain text errors, e.g. of the auth middlewares, into envelopes
+func (h *handler) apiV1(next http.Handler) http.Handler {
+	prefix := path.Join(h.config.Base, "api/v1") + "/"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), apiV1Key, true))
+
+		ew := &envelopeWriter{ResponseWriter: w, requestID: requestIDFromContext(r.Context())}
+		next.ServeHTTP(ew, r)
+		ew.finish()
+	})
+}
+
+func isAPIV1(r *http.Request) bool {
+	v1, _ := r.Context().Value(apiV1Key).(bool)
+
+	return v1
+}
+
+// writeData writes data as JSON, wrapped in an envelope for /api/v1
+func writeData(w http.ResponseWriter, r *http.Request, status int, data any) {
+	if !isAPIV1(r) {
+		writeJSON(w, status, data)
+		return
+	}
+
+	writeJSON(w, status, envelope{Data: data, RequestID: requestIDFromContext(r.Context())})
+}
+
+// writeError writes the error as plain text, or as an envelope with its code for /api/v1
+func writeError(w http.ResponseWriter, r *http.Request, err *myErrors.HTTPError) {
+	if !isAPIV1(r) {
+		http.Error(w, err.Error(), err.StatusCode)
+		return
+	}
+
+	writeJSON(w, err.StatusCode, envelope{
+		Error:     &apiError{Code: err.ErrorCode(), Message: err.Error()},
+		RequestID: requestIDFromContext(r.Context()),
+	})
+}
+
+// writeOK confirms a request without a result; the unversioned API answers with the text OK
+func writeOK(w http.ResponseWriter, r *http.Request) {
+	if isAPIV1(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(http.StatusText(http.StatusOK)))
+}
+
+func (h *handler) notFoundV1(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, myErrors.New(http.StatusNotFound, myErrors.CodeNotFound, http.StatusText(http.StatusNotFound)))
+}
+
+// envelopeWriter buffers plain text error responses, e.g. from http.Error, and writes them as envelopes
+type envelopeWriter struct {
+	http.ResponseWriter
+	requestID string
+	status    int
+	body      bytes.Buffer
+}
+
+func (w *envelopeWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *envelopeWriter) Write(data []byte) (int, error) {
+	if w.status != 0 {
+		return w.body.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *envelopeWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		flusher.Flush()
+	}
+}
+
+func (w *envelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *envelopeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *envelopeWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	writeJSON(w.ResponseWriter, w.status, envelope{
+		Error:     &apiError{Code: myErrors.CodeForStatus(w.status), Message: strings.TrimSpace(w.body.String())},
+		RequestID: w.requestID,
+	})
+}
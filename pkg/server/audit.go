@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+const defaultAuditLimit = 100
+
+func (h *handler) listAudit(w http.ResponseWriter, r *http.Request) {
+	if _, ok := managerFromRequest(w, r); !ok {
+		return
+	}
+
+	filter, err := auditFilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	entries, err := h.config.Audit.Query(filter)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while reading audit log: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	writeData(w, r, http.StatusOK, entries)
+}
+
+// listJobs returns the webhook calls from the audit log; users without read permission only see their own
+func (h *handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	filter.Event = audit.EventWebhook
+	if !h.authorize(r, func(u *user.User) bool { return u.Can(user.PermissionRead) }) {
+		filter.User = user.UserFromContext(r.Context()).Username
+	}
+
+	entries, err := h.config.Audit.Query(filter)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while reading audit log: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	writeData(w, r, http.StatusOK, entries)
+}
+
+// audit records an entry with the user, API token and client address of the request
+func (h *handler) audit(r *http.Request, entry audit.Entry) {
+	if h.config.Audit == nil {
+		return
+	}
+
+	if actor := user.UserFromContext(r.Context()); actor != nil {
+		entry.User = actor.Username
+	}
+
+	if token := user.TokenFromContext(r.Context()); token != nil {
+		entry.Token = token.ID
+	}
+
+	if ip := helper.ClientIP(r, h.config.TrustedProxies); ip != nil {
+		entry.IP = ip.String()
+	}
+
+	entry.RequestID = requestIDFromContext(r.Context())
+
+	if err := h.config.Audit.Record(entry); err != nil {
+		logFromRequest(r).Errorf("Error while writing audit log: %v", err)
+	}
+}
+
+func auditResult(err error) (string, string) {
+	if err != nil {
+		return audit.ResultFailure, err.Error()
+	}
+
+	return audit.ResultSuccess, ""
+}
+
+func auditFilterFromQuery(query url.Values) (audit.Filter, error) {
+	filter := audit.Filter{
+		Webhook: query.Get("webhook"),
+		User:    query.Get("user"),
+		Host:    query.Get("host"),
+		Limit:   defaultAuditLimit,
+	}
+
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time", name)
+		}
+
+		*target = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return filter, errors.New("limit must be a number, 0 returns every entry")
+		}
+
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
@@ -1,51 +1,147 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/go-chi/jwtauth/v5"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
 )
 
 func (h *handler) createToken(w http.ResponseWriter, r *http.Request) {
-	user := r.PostFormValue("username")
+	username := r.PostFormValue("username")
 	pass := r.PostFormValue("password")
 
-	if token, err := h.config.Authorization.Authorizer.CreateToken(user, pass); err == nil {
-		http.SetCookie(w, &http.Cookie{
-			Name:     "jwt",
-			Value:    token,
-			HttpOnly: true,
-			Path:     "/",
-			SameSite: http.SameSiteLaxMode,
-		})
-
-		log.Infof("Token created for user %s", user)
-		w.WriteHeader(http.StatusOK)
-
-		_, err := w.Write([]byte(http.StatusText(http.StatusOK)))
-		if err != nil {
-			log.Errorf("Error while creating token: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	lockouts := h.config.Authorization.Lockouts
+	if lockouts != nil {
+		if retryAfter := lockouts.Blocked(r, username); retryAfter > 0 {
+			user.TooManyRequests(w, retryAfter)
+			return
 		}
+	}
+
+	var token string
+	var err error
+	if authorizer, ok := h.config.Authorization.Authorizer.(SecondFactorAuthorizer); ok {
+		token, err = authorizer.CreateTokenWithCode(username, pass, r.PostFormValue("otp"))
 	} else {
-		log.Errorf("Error while creating token: %v", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		token, err = h.config.Authorization.Authorizer.CreateToken(username, pass)
+	}
+	if err != nil {
+		if lockouts != nil && errors.Is(err, user.ErrInvalidCredentials) {
+			if retryAfter := lockouts.Failed(r, username); retryAfter > 0 {
+				user.TooManyRequests(w, retryAfter)
+				return
+			}
+		}
+
+		code := myErrors.CodeInvalidCredentials
+		if errors.Is(err, user.ErrSecondFactorRequired) {
+			code = myErrors.CodeSecondFactorRequired
+		}
+
+		logFromRequest(r).Errorf("Error while creating token: %v", err)
+		writeError(w, r, myErrors.New(http.StatusUnauthorized, code, err.Error()))
+		return
+	}
+
+	if lockouts != nil {
+		lockouts.Succeeded(r, username)
+	}
+
+	h.setSessionCookie(w, r, token)
+
+	logFromRequest(r).Infof("Token created for user %s", username)
+	writeOK(w, r)
+}
+
+func (h *handler) deleteToken(w http.ResponseWriter, r *http.Request) {
+	if h.config.Authorization.Sessions != nil {
+		if token, _, err := jwtauth.FromContext(r.Context()); err == nil && token != nil {
+			if err := h.config.Authorization.Sessions.Revoke(token); err != nil {
+				logFromRequest(r).Errorf("Error while revoking token: %v", err)
+				writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+				return
+			}
+		}
+	}
+
+	http.SetCookie(w, h.config.Cookies.Expired(r, user.SessionCookieName))
+	writeOK(w, r)
+}
+
+// refreshToken replaces the session token with a new one; users from users.yml get their current roles
+func (h *handler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	token, _, err := jwtauth.FromContext(r.Context())
+	if err != nil || token == nil {
+		writeError(w, r, myErrors.New(http.StatusUnauthorized, myErrors.CodeUnauthorized, http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	current := user.UserFromContext(r.Context())
+	if h.config.Authorization.Provider == ProviderSimple && h.config.Authorization.Users != nil {
+		found := h.config.Authorization.Users.Find(current.Username)
+		if found == nil {
+			logFromRequest(r).Warnf("Session of unknown user %s was not refreshed", current.Username)
+			writeError(w, r, myErrors.New(http.StatusUnauthorized, myErrors.CodeUnauthorized, http.StatusText(http.StatusUnauthorized)))
+			return
+		}
+
+		current = found
+	}
+
+	refreshed, err := h.config.Authorization.Sessions.Refresh(token, current)
+	if errors.Is(err, user.ErrSessionTooOld) {
+		writeError(w, r, myErrors.New(http.StatusUnauthorized, myErrors.CodeSessionExpired, http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+	if err != nil {
+		logFromRequest(r).Errorf("Error while refreshing token: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	h.setSessionCookie(w, r, refreshed)
+	writeOK(w, r)
+}
+
+func (h *handler) setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	var maxAge time.Duration
+	if h.config.Authorization.Sessions != nil {
+		maxAge = h.config.Authorization.Sessions.TTL
 	}
+
+	http.SetCookie(w, h.config.Cookies.Cookie(r, user.SessionCookieName, token, maxAge))
 }
 
-func (h *handler) deleteToken(w http.ResponseWriter, _ *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		HttpOnly: true,
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Unix(0, 0),
+// authMiddleware lets API tokens through alongside the credentials of the configured provider
+func (h *handler) authMiddleware(next http.Handler) http.Handler {
+	providerHandler := h.config.Authorization.Authorizer.AuthMiddleware(next)
+	if h.tokenAuth == nil {
+		return providerHandler
+	}
+
+	tokenHandler := h.tokenAuth.AuthMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user.HasAPIToken(r) {
+			tokenHandler.ServeHTTP(w, r)
+			return
+		}
+
+		providerHandler.ServeHTTP(w, r)
 	})
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(http.StatusText(http.StatusOK))); err != nil {
-		log.Errorf("Error while deleting token: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// authorize reports whether the current user passes the check; everything is allowed without an auth provider
+func (h *handler) authorize(r *http.Request, check func(*user.User) bool) bool {
+	if h.config.Authorization.Provider == ProviderNone {
+		return true
 	}
+
+	current := user.UserFromContext(r.Context())
+
+	return current != nil && check(current)
 }
@@ -1,42 +1,228 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
 )
 
+type webhookResponse struct {
+	Webhook        string `json:"webhook"`
+	Action         string `json:"action"`
+	Host           string `json:"host"`
+	Container      string `json:"container"`
+	ContainerID    string `json:"containerId"`
+	NewContainerID string `json:"newContainerId,omitempty"`
+	ImageID        string `json:"imageId,omitempty"`
+	NewImageID     string `json:"newImageId,omitempty"`
+	// Logs holds the container output after the action when the caller asked for it
+	Logs []types.LogEntry `json:"logs,omitempty"`
+}
+
 func (h *handler) containerWebhooks(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	fail := func(webhook *types.Webhook, err *myErrors.HTTPError) {
+		observeWebhook(webhook, webhookResult(err.StatusCode), start)
+		h.auditWebhook(r, webhook, start, audit.Entry{Error: err.Error()})
+
+		if isAPIV1(r) {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(err.StatusCode)
+	}
+
+	// Callers that may not trigger the webhook get the answer for unknown webhooks, so they cannot tell which exist
+	deny := func(webhook *types.Webhook, reason string) {
+		observeWebhook(webhook, webhookResult(http.StatusForbidden), start)
+		h.auditWebhook(r, webhook, start, audit.Entry{Error: reason})
+
+		if isAPIV1(r) {
+			writeError(w, r, &myErrors.HTTPError{StatusCode: http.StatusNotFound, Code: myErrors.CodeWebhookNotFound})
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}
+
 	webhookItem, myErr := h.webhookFromRequest(r)
 	if myErr != nil {
-		w.WriteHeader(myErr.StatusCode)
+		// Unknown UUIDs are not used as label to keep the number of series bounded
+		observeWebhook(&types.Webhook{UUID: "unknown"}, webhookResult(myErr.StatusCode), start)
+		h.auditWebhook(r, &types.Webhook{UUID: chi.URLParam(r, "webhookUUID")}, start, audit.Entry{Error: http.StatusText(myErr.StatusCode)})
 
+		if isAPIV1(r) {
+			writeError(w, r, myErr)
+			return
+		}
+
+		w.WriteHeader(myErr.StatusCode)
 		if myErr.Message != "" {
-			_, _ = fmt.Fprintf(w, myErr.Message)
+			_, _ = fmt.Fprint(w, myErr.Message)
 		}
 
 		return
 	}
 
-	client, ok := h.clients[webhookItem.Host]
+	if !h.authorize(r, func(u *user.User) bool { return u.CanTrigger(webhookItem) }) {
+		logFromRequest(r).Warnf("user is not allowed to trigger webhook %s", webhookItem.UUID)
+
+		deny(webhookItem, "user is not allowed to trigger the webhook")
+		return
+	}
+
+	if token := user.TokenFromContext(r.Context()); token != nil && !token.Scope.Allows(webhookItem) {
+		logFromRequest(r).Warnf("API token %s is not allowed to trigger webhook %s", token.ID, webhookItem.UUID)
+
+		deny(webhookItem, "API token is not allowed to trigger the webhook")
+		return
+	}
+
+	logsDuration, logsErr := actionLogsDuration(r, webhookItem)
+	if logsErr != nil {
+		fail(webhookItem, &myErrors.HTTPError{StatusCode: http.StatusBadRequest, Code: myErrors.CodeBadRequest, Err: logsErr})
+		return
+	}
+
+	client, ok := h.client(webhookItem.Host)
 	if !ok {
-		log.Errorf("no client found for host %v", webhookItem.Host)
+		logFromRequest(r).Errorf("no client found for host %v", webhookItem.Host)
 
-		w.WriteHeader(http.StatusInternalServerError)
+		fail(webhookItem, &myErrors.HTTPError{StatusCode: http.StatusInternalServerError, Code: myErrors.CodeHostNotFound, Err: errors.New("unknown host")})
 		return
 	}
 
+	h.publishAction(r, EventActionStarted, webhookItem, nil, nil)
+	actionStart := time.Now()
+
 	container, err := client.ContainerActions(webhookItem)
 	if err != nil {
-		log.Error(err.Error())
+		logFromRequest(r).Error(err.Error())
 
-		w.WriteHeader(err.StatusCode)
+		h.publishAction(r, EventActionFailed, webhookItem, nil, err)
+		fail(webhookItem, err)
 		return
 	}
 
-	log.Infof("container action performed: %s; container id: %s", webhookItem.Action, container.ID)
+	logFromRequest(r).Infof("container action performed: %s; container id: %s", webhookItem.Action, container.ID)
+
+	change := containerChange(client, webhookItem, container)
+	h.publishAction(r, EventActionSucceeded, webhookItem, container, nil)
+	observeWebhook(webhookItem, webhookResult(http.StatusOK), start)
+	h.auditWebhook(r, webhookItem, start, change)
+
+	var logs []types.LogEntry
+	if logsDuration > 0 {
+		target := change.ContainerID
+		if change.NewContainerID != "" {
+			target = change.NewContainerID
+		}
+
+		logs = actionLogs(r.Context(), client, target, actionStart, logsDuration)
+	}
+
+	if isAPIV1(r) {
+		writeData(w, r, http.StatusOK, webhookResponse{
+			Webhook:        webhookItem.UUID,
+			Action:         string(webhookItem.Action),
+			Host:           webhookItem.Host,
+			Container:      change.Container,
+			ContainerID:    change.ContainerID,
+			NewContainerID: change.NewContainerID,
+			ImageID:        change.ImageID,
+			NewImageID:     change.NewImageID,
+			Logs:           logs,
+		})
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	_, _ = fmt.Fprintln(w, "OK")
+	for _, entry := range logs {
+		_, _ = fmt.Fprintf(w, "%s %s %s\n", entry.Time.Format(time.RFC3339Nano), entry.Stream, entry.Message)
+	}
+}
+
+// auditWebhook records a webhook call; entries without an error are successful
+func (h *handler) auditWebhook(r *http.Request, webhook *types.Webhook, start time.Time, entry audit.Entry) {
+	entry.Event = audit.EventWebhook
+	entry.Webhook = webhook.UUID
+	entry.Action = string(webhook.Action)
+	entry.Host = webhook.Host
+	entry.DurationMs = time.Since(start).Milliseconds()
+
+	entry.Result = audit.ResultSuccess
+	if entry.Error != "" {
+		entry.Result = audit.ResultFailure
+	}
+
+	if entry.Container == "" {
+		entry.Container = webhook.ContainerName
+	}
+
+	h.audit(r, entry)
+}
+
+// containerChange describes the container before the action and, after a pull, the recreated container
+func containerChange(client types.Client, webhook *types.Webhook, container *types.Container) audit.Entry {
+	entry := audit.Entry{
+		Container:   container.Name,
+		ContainerID: container.ID,
+		Image:       container.Image,
+		ImageID:     container.ImageID,
+	}
+
+	if webhook.Action != types.Action.PULL {
+		return entry
+	}
+
+	containers, err := client.ListContainers()
+	if err != nil {
+		log.Warnf("Could not find the recreated container %s: %v", container.Name, err)
+		return entry
+	}
+
+	for _, c := range containers {
+		if c.Name == container.Name {
+			entry.NewContainerID = c.ID
+			entry.NewImageID = c.ImageID
+			break
+		}
+	}
+
+	return entry
+}
+
+func observeWebhook(webhook *types.Webhook, result string, start time.Time) {
+	labels := []string{webhook.UUID, string(webhook.Action), webhook.Host, result}
+
+	metrics.WebhookCalls.WithLabelValues(labels...).Inc()
+	metrics.WebhookDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
+
+func webhookResult(status int) string {
+	switch status {
+	case http.StatusOK:
+		return "success"
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	default:
+		return "error"
+	}
 }
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func Test_containerWebhooks_hidden(t *testing.T) {
+	h := newScopedHandler(t)
+	h.config.Authorization.Users.Users["deployer"] = &user.User{Username: "deployer", Roles: []user.Role{user.RoleOperator}}
+
+	readToken := issueReadToken(t, h, user.TokenScope{})
+	_, hostToken, err := h.config.Authorization.Tokens.Issue(user.Token{Name: "ci", Username: "deployer", Scope: user.TokenScope{Hosts: []string{"h2"}}, Expires: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	trigger := func(token string, webhookUUID string) apiError {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/"+webhookUUID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		createRouter(h).ServeHTTP(w, req)
+		require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+		var body envelope
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.NotNil(t, body.Error)
+
+		return *body.Error
+	}
+
+	unknown := trigger(readToken, "00000000-0000-4000-8000-000000000000")
+	assert.Equal(t, "webhook_not_found", unknown.Code)
+
+	assert.Equal(t, unknown, trigger(readToken, "4f8a2c1e-7d3b-4b6a-9c5e-2a1f0e9d8c7b"), "expected webhooks the user may not trigger to look unknown")
+	assert.Equal(t, unknown, trigger(hostToken, "4f8a2c1e-7d3b-4b6a-9c5e-2a1f0e9d8c7b"), "expected webhooks outside the token scope to look unknown")
+}
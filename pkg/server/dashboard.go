@@ -0,0 +1,76 @@
+package server
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+//go:embed web
+var dashboardFiles embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(dashboardFiles, "web/index.html"))
+
+type meResponse struct {
+	Username    string            `json:"username,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Email       string            `json:"email,omitempty"`
+	Roles       []user.Role       `json:"roles,omitempty"`
+	Permissions []user.Permission `json:"permissions"`
+}
+
+// dashboard serves the single-page UI; it talks to the API with the credentials the browser already has
+func (h *handler) dashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	err := dashboardTemplate.Execute(w, map[string]string{
+		"Base":     path.Join(h.config.Base, "/"),
+		"Assets":   path.Join(h.config.Base, "assets"),
+		"Provider": string(h.config.Authorization.Provider),
+		"Version":  h.config.Version,
+	})
+	if err != nil {
+		logFromRequest(r).Errorf("Error while rendering dashboard: %v", err)
+	}
+}
+
+func (h *handler) dashboardAssets() http.Handler {
+	assets, err := fs.Sub(dashboardFiles, "web/assets")
+	if err != nil {
+		log.Panicf("Could not load dashboard assets: %v", err)
+	}
+
+	return http.StripPrefix(path.Join(h.config.Base, "assets")+"/", http.FileServer(http.FS(assets)))
+}
+
+// me describes the current user and the permissions the dashboard should offer
+func (h *handler) me(w http.ResponseWriter, r *http.Request) {
+	if h.config.Authorization.Provider == ProviderNone {
+		writeData(w, r, http.StatusOK, meResponse{Permissions: user.Permissions})
+		return
+	}
+
+	current := user.UserFromContext(r.Context())
+
+	permissions := make([]user.Permission, 0, len(user.Permissions))
+	for _, permission := range user.Permissions {
+		if current.Can(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	writeData(w, r, http.StatusOK, meResponse{
+		Username:    current.Username,
+		Name:        current.Name,
+		Email:       current.Email,
+		Roles:       current.Roles,
+		Permissions: permissions,
+	})
+}
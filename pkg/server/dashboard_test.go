@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_dashboard(t *testing.T) {
+	router := createRouter(newTestHandler("/dockhook"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dockhook/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<meta name="dockhook-base" content="/dockhook">`)
+	assert.Contains(t, w.Body.String(), `<meta name="dockhook-provider" content="simple">`)
+	assert.Contains(t, w.Body.String(), `src="/dockhook/assets/app.js"`)
+	assert.NotContains(t, w.Body.String(), "<script>", "expected no inline scripts, the CSP blocks them")
+
+	for _, asset := range []string{"app.js", "style.css"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dockhook/assets/"+asset, nil))
+		assert.Equal(t, http.StatusOK, w.Code, asset)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dockhook/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dockhook/api/v1/hosts", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "expected the data behind the dashboard to require authentication")
+}
@@ -2,18 +2,10 @@ package server
 
 import (
 	"net/http"
-
-	log "github.com/sirupsen/logrus"
 )
 
 func (h *handler) error(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-
-	log.Debugln("unknown request")
-	log.Debugf("RemoteAddr: %s\n", r.RemoteAddr)
-	log.Debugf("URL: %s\n", r.URL)
-	log.Debugf("Method: %s\n", r.Method)
-	log.Debugf("Header: %+v\n", r.Header)
+	logFromRequest(r).Debugf("unknown request: %s %s", r.Method, r.URL.Path)
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 }
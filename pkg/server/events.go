@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+const (
+	// Events of DockHook's own container actions
+	EventActionStarted   = "action.started"
+	EventActionSucceeded = "action.succeeded"
+	EventActionFailed    = "action.failed"
+)
+
+const (
+	eventBufferSize   = 64
+	eventKeepAlive    = 30 * time.Second
+	eventWriteTimeout = 10 * time.Second
+)
+
+// streamEvent is a Docker container event or an action performed by a webhook
+type streamEvent struct {
+	Type          string            `json:"type"`
+	Time          time.Time         `json:"time"`
+	Host          string            `json:"host,omitempty"`
+	ContainerID   string            `json:"containerId,omitempty"`
+	ContainerName string            `json:"containerName,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	Webhook       string            `json:"webhook,omitempty"`
+	Action        string            `json:"action,omitempty"`
+	User          string            `json:"user,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	RequestID     string            `json:"requestId,omitempty"`
+}
+
+// eventHub fans out events to the open streams; a stream that falls behind loses events instead of blocking the stores
+type eventHub struct {
+	mu          sync.RWMutex
+	subscribers map[chan streamEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan streamEvent]struct{})}
+}
+
+func (hub *eventHub) subscribe() chan streamEvent {
+	events := make(chan streamEvent, eventBufferSize)
+
+	hub.mu.Lock()
+	hub.subscribers[events] = struct{}{}
+	hub.mu.Unlock()
+
+	return events
+}
+
+func (hub *eventHub) unsubscribe(events chan streamEvent) {
+	hub.mu.Lock()
+	delete(hub.subscribers, events)
+	hub.mu.Unlock()
+}
+
+func (hub *eventHub) publish(event streamEvent) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	for events := range hub.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Warnf("Dropped %s event for a slow event stream", event.Type)
+		}
+	}
+}
+
+// watch forwards the Docker events of a store until ctx is done
+func (hub *eventHub) watch(ctx context.Context, host string, store *types.ContainerStore) {
+	events := make(chan types.ContainerEvent, eventBufferSize)
+	store.Subscribe(ctx, events)
+
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				hub.publish(dockerEvent(host, event))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func dockerEvent(host string, event types.ContainerEvent) streamEvent {
+	if event.Host != "" {
+		host = event.Host
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	return streamEvent{
+		Type:          event.Name,
+		Time:          event.Time.UTC(),
+		Host:          host,
+		ContainerID:   event.ActorID,
+		ContainerName: event.Attributes["name"],
+		Image:         event.Attributes["image"],
+		Attributes:    event.Attributes,
+	}
+}
+
+// publishAction announces a webhook action; labels of the container are added as attributes so that label filters apply
+func (h *handler) publishAction(r *http.Request, eventType string, webhook *types.Webhook, container *types.Container, err error) {
+	event := streamEvent{
+		Type:          eventType,
+		Time:          time.Now().UTC(),
+		Host:          webhook.Host,
+		ContainerID:   webhook.ContainerId,
+		ContainerName: webhook.ContainerName,
+		Webhook:       webhook.UUID,
+		Action:        string(webhook.Action),
+		RequestID:     requestIDFromContext(r.Context()),
+	}
+
+	if container == nil {
+		container = h.findContainer(webhook.Host, webhook.ContainerName)
+	}
+
+	if container != nil {
+		event.ContainerID = container.ID
+		event.Image = container.Image
+		event.Attributes = container.Labels
+	}
+
+	if current := user.UserFromContext(r.Context()); current != nil {
+		event.User = current.Username
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	h.events.publish(event)
+}
+
+func (h *handler) findContainer(host string, name string) *types.Container {
+	store, ok := h.store(host)
+	if !ok {
+		return nil
+	}
+
+	for _, container := range store.Containers() {
+		if container.Name == name {
+			return &container
+		}
+	}
+
+	return nil
+}
+
+// eventFilter selects events by host, container ID prefix or name, attributes and type; values of a field are alternatives
+type eventFilter struct {
+	Hosts      []string
+	Containers []string
+	Labels     []string
+	Types      []string
+}
+
+func eventFilterFromQuery(query url.Values) eventFilter {
+	return eventFilter{
+		Hosts:      query["host"],
+		Containers: query["container"],
+		Labels:     query["label"],
+		Types:      query["type"],
+	}
+}
+
+func (f eventFilter) matches(event streamEvent) bool {
+	return matchesAny(f.Hosts, func(host string) bool { return host == event.Host }) &&
+		matchesAny(f.Containers, func(container string) bool {
+			return container == event.ContainerName || (event.ContainerID != "" &&
+				(strings.HasPrefix(container, event.ContainerID) || strings.HasPrefix(event.ContainerID, container)))
+		}) &&
+		matchesAll(f.Labels, func(label string) bool { return hasLabel(event.Attributes, label) }) &&
+		// "action" selects every action event
+		matchesAny(f.Types, func(eventType string) bool {
+			return eventType == event.Type || strings.HasPrefix(event.Type, eventType+".")
+		})
+}
+
+func matchesAny(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesAll(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if !match(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// streamEvents sends the events as Server-Sent Events until the client disconnects
+func (h *handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	filter := eventFilterFromQuery(r.URL.Query())
+	controller := http.NewResponseController(w)
+
+	events := h.events.subscribe()
+	defer h.events.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := controller.Flush(); err != nil {
+		logFromRequest(r).Errorf("Event stream does not support flushing: %v", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if !filter.matches(event) || !scope.allowsEvent(event) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				logFromRequest(r).Errorf("Error while encoding event: %v", err)
+				continue
+			}
+
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamEventsWebSocket sends every event as a JSON text message; messages from the client are ignored
+func (h *handler) streamEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	filter := eventFilterFromQuery(r.URL.Query())
+	upgrader := websocket.Upgrader{CheckOrigin: user.CheckWebSocketOrigin(h.config.TrustedOrigins)}
+
+	events := h.events.subscribe()
+	defer h.events.unsubscribe(events)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logFromRequest(r).Debugf("WebSocket handshake failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		conn.SetReadLimit(512)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case event := <-events:
+			if !filter.matches(event) || !scope.allowsEvent(event) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				logFromRequest(r).Errorf("Error while encoding event: %v", err)
+				continue
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_eventFilter(t *testing.T) {
+	event := dockerEvent("h1", types.ContainerEvent{
+		ActorID:    "0123456789ab",
+		Name:       "die",
+		Attributes: map[string]string{"name": "web", "image": "nginx", "com.docker.compose.project": "shop"},
+	})
+	action := streamEvent{Type: EventActionFailed, Host: "h2", ContainerName: "db"}
+
+	tests := []struct {
+		name     string
+		filter   eventFilter
+		event    streamEvent
+		expected bool
+	}{
+		{"no filter", eventFilter{}, event, true},
+		{"host", eventFilter{Hosts: []string{"h2", "h1"}}, event, true},
+		{"other host", eventFilter{Hosts: []string{"h2"}}, event, false},
+		{"container name", eventFilter{Containers: []string{"web"}}, event, true},
+		{"container ID prefix", eventFilter{Containers: []string{"0123"}}, event, true},
+		{"full container ID", eventFilter{Containers: []string{"0123456789abcdef"}}, event, true},
+		{"other container", eventFilter{Containers: []string{"db"}}, event, false},
+		{"label", eventFilter{Labels: []string{"com.docker.compose.project=shop"}}, event, true},
+		{"label key", eventFilter{Labels: []string{"com.docker.compose.project"}}, event, true},
+		{"every label", eventFilter{Labels: []string{"com.docker.compose.project", "tier=web"}}, event, false},
+		{"type", eventFilter{Types: []string{"start", "die"}}, event, true},
+		{"action types", eventFilter{Types: []string{"action"}}, action, true},
+		{"action type", eventFilter{Types: []string{EventActionSucceeded}}, action, false},
+		{"docker type", eventFilter{Types: []string{"action"}}, event, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.filter.matches(test.event))
+		})
+	}
+}
+
+func newEventsServer(t *testing.T) (*handler, *httptest.Server) {
+	h := newTestHandler("/")
+	h.config.Authorization.Provider = ProviderNone
+	h.config.TrustedOrigins = []string{"https://admin.example.org"}
+
+	server := httptest.NewServer(createRouter(h))
+	t.Cleanup(server.Close)
+
+	return h, server
+}
+
+func Test_streamEvents(t *testing.T) {
+	h, server := newEventsServer(t)
+
+	response, err := http.Get(server.URL + "/api/v1/events?type=action&host=h1")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	h.events.publish(streamEvent{Type: "start", Host: "h1"})
+	h.events.publish(streamEvent{Type: EventActionStarted, Host: "h2"})
+	h.events.publish(streamEvent{Type: EventActionStarted, Host: "h1", Webhook: "w1"})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				lines <- data
+			}
+		}
+	}()
+
+	select {
+	case data := <-lines:
+		var event streamEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		assert.Equal(t, EventActionStarted, event.Type)
+		assert.Equal(t, "w1", event.Webhook, "expected only the event that matches the filter")
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+	}
+}
+
+func Test_streamEventsWebSocket(t *testing.T) {
+	h, server := newEventsServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/events/ws?container=web"
+
+	_, response, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode, "expected foreign origins to be rejected")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://admin.example.org"}})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	h.events.publish(streamEvent{Type: "start", ContainerName: "db"})
+	h.events.publish(streamEvent{Type: "start", ContainerName: "web"})
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var event streamEvent
+	require.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, "web", event.ContainerName)
+}
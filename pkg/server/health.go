@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Readiness string
+
+const (
+	// ReadyAllHosts is ready when every Docker host is reachable
+	ReadyAllHosts Readiness = "all"
+	// ReadyAnyHost is ready when at least one Docker host is reachable
+	ReadyAnyHost Readiness = "any"
+)
+
+var ValidReadiness = map[string]bool{
+	string(ReadyAllHosts): true,
+	string(ReadyAnyHost):  true,
+}
+
+const readyTimeout = 5 * time.Second
+
+// readyStatus is all that anonymous callers learn about readiness
+type readyStatus struct {
+	Status string `json:"status"`
+}
+
+type readyResponse struct {
+	Status  string       `json:"status"`
+	Mode    Readiness    `json:"mode"`
+	Hosts   []hostReady  `json:"hosts"`
+	Storage storageReady `json:"storage"`
+}
+
+type hostReady struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Ready      bool   `json:"ready"`
+	Ping       bool   `json:"ping"`
+	APIVersion string `json:"apiVersion,omitempty"`
+	Events     bool   `json:"events"`
+	Error      string `json:"error,omitempty"`
+}
+
+type storageReady struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// healthz tells that the server is running without checking its dependencies
+func (h *handler) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz checks every Docker host and the storage; the response is 503 until enough hosts are ready.
+// It runs without credentials, so the details of the hosts are left out.
+func (h *handler) readyz(w http.ResponseWriter, r *http.Request) {
+	status, response := h.checkReady(r.Context())
+	writeJSON(w, status, readyStatus{Status: response.Status})
+}
+
+// readyzDetails tells readers why the server is not ready, limited to the hosts an API token may read
+func (h *handler) readyzDetails(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	status, response := h.checkReady(r.Context())
+
+	hosts := make([]hostReady, 0, len(response.Hosts))
+	for _, host := range response.Hosts {
+		if scope.allowsHost(host.ID) {
+			hosts = append(hosts, host)
+		}
+	}
+	response.Hosts = hosts
+
+	writeData(w, r, status, response)
+}
+
+func (h *handler) checkReady(ctx context.Context) (int, readyResponse) {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	response := readyResponse{
+		Mode:    h.readiness(),
+		Hosts:   h.checkHosts(ctx),
+		Storage: h.checkStorage(),
+	}
+
+	ready := 0
+	for _, host := range response.Hosts {
+		if host.Ready {
+			ready++
+		}
+	}
+
+	hostsReady := ready == len(response.Hosts)
+	if response.Mode == ReadyAnyHost {
+		hostsReady = ready > 0
+	}
+
+	status := http.StatusOK
+	response.Status = "ready"
+	if !hostsReady || !response.Storage.Ready {
+		status = http.StatusServiceUnavailable
+		response.Status = "not_ready"
+	}
+
+	return status, response
+}
+
+func (h *handler) readiness() Readiness {
+	if h.config.Readiness == "" {
+		return ReadyAllHosts
+	}
+
+	return h.config.Readiness
+}
+
+// checkHosts pings every host at once so that one slow host does not delay the others
+func (h *handler) checkHosts(ctx context.Context) []hostReady {
+	clients, stores := h.hosts()
+	pending := h.pendingHosts()
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		hosts = make([]hostReady, 0, len(clients)+len(pending))
+	)
+
+	for _, host := range pending {
+		hosts = append(hosts, hostReady{ID: host.Host.ID, Name: host.Host.Name, Error: host.State.LastError})
+	}
+
+	for id, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			host := hostReady{ID: id, Name: client.Host().Name}
+			if store, ok := stores[id]; ok {
+				host.Events = store.IsConnected()
+			}
+
+			ping, err := client.Ping(ctx)
+			if err != nil {
+				host.Error = err.Error()
+			} else {
+				host.Ping = true
+				host.APIVersion = ping.APIVersion
+			}
+
+			host.Ready = host.Ping && host.Events
+			if host.Ping && !host.Events {
+				host.Error = "not receiving Docker events"
+			}
+
+			mu.Lock()
+			hosts = append(hosts, host)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].ID < hosts[j].ID
+	})
+
+	return hosts
+}
+
+// checkStorage reads the webhooks and makes sure the other databases can be opened; missing files are created later
+func (h *handler) checkStorage() storageReady {
+	if _, err := readWebhooks(); err != nil {
+		return storageReady{Error: err.Error()}
+	}
+
+	paths := make([]string, 0)
+	if h.config.Authorization.Users != nil {
+		paths = append(paths, h.config.Authorization.Users.Path)
+	}
+	if h.config.Authorization.Tokens != nil {
+		paths = append(paths, h.config.Authorization.Tokens.Path)
+	}
+	if h.config.Authorization.Lockouts != nil {
+		paths = append(paths, h.config.Authorization.Lockouts.Path)
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return storageReady{Error: err.Error()}
+		}
+		_ = file.Close()
+	}
+
+	return storageReady{Ready: true}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func getReady(t *testing.T, h *handler, expectedStatus int) readyResponse {
+	w := httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, expectedStatus, w.Code, w.Body.String())
+
+	response := getData[readyResponse](t, h, "/api/v1/readyz", expectedStatus)
+
+	var status map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, map[string]any{"status": response.Status}, status, "expected anonymous callers to only get the status")
+
+	return response
+}
+
+func Test_healthz(t *testing.T) {
+	h := newInventoryHandler(t)
+	h.clients["h1"].(*fakeClient).pingErr = errors.New("connection refused")
+
+	w := httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "liveness must not depend on Docker")
+}
+
+func Test_readyz(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	response := getReady(t, h, http.StatusOK)
+	assert.Equal(t, "ready", response.Status)
+	assert.Equal(t, ReadyAllHosts, response.Mode)
+	assert.True(t, response.Storage.Ready)
+	assert.Equal(t, []hostReady{{ID: "h1", Name: "docker-1", Ready: true, Ping: true, APIVersion: "1.46", Events: true}}, response.Hosts)
+}
+
+func Test_readyz_modes(t *testing.T) {
+	h := newInventoryHandler(t)
+	h.clients["h2"] = &fakeClient{host: &types.Host{ID: "h2", Name: "docker-2"}, pingErr: errors.New("connection refused")}
+
+	response := getReady(t, h, http.StatusServiceUnavailable)
+	assert.Equal(t, "not_ready", response.Status)
+	require.Len(t, response.Hosts, 2)
+	assert.Equal(t, hostReady{ID: "h2", Name: "docker-2", Error: "connection refused"}, response.Hosts[1])
+
+	h.config.Readiness = ReadyAnyHost
+	getReady(t, h, http.StatusOK)
+
+	h.clients["h1"].(*fakeClient).pingErr = errors.New("timeout")
+	getReady(t, h, http.StatusServiceUnavailable)
+}
+
+func Test_readyz_storage(t *testing.T) {
+	h := newInventoryHandler(t)
+	h.config.Authorization.Users = &user.UsersDatabase{Path: "data/users.yml"}
+	getReady(t, h, http.StatusOK)
+
+	require.NoError(t, os.WriteFile("data/webhooks.yml", []byte("webhooks: ["), 0600))
+	response := getReady(t, h, http.StatusServiceUnavailable)
+	assert.False(t, response.Storage.Ready)
+	assert.NotEmpty(t, response.Storage.Error)
+}
+
+func Test_readyz_without_credentials(t *testing.T) {
+	h := newInventoryHandler(t)
+	h.config.Authorization = Authorization{Provider: ProviderBasic, Authorizer: user.NewBasicAuth(&user.UsersDatabase{}, nil)}
+
+	for _, target := range []string{"/readyz", "/healthcheck"} {
+		w := httptest.NewRecorder()
+		createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status": "ready"}`, w.Body.String(), "expected no host details without credentials")
+	}
+
+	for _, target := range []string{"/api/v1/hosts", "/api/v1/readyz"} {
+		w := httptest.NewRecorder()
+		createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+}
+
+func Test_readyzDetails_scope(t *testing.T) {
+	h := newScopedHandler(t)
+	token := issueReadToken(t, h, user.TokenScope{Hosts: []string{"h2"}})
+
+	response := getWithToken[readyResponse](t, h, token, "/api/v1/readyz", http.StatusOK)
+	require.Len(t, response.Hosts, 1)
+	assert.Equal(t, "h2", response.Hosts[0].ID, "expected hosts outside the token scope to be left out")
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+
+	"github.com/kekaadrenalin/dockhook/pkg/docker"
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+// addHost starts the store of a connected host and feeds its events and containers to the streams and metrics
+func (h *handler) addHost(ctx context.Context, id string, client types.Client) {
+	store := types.NewContainerStore(ctx, client)
+
+	h.hostsMu.Lock()
+	h.clients[id] = client
+	h.stores[id] = store
+	h.hostsMu.Unlock()
+
+	h.events.watch(ctx, id, store)
+
+	if h.config.Metrics.Enabled() {
+		metrics.WatchStore(id, store)
+	}
+}
+
+func (h *handler) client(id string) (types.Client, bool) {
+	h.hostsMu.RLock()
+	defer h.hostsMu.RUnlock()
+
+	client, ok := h.clients[id]
+
+	return client, ok
+}
+
+func (h *handler) store(id string) (*types.ContainerStore, bool) {
+	h.hostsMu.RLock()
+	defer h.hostsMu.RUnlock()
+
+	store, ok := h.stores[id]
+
+	return store, ok
+}
+
+// hosts returns copies of the clients and stores that are safe to range over
+func (h *handler) hosts() (map[string]types.Client, map[string]*types.ContainerStore) {
+	h.hostsMu.RLock()
+	defer h.hostsMu.RUnlock()
+
+	clients := make(map[string]types.Client, len(h.clients))
+	for id, client := range h.clients {
+		clients[id] = client
+	}
+
+	stores := make(map[string]*types.ContainerStore, len(h.stores))
+	for id, store := range h.stores {
+		stores[id] = store
+	}
+
+	return clients, stores
+}
+
+// pendingHosts returns the remote hosts that have not been reachable since the start
+func (h *handler) pendingHosts() []docker.PendingHost {
+	if h.config.Supervisor == nil {
+		return nil
+	}
+
+	return h.config.Supervisor.Pending()
+}
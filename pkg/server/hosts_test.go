@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_addHost(t *testing.T) {
+	h := newInventoryHandler(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h.addHost(ctx, "h2", &fakeClient{host: &types.Host{ID: "h2", Name: "docker-2"}, containers: []types.Container{
+		{ID: "cafebabe0000", Name: "db", State: "running", Host: "h2"},
+	}})
+
+	assert.Eventually(t, func() bool {
+		store, ok := h.store("h2")
+		return ok && store.IsConnected()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	hosts := getData[[]hostResponse](t, h, "/api/v1/hosts", http.StatusOK)
+	require.Len(t, hosts, 2)
+	assert.Equal(t, "docker-2", hosts[1].Name)
+	assert.True(t, hosts[1].Connection.Connected)
+	assert.False(t, hosts[1].Connection.Since.IsZero())
+
+	containers := getData[[]types.Container](t, h, "/api/v1/containers?host=h2", http.StatusOK)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "db", containers[0].Name)
+
+	getReady(t, h, http.StatusOK)
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+type hostResponse struct {
+	*types.Host
+	Connected  bool                  `json:"connected"`
+	Connection types.ConnectionState `json:"connection"`
+	Swarm      hostSwarm             `json:"swarm"`
+}
+
+type hostSwarm struct {
+	Enabled          bool   `json:"enabled"`
+	NodeState        string `json:"nodeState,omitempty"`
+	NodeID           string `json:"nodeId,omitempty"`
+	ControlAvailable bool   `json:"controlAvailable"`
+}
+
+type containerResponse struct {
+	types.Container
+	Webhooks []webhookSummary `json:"webhooks"`
+}
+
+func (h *handler) listHosts(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	clients, stores := h.hosts()
+	pending := h.pendingHosts()
+
+	hosts := make([]hostResponse, 0, len(clients)+len(pending))
+	for id, client := range clients {
+		if !scope.allowsHost(id) {
+			continue
+		}
+
+		var connection types.ConnectionState
+		if store, ok := stores[id]; ok {
+			connection = store.State()
+		}
+		swarm := client.SystemInfo().Swarm
+
+		hosts = append(hosts, hostResponse{
+			Host:       client.Host(),
+			Connected:  connection.Connected,
+			Connection: connection,
+			Swarm: hostSwarm{
+				Enabled:          client.IsSwarmMode(),
+				NodeState:        string(swarm.LocalNodeState),
+				NodeID:           swarm.NodeID,
+				ControlAvailable: swarm.ControlAvailable,
+			},
+		})
+	}
+
+	for _, host := range pending {
+		if !scope.allowsHost(host.Host.ID) {
+			continue
+		}
+
+		hosts = append(hosts, hostResponse{Host: &host.Host, Connection: host.State})
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Name < hosts[j].Name
+	})
+
+	writeData(w, r, http.StatusOK, hosts)
+}
+
+// listContainers returns the containers known to the stores without waiting for hosts that are not connected
+func (h *handler) listContainers(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	filter := containerFilterFromQuery(r.URL.Query())
+
+	containers := make([]types.Container, 0)
+	_, stores := h.hosts()
+	for id, store := range stores {
+		for _, container := range store.Containers() {
+			if container.Host == "" {
+				container.Host = id
+			}
+
+			if filter.matches(container) && scope.allowsContainer(container.Host, container.ID, container.Name) {
+				containers = append(containers, container)
+			}
+		}
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		if containers[i].Host != containers[j].Host {
+			return containers[i].Host < containers[j].Host
+		}
+
+		return containers[i].Name < containers[j].Name
+	})
+
+	writeData(w, r, http.StatusOK, containers)
+}
+
+// getContainer returns a container by ID, ID prefix or name, with the webhooks that target it
+func (h *handler) getContainer(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	container, myErr := h.containerFromRequest(r, scope)
+	if myErr != nil {
+		writeError(w, r, myErr)
+		return
+	}
+
+	webhooks, err := h.visibleWebhooks(r)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while reading webhooks: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	targeting := make([]webhookSummary, 0)
+	for _, webhook := range webhooks {
+		if webhook.Host == container.Host && (webhook.ContainerName == container.Name || sameContainerID(webhook.ContainerID, container.ID)) {
+			targeting = append(targeting, webhook)
+		}
+	}
+
+	writeData(w, r, http.StatusOK, containerResponse{Container: *container, Webhooks: targeting})
+}
+
+// containerFromRequest finds the container of the URL; API tokens get a 403 for hosts and containers outside their scope
+func (h *handler) containerFromRequest(r *http.Request, scope readScope) (*types.Container, *myErrors.HTTPError) {
+	host := chi.URLParam(r, "host")
+	id := chi.URLParam(r, "containerID")
+
+	if !scope.allowsHost(host) {
+		return nil, errTokenNotAllowed()
+	}
+
+	store, ok := h.store(host)
+	if !ok {
+		return nil, myErrors.New(http.StatusNotFound, myErrors.CodeHostNotFound, "unknown host")
+	}
+
+	for _, container := range store.Containers() {
+		if container.Name == id || sameContainerID(id, container.ID) {
+			if container.Host == "" {
+				container.Host = host
+			}
+
+			if !scope.allowsContainer(host, container.ID, container.Name) {
+				return nil, errTokenNotAllowed()
+			}
+
+			return &container, nil
+		}
+	}
+
+	return nil, myErrors.New(http.StatusNotFound, myErrors.CodeContainerNotFound, "unknown container")
+}
+
+// sameContainerID compares IDs that may be shortened to 12 characters
+func sameContainerID(a string, b string) bool {
+	if len(a) < 12 || len(b) < 12 {
+		return a != "" && a == b
+	}
+
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// containerFilter selects containers; values of a field are alternatives and every label must match
+type containerFilter struct {
+	Hosts  []string
+	States []string
+	Health []string
+	Names  []string
+	Images []string
+	Labels []string
+}
+
+func containerFilterFromQuery(query url.Values) containerFilter {
+	return containerFilter{
+		Hosts:  query["host"],
+		States: query["state"],
+		Health: query["health"],
+		Names:  query["name"],
+		Images: query["image"],
+		Labels: query["label"],
+	}
+}
+
+func (f containerFilter) matches(container types.Container) bool {
+	return matchesAny(f.Hosts, func(host string) bool { return host == container.Host }) &&
+		matchesAny(f.States, func(state string) bool { return state == container.State }) &&
+		matchesAny(f.Health, func(health string) bool { return health == container.Health }) &&
+		matchesAny(f.Names, func(name string) bool { return strings.Contains(container.Name, name) }) &&
+		matchesAny(f.Images, func(image string) bool { return strings.Contains(container.Image, image) }) &&
+		matchesAll(f.Labels, func(label string) bool { return hasLabel(container.Labels, label) })
+}
+
+// hasLabel reports whether labels contain a key, or a key with a value when label is key=value
+func hasLabel(labels map[string]string, label string) bool {
+	key, value, withValue := strings.Cut(label, "=")
+	actual, ok := labels[key]
+
+	return ok && (!withValue || actual == value)
+}
+
+// readerFromRequest rejects users that may not view hosts, containers and webhooks and returns the scope of API tokens
+func (h *handler) readerFromRequest(w http.ResponseWriter, r *http.Request) (readScope, bool) {
+	if !h.authorize(r, func(u *user.User) bool { return u.Can(user.PermissionRead) }) {
+		writeError(w, r, myErrors.New(http.StatusForbidden, myErrors.CodeForbidden, http.StatusText(http.StatusForbidden)))
+		return readScope{}, false
+	}
+
+	scope, err := h.readScopeFromRequest(r)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while reading webhooks: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return readScope{}, false
+	}
+
+	return scope, true
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+type fakeClient struct {
+	types.Client
+	host       *types.Host
+	containers []types.Container
+	logs       []byte
+	logOptions types.LogOptions
+	pingErr    error
+}
+
+func (c *fakeClient) Ping(context.Context) (dockerTypes.Ping, error) {
+	return dockerTypes.Ping{APIVersion: "1.46"}, c.pingErr
+}
+
+func (c *fakeClient) FindContainerByID(id string) (types.Container, error) {
+	for _, container := range c.containers {
+		if container.ID == id {
+			return container, nil
+		}
+	}
+
+	return types.Container{}, errors.New("not found")
+}
+
+func (c *fakeClient) ContainerLogsWithOptions(_ context.Context, _ string, options types.LogOptions) (io.ReadCloser, error) {
+	c.logOptions = options
+	return io.NopCloser(bytes.NewReader(c.logs)), nil
+}
+
+// ContainerStats sends the same sample for every container, a stream then waits for ctx
+func (c *fakeClient) ContainerStats(ctx context.Context, id string, stream bool, stats chan<- types.ContainerStats) error {
+	select {
+	case stats <- types.ContainerStats{ID: id, Host: c.host.ID, CPUPercent: 25, MemoryUsage: 1 << 30, MemoryLimit: 2 << 30, MemoryPercent: 50}:
+	case <-ctx.Done():
+		return nil
+	}
+
+	if stream {
+		<-ctx.Done()
+	}
+
+	return nil
+}
+
+func (c *fakeClient) ListContainers() ([]types.Container, error) {
+	return c.containers, nil
+}
+
+func (c *fakeClient) Events(ctx context.Context, _ chan<- types.ContainerEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c *fakeClient) Host() *types.Host {
+	return c.host
+}
+
+func (c *fakeClient) IsSwarmMode() bool {
+	return false
+}
+
+func (c *fakeClient) SystemInfo() system.Info {
+	return system.Info{Swarm: swarm.Info{LocalNodeState: swarm.LocalNodeStateInactive}}
+}
+
+// newInventoryHandler serves one host with two containers and a webhook for the first one
+func newInventoryHandler(t *testing.T) *handler {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "data"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data", "webhooks.yml"), []byte(`webhooks:
+  4f8a2c1e-7d3b-4b6a-9c5e-2a1f0e9d8c7b:
+    containerId: 0123456789ab
+    containerName: web
+    host: h1
+    action: restart
+    auth: c2VjcmV0
+`), 0600))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := &fakeClient{host: &types.Host{ID: "h1", Name: "docker-1", NCPU: 4, MemTotal: 8 << 30}, containers: []types.Container{
+		{ID: "0123456789ab", Name: "web", Image: "nginx:1.27", State: "running", Health: "healthy", Host: "h1", Labels: map[string]string{"tier": "frontend"}},
+		{ID: "ba9876543210", Name: "worker", Image: "app:latest", State: "exited", Host: "h1", Labels: map[string]string{"tier": "backend"}},
+	}}
+	store := types.NewContainerStore(ctx, client)
+	_, err = store.List()
+	require.NoError(t, err)
+
+	h := newTestHandler("/")
+	h.config.Authorization.Provider = ProviderNone
+	h.clients = map[string]types.Client{"h1": client}
+	h.stores = map[string]*types.ContainerStore{"h1": store}
+
+	return h
+}
+
+func getData[T any](t *testing.T, h *handler, target string, expectedStatus int) T {
+	w := httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	require.Equal(t, expectedStatus, w.Code, w.Body.String())
+
+	var body struct {
+		Data T `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+	return body.Data
+}
+
+func Test_listHosts(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	hosts := getData[[]map[string]any](t, h, "/api/v1/hosts", http.StatusOK)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "docker-1", hosts[0]["name"])
+	assert.EqualValues(t, 4, hosts[0]["nCPU"])
+	assert.EqualValues(t, 8<<30, hosts[0]["memTotal"])
+	assert.Equal(t, true, hosts[0]["connected"])
+	assert.Equal(t, map[string]any{"enabled": false, "nodeState": "inactive", "controlAvailable": false}, hosts[0]["swarm"])
+}
+
+func Test_listContainers(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"web", "worker"}},
+		{"?state=running", []string{"web"}},
+		{"?health=healthy&health=unhealthy", []string{"web"}},
+		{"?label=tier=backend", []string{"worker"}},
+		{"?label=tier", []string{"web", "worker"}},
+		{"?image=nginx&name=wor", []string{}},
+		{"?host=h2", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			containers := getData[[]types.Container](t, h, "/api/v1/containers"+test.query, http.StatusOK)
+
+			names := make([]string, 0)
+			for _, container := range containers {
+				names = append(names, container.Name)
+			}
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
+
+func Test_getContainer(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	container := getData[containerResponse](t, h, "/api/v1/containers/h1/web", http.StatusOK)
+	assert.Equal(t, "0123456789ab", container.ID)
+	assert.Equal(t, "frontend", container.Labels["tier"])
+	require.Len(t, container.Webhooks, 1)
+	assert.Equal(t, "4f8a2c1e-7d3b-4b6a-9c5e-2a1f0e9d8c7b", container.Webhooks[0].UUID)
+	assert.Equal(t, "/api/v1/webhooks/4f8a2c1e-7d3b-4b6a-9c5e-2a1f0e9d8c7b", container.Webhooks[0].URL)
+
+	container = getData[containerResponse](t, h, "/api/v1/containers/h1/0123456789abcdef", http.StatusOK)
+	assert.Equal(t, "web", container.Name, "expected full IDs to match")
+
+	container = getData[containerResponse](t, h, "/api/v1/containers/h1/worker", http.StatusOK)
+	assert.Empty(t, container.Webhooks)
+
+	getData[any](t, h, "/api/v1/containers/h1/0123", http.StatusNotFound)
+	getData[any](t, h, "/api/v1/containers/h2/web", http.StatusNotFound)
+}
+
+func Test_listWebhooks_hides_registry_auth(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	w := httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/webhooks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"containerName":"web"`)
+	assert.NotContains(t, w.Body.String(), "c2VjcmV0")
+}
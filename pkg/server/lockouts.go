@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+type unblockedLockouts struct {
+	Removed int `json:"removed"`
+}
+
+func (h *handler) listLockouts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := managerFromRequest(w, r); !ok {
+		return
+	}
+
+	writeData(w, r, http.StatusOK, h.config.Authorization.Lockouts.List())
+}
+
+func (h *handler) unblock(w http.ResponseWriter, r *http.Request) {
+	manager, ok := managerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+
+	removed, err := h.config.Authorization.Lockouts.Unblock(username, r.URL.Query().Get("ip"))
+	result, message := auditResult(err)
+	h.audit(r, audit.Entry{Event: audit.EventUnblock, Target: username, Result: result, Error: message})
+	if err != nil {
+		logFromRequest(r).Errorf("Error while unblocking user: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, err.Error()))
+		return
+	}
+
+	logFromRequest(r).Infof("User %s unblocked by %s", username, manager.Username)
+	writeData(w, r, http.StatusOK, unblockedLockouts{Removed: removed})
+}
+
+// managerFromRequest returns the logged-in user if they may manage users and lockouts; API tokens may not
+func managerFromRequest(w http.ResponseWriter, r *http.Request) (*user.User, bool) {
+	manager, ok := tokenOwnerFromRequest(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !manager.Can(user.PermissionManage) {
+		writeError(w, r, myErrors.New(http.StatusForbidden, myErrors.CodeForbidden, http.StatusText(http.StatusForbidden)))
+		return nil, false
+	}
+
+	return manager, true
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// validRequestID limits request IDs passed by clients, so that they cannot inject into logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,64}$`)
+
+// requestID reuses a valid X-Request-ID of the client or creates one, and returns it in the response
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+
+	return id
+}
+
+// logFromRequest returns a logger that adds the request ID to every line
+func logFromRequest(r *http.Request) *log.Entry {
+	return log.WithField("request_id", requestIDFromContext(r.Context()))
+}
+
+// accessLog logs every request once it is done; health checks and metrics scrapes are only logged at debug level
+func (h *handler) accessLog(next http.Handler) http.Handler {
+	quiet := map[string]bool{
+		path.Join(h.config.Base, "healthcheck"): true,
+		path.Join(h.config.Base, "healthz"):     true,
+		path.Join(h.config.Base, "readyz"):      true,
+		path.Join(h.config.Base, "metrics"):     true,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		entry := logFromRequest(r).WithFields(log.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      status,
+			"bytes":       ww.BytesWritten(),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"ip":          helper.ClientIP(r, h.config.TrustedProxies).String(),
+		})
+
+		switch {
+		case quiet[r.URL.Path]:
+			entry.Debug("request")
+		case status >= http.StatusInternalServerError:
+			entry.Error("request")
+		default:
+			entry.Info("request")
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/goccy/go-json"
+	"github.com/kekaadrenalin/dockhook/pkg/docker"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+const (
+	defaultLogTail = "100"
+	// maxActionLogs limits how long a webhook call waits for the output of the container
+	maxActionLogs     = time.Minute
+	maxActionLogLines = 1000
+)
+
+var errLogLimit = errors.New("log limit reached")
+
+// containerLogs streams the logs as one JSON entry per line; with follow the stream stays open for new lines
+func (h *handler) containerLogs(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	container, myErr := h.containerFromRequest(r, scope)
+	if myErr != nil {
+		writeError(w, r, myErr)
+		return
+	}
+
+	options, err := logOptionsFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	client, _ := h.client(container.Host)
+
+	// Only inspecting the container tells whether it has a TTY
+	inspected, err := client.FindContainerByID(container.ID)
+	if err != nil {
+		logFromRequest(r).Warnf("Could not inspect container %s: %v", container.ID, err)
+		writeError(w, r, myErrors.New(http.StatusNotFound, myErrors.CodeContainerNotFound, "unknown container"))
+		return
+	}
+
+	reader, err := client.ContainerLogsWithOptions(r.Context(), container.ID, options)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while reading logs of container %s: %v", container.ID, err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+	defer reader.Close()
+
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if options.Follow {
+		_ = controller.Flush()
+	}
+
+	err = docker.ReadLogs(reader, inspected.Tty, func(entry types.LogEntry) error {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+
+		if options.Follow {
+			return controller.Flush()
+		}
+
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		logFromRequest(r).Warnf("Log stream of container %s ended: %v", container.ID, err)
+	}
+}
+
+func logOptionsFromQuery(query url.Values, now time.Time) (types.LogOptions, error) {
+	options := types.LogOptions{Tail: defaultLogTail, StdType: types.STDALL}
+
+	for name, target := range map[string]*time.Time{"since": &options.Since, "until": &options.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := parseLogTime(value, now)
+		if err != nil {
+			return options, fmt.Errorf("%s must be an RFC 3339 time or a duration", name)
+		}
+
+		*target = parsed
+	}
+
+	// A time range returns every line in it unless a tail is given
+	if !options.Since.IsZero() || !options.Until.IsZero() {
+		options.Tail = ""
+	}
+
+	if value := query.Get("tail"); value == "all" {
+		options.Tail = ""
+	} else if value != "" {
+		tail, err := strconv.Atoi(value)
+		if err != nil || tail < 0 {
+			return options, errors.New("tail must be a number or all")
+		}
+
+		options.Tail = value
+	}
+
+	if streams := query["stream"]; len(streams) > 0 {
+		options.StdType = 0
+		for _, stream := range streams {
+			switch stream {
+			case types.STDOUT.String():
+				options.StdType |= types.STDOUT
+			case types.STDERR.String():
+				options.StdType |= types.STDERR
+			default:
+				return options, errors.New("stream must be stdout or stderr")
+			}
+		}
+	}
+
+	if value := query.Get("follow"); value != "" {
+		follow, err := strconv.ParseBool(value)
+		if err != nil {
+			return options, errors.New("follow must be true or false")
+		}
+
+		options.Follow = follow
+	}
+
+	return options, nil
+}
+
+// parseLogTime accepts an RFC 3339 time or a duration before now, e.g. 15m
+func parseLogTime(value string, now time.Time) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, errors.New("invalid time")
+	}
+
+	return now.Add(-duration), nil
+}
+
+// actionLogsDuration reads how long a webhook call should capture logs after the action
+func actionLogsDuration(r *http.Request, webhook *types.Webhook) (time.Duration, error) {
+	value := r.URL.Query().Get("logs")
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 || duration > maxActionLogs {
+		return 0, fmt.Errorf("logs must be a duration up to %s", maxActionLogs)
+	}
+
+	if webhook.Action == types.ActionStop {
+		return 0, nil
+	}
+
+	return duration, nil
+}
+
+// actionLogs follows the output of a container for a while after an action; errors only end the capture early
+func actionLogs(ctx context.Context, client types.Client, containerID string, since time.Time, duration time.Duration) []types.LogEntry {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	entries := make([]types.LogEntry, 0)
+
+	container, err := client.FindContainerByID(containerID)
+	if err != nil {
+		log.Warnf("Could not inspect container %s for its logs: %v", containerID, err)
+		return entries
+	}
+
+	reader, err := client.ContainerLogsWithOptions(ctx, containerID, types.LogOptions{Since: since, Follow: true, StdType: types.STDALL})
+	if err != nil {
+		log.Warnf("Could not read logs of container %s: %v", containerID, err)
+		return entries
+	}
+	defer reader.Close()
+
+	err = docker.ReadLogs(reader, container.Tty, func(entry types.LogEntry) error {
+		if len(entries) >= maxActionLogLines {
+			return errLogLimit
+		}
+
+		entries = append(entries, entry)
+
+		return nil
+	})
+	if err != nil && ctx.Err() == nil && !errors.Is(err, errLogLimit) {
+		log.Warnf("Log capture of container %s ended: %v", containerID, err)
+	}
+
+	return entries
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_logOptionsFromQuery(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query    string
+		expected types.LogOptions
+		err      bool
+	}{
+		{"", types.LogOptions{Tail: "100", StdType: types.STDALL}, false},
+		{"tail=all&stream=stderr&follow=true", types.LogOptions{StdType: types.STDERR, Follow: true}, false},
+		{"since=15m", types.LogOptions{Since: now.Add(-15 * time.Minute), StdType: types.STDALL}, false},
+		{"since=2024-05-01T10:00:00Z&until=1h&tail=5", types.LogOptions{Since: now.Add(-2 * time.Hour), Until: now.Add(-time.Hour), Tail: "5", StdType: types.STDALL}, false},
+		{"stream=stdout&stream=stderr", types.LogOptions{Tail: "100", StdType: types.STDALL}, false},
+		{"tail=-1", types.LogOptions{}, true},
+		{"stream=both", types.LogOptions{}, true},
+		{"since=yesterday", types.LogOptions{}, true},
+		{"follow=maybe", types.LogOptions{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			require.NoError(t, err)
+
+			options, err := logOptionsFromQuery(query, now)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, options)
+		})
+	}
+}
+
+func multiplexedLogs() []byte {
+	var data bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&data, stdcopy.Stdout).Write([]byte("2024-05-01T10:00:00Z listening on :80\n"))
+	_, _ = stdcopy.NewStdWriter(&data, stdcopy.Stderr).Write([]byte("2024-05-01T10:00:01Z connection refused\n"))
+
+	return data.Bytes()
+}
+
+func Test_containerLogs(t *testing.T) {
+	h := newInventoryHandler(t)
+	client := h.clients["h1"].(*fakeClient)
+	client.logs = multiplexedLogs()
+
+	w := httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/containers/h1/web/logs?tail=10", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "10", client.logOptions.Tail)
+
+	entries := make([]types.LogEntry, 0)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var entry types.LogEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, types.LogEntry{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Stream: "stdout", Message: "listening on :80"}, entries[0])
+	assert.Equal(t, "stderr", entries[1].Stream)
+
+	w = httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/containers/h1/web/logs?tail=last", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_actionLogs(t *testing.T) {
+	client := &fakeClient{logs: multiplexedLogs(), containers: []types.Container{{ID: "0123456789ab", Name: "web"}}}
+	since := time.Now()
+
+	entries := actionLogs(context.Background(), client, "0123456789ab", since, time.Second)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "connection refused", entries[1].Message)
+	assert.Equal(t, types.LogOptions{Since: since, Follow: true, StdType: types.STDALL}, client.logOptions)
+
+	assert.Empty(t, actionLogs(context.Background(), client, "unknown", since, time.Second))
+}
+
+func Test_actionLogsDuration(t *testing.T) {
+	request := func(query string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/uuid?"+query, nil)
+	}
+
+	duration, err := actionLogsDuration(request("logs=10s"), &types.Webhook{Action: types.ActionRestart})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, duration)
+
+	duration, err = actionLogsDuration(request("logs=10s"), &types.Webhook{Action: types.ActionStop})
+	require.NoError(t, err)
+	assert.Zero(t, duration, "expected no logs after stop")
+
+	_, err = actionLogsDuration(request("logs=2h"), &types.Webhook{Action: types.ActionStart})
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+)
+
+// MetricsConfig protects /metrics with a bearer token, an allowlist of client networks or both
+type MetricsConfig struct {
+	Token           string
+	AllowedNetworks []*net.IPNet
+	TrustedProxies  []*net.IPNet
+	// StatsInterval samples container stats for the metrics, 0 disables it
+	StatsInterval time.Duration
+}
+
+// Enabled reports whether /metrics is served; it never is without protection
+func (c MetricsConfig) Enabled() bool {
+	return c.Token != "" || len(c.AllowedNetworks) > 0
+}
+
+func (h *handler) metricsAccess(next http.Handler) http.Handler {
+	config := h.config.Metrics
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(config.AllowedNetworks) > 0 {
+			ip := helper.ClientIP(r, config.TrustedProxies)
+			if ip == nil || !helper.ContainsIP(config.AllowedNetworks, ip) {
+				log.Debugf("Rejected metrics request from %s", r.RemoteAddr)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+
+		if config.Token != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"path"
+
+	"github.com/goccy/go-json"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+)
+
+//go:embed api/openapi.json
+var openAPISpec []byte
+
+// openAPI serves the OpenAPI document of /api/v1 with the server URL below the configured base
+func (h *handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		logFromRequest(r).Errorf("Error while reading OpenAPI document: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	spec["servers"] = []map[string]string{{"url": path.Join(h.config.Base, "api/v1")}}
+
+	writeJSON(w, http.StatusOK, spec)
+}
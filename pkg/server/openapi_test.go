@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+type stubAuthorizer struct{}
+
+func (stubAuthorizer) AuthMiddleware(next http.Handler) http.Handler {
+	return next
+}
+
+func (stubAuthorizer) CreateToken(string, string) (string, error) {
+	return "", user.ErrInvalidCredentials
+}
+
+// newTestHandler enables every optional part of the API
+func newTestHandler(base string) *handler {
+	return &handler{events: newEventHub(), config: &Config{
+		Base:    base,
+		Version: "test",
+		Audit:   &audit.Log{},
+		Authorization: Authorization{
+			Provider:   ProviderSimple,
+			Authorizer: stubAuthorizer{},
+			Users:      &user.UsersDatabase{},
+			Tokens:     &user.TokensDatabase{},
+			Sessions:   &user.SessionManager{},
+			Lockouts:   &user.LockoutsDatabase{},
+		},
+	}}
+}
+
+func Test_openAPI_matches_router(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openAPISpec, &spec))
+
+	documented := make([]string, 0)
+	for route, operations := range spec.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+route)
+		}
+	}
+
+	registered := make([]string, 0)
+	err := chi.Walk(createRouter(newTestHandler("/")), func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route, found := strings.CutPrefix(route, "/api/v1/")
+		if found && !strings.HasSuffix(route, "*") {
+			registered = append(registered, method+" /"+route)
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(documented)
+	sort.Strings(registered)
+	assert.Equal(t, registered, documented, "expected every /api/v1 route to be documented in api/openapi.json")
+}
+
+func Test_apiV1_envelopes(t *testing.T) {
+	router := createRouter(newTestHandler("/dockhook"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dockhook/api/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var spec struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	require.Len(t, spec.Servers, 1)
+	assert.Equal(t, "/dockhook/api/v1", spec.Servers[0].URL)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"middleware error", http.MethodGet, "/dockhook/api/v1/version", http.StatusUnauthorized, "unauthorized"},
+		{"handler error", http.MethodPost, "/dockhook/api/v1/token", http.StatusUnauthorized, "invalid_credentials"},
+		{"unknown route", http.MethodGet, "/dockhook/api/v1/unknown", http.StatusNotFound, "not_found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+
+			var body envelope
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+			assert.Equal(t, test.status, w.Code)
+			require.NotNil(t, body.Error)
+			assert.Equal(t, test.code, body.Error.Code)
+			assert.Equal(t, w.Header().Get(requestIDHeader), body.RequestID)
+		})
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dockhook/version", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Unauthorized\n", w.Body.String(), "expected the unversioned API to keep plain text errors")
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CreateRedirectServer redirects plain HTTP requests on addr to the HTTPS server listening on httpsAddr
+func CreateRedirectServer(addr, httpsAddr string) *http.Server {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := strings.Trim(r.Host, "[]")
+			if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = hostname
+			}
+
+			if httpsPort != "" && httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+
+			target := "https://" + host + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		}),
+	}
+}
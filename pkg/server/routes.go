@@ -2,19 +2,24 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"net"
 	"net/http"
-	"path/filepath"
+	"path"
 	"strings"
+	"sync"
 
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	"github.com/kekaadrenalin/dockhook/pkg/docker"
 	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/kekaadrenalin/dockhook/pkg/user"
-	"github.com/kekaadrenalin/dockhook/pkg/webhook"
 )
 
 type AuthProvider string
@@ -23,66 +28,137 @@ const (
 	ProviderNone   AuthProvider = "none"
 	ProviderSimple AuthProvider = "simple"
 	ProviderBasic  AuthProvider = "basic"
+	ProviderOIDC   AuthProvider = "oidc"
+	ProviderProxy  AuthProvider = "forward-proxy"
+	ProviderLDAP   AuthProvider = "ldap"
+	ProviderMTLS   AuthProvider = "mtls"
 )
 
 var ValidAuthProviders = map[string]bool{
 	string(ProviderNone):   true,
 	string(ProviderSimple): true,
 	string(ProviderBasic):  true,
+	string(ProviderOIDC):   true,
+	string(ProviderProxy):  true,
+	string(ProviderLDAP):   true,
+	string(ProviderMTLS):   true,
 }
 
 // Config is a struct for configuring the web service
 type Config struct {
-	Base          string
-	Addr          string
-	Version       string
-	Hostname      string
-	Authorization Authorization
+	Base           string
+	Addr           string
+	Version        string
+	Hostname       string
+	TLSConfig      *tls.Config
+	Cookies        user.CookieConfig
+	TrustedOrigins []string
+	TrustedProxies []*net.IPNet
+	Metrics        MetricsConfig
+	Readiness      Readiness
+	Supervisor     *docker.Supervisor
+	Audit          *audit.Log
+	Authorization  Authorization
 }
 
 type Authorization struct {
 	Provider   AuthProvider
 	Authorizer Authorizer
+	Users      *user.UsersDatabase
+	Tokens     *user.TokensDatabase
+	Sessions   *user.SessionManager
+	Lockouts   *user.LockoutsDatabase
 }
 
-type Authorizer interface {
+type Authenticator interface {
 	AuthMiddleware(http.Handler) http.Handler
+}
+
+type Authorizer interface {
+	Authenticator
 	CreateToken(string, string) (string, error)
 }
 
+// SecondFactorAuthorizer is implemented by authorizers that accept a one-time code on login
+type SecondFactorAuthorizer interface {
+	CreateTokenWithCode(string, string, string) (string, error)
+}
+
+// RouteRegistrar is implemented by authorizers that need their own public endpoints, such as login callbacks
+type RouteRegistrar interface {
+	RegisterRoutes(chi.Router)
+}
+
 type handler struct {
-	clients map[string]types.Client
-	stores  map[string]*types.ContainerStore
-	config  *Config
+	// clients and stores grow when the supervisor connects a host, use the accessors in hosts.go
+	clients   map[string]types.Client
+	stores    map[string]*types.ContainerStore
+	hostsMu   sync.RWMutex
+	config    *Config
+	tokenAuth Authenticator
+	events    *eventHub
 }
 
 func CreateServer(clients map[string]types.Client, config Config) *http.Server {
-	stores := make(map[string]*types.ContainerStore)
+	handler := &handler{
+		clients: make(map[string]types.Client),
+		config:  &config,
+		stores:  make(map[string]*types.ContainerStore),
+		events:  newEventHub(),
+	}
+
 	for host, client := range clients {
-		stores[host] = types.NewContainerStore(context.Background(), client)
+		handler.addHost(context.Background(), host, client)
 	}
 
-	handler := &handler{
-		clients: clients,
-		config:  &config,
-		stores:  stores,
+	if config.Supervisor != nil {
+		config.Supervisor.Start(context.Background())
+
+		go func() {
+			for client := range config.Supervisor.Clients() {
+				handler.addHost(context.Background(), client.Host().ID, client)
+			}
+		}()
+	}
+
+	if config.Metrics.Enabled() && config.Metrics.StatsInterval > 0 {
+		go handler.sampleStats(context.Background(), config.Metrics.StatsInterval)
 	}
 
-	return &http.Server{Addr: config.Addr, Handler: createRouter(handler)} //nolint:gosec
+	if config.Authorization.Tokens != nil {
+		handler.tokenAuth = user.NewTokenAuth(config.Authorization.Tokens, config.Authorization.Users)
+	}
+
+	return &http.Server{Addr: config.Addr, Handler: createRouter(handler), TLSConfig: config.TLSConfig} //nolint:gosec
 }
 
 func createRouter(h *handler) *chi.Mux {
 	base := h.config.Base
 	r := chi.NewRouter()
-	r.Use(cspHeaders)
+	r.Use(requestID, h.accessLog, h.apiV1, cspHeaders)
 
 	if h.config.Authorization.Provider != ProviderNone && h.config.Authorization.Authorizer == nil {
 		log.Panic("Authorization provider is set but no authorizer is provided")
 	}
 
+	// Health checks run without credentials and only tell the status, details are at /api/v1/readyz;
+	// /healthcheck is kept for older health check commands
+	r.Get(path.Join(base, "healthz"), h.healthz)
+	r.Get(path.Join(base, "readyz"), h.readyz)
+	r.Get(path.Join(base, "healthcheck"), h.readyz)
+
+	// Metrics have their own protection and bypass the auth provider
+	if h.config.Metrics.Enabled() {
+		r.With(h.metricsAccess).Handle(path.Join(base, "metrics"), metrics.Handler())
+	}
+
 	r.Route(base, func(r chi.Router) {
 		if h.config.Authorization.Provider != ProviderNone {
-			r.Use(h.config.Authorization.Authorizer.AuthMiddleware)
+			r.Use(h.authMiddleware)
+		}
+
+		if h.config.Authorization.Sessions != nil {
+			r.Use(user.RequireSameOrigin(h.config.TrustedOrigins))
 		}
 
 		r.Group(func(r chi.Router) {
@@ -91,24 +167,29 @@ func createRouter(h *handler) *chi.Mux {
 					r.Use(user.RequireAuthentication)
 				}
 
-				r.Post("/api/webhooks/{webhookUUID}", h.containerWebhooks)
 				r.Get("/version", h.version)
+				r.Get("/api/v1/version", h.version)
 			})
 
+			h.apiRoutes(r, "/api")
+			h.apiRoutes(r, "/api/v1")
+
+			// Dashboard; simple and oidc log in from the page, the other providers already asked for credentials
+			r.Get("/", h.dashboard)
+			r.Handle("/assets/*", h.dashboardAssets())
+
 			defaultHandler := http.StripPrefix(strings.Replace(base+"/", "//", "/", 1), http.HandlerFunc(h.error))
 			r.Get("/*", func(w http.ResponseWriter, req *http.Request) {
 				defaultHandler.ServeHTTP(w, req)
 			})
 		})
 
-		// Auth
-		if h.config.Authorization.Provider == ProviderSimple {
-			r.Post("/api/token", h.createToken)
-			r.Delete("/api/token", h.deleteToken)
-		}
+		r.Get("/api/v1/openapi.json", h.openAPI)
+		r.HandleFunc("/api/v1/*", h.notFoundV1)
 
-		// Healthcheck
-		r.Get("/healthcheck", h.healthcheck)
+		if registrar, ok := h.config.Authorization.Authorizer.(RouteRegistrar); ok {
+			r.Group(registrar.RegisterRoutes)
+		}
 	})
 
 	if base != "/" {
@@ -120,31 +201,87 @@ func createRouter(h *handler) *chi.Mux {
 	return r
 }
 
+// apiRoutes registers the API below prefix; /api keeps plain text responses while /api/v1 uses envelopes
+func (h *handler) apiRoutes(r chi.Router, prefix string) {
+	r.Group(func(r chi.Router) {
+		if h.config.Authorization.Provider != ProviderNone {
+			r.Use(user.RequireAuthentication)
+		}
+
+		r.Get(prefix+"/me", h.me)
+		r.Get(prefix+"/hosts", h.listHosts)
+		r.Get(prefix+"/hosts/{host}/stats", h.hostStats)
+		r.Get(prefix+"/containers", h.listContainers)
+		r.Get(prefix+"/containers/{host}/{containerID}", h.getContainer)
+		r.Get(prefix+"/containers/{host}/{containerID}/logs", h.containerLogs)
+		r.Get(prefix+"/containers/{host}/{containerID}/stats", h.containerStats)
+		r.Get(prefix+"/webhooks", h.listWebhooks)
+		r.Get(prefix+"/readyz", h.readyzDetails)
+		r.Get(prefix+"/events", h.streamEvents)
+		r.Get(prefix+"/events/ws", h.streamEventsWebSocket)
+		r.Post(prefix+"/webhooks/{webhookUUID}", h.containerWebhooks)
+
+		if h.config.Audit != nil {
+			r.Get(prefix+"/jobs", h.listJobs)
+		}
+
+		if h.config.Authorization.Provider != ProviderNone && h.config.Authorization.Tokens != nil {
+			r.Get(prefix+"/tokens", h.listAPITokens)
+			r.Post(prefix+"/tokens", h.createAPIToken)
+			r.Delete(prefix+"/tokens/{tokenID}", h.revokeAPIToken)
+		}
+
+		if h.config.Authorization.Provider != ProviderNone && h.config.Authorization.Users != nil {
+			r.Get(prefix+"/users", h.listUsers)
+			r.Post(prefix+"/users", h.createUser)
+			r.Patch(prefix+"/users/{username}", h.updateUser)
+			r.Put(prefix+"/users/{username}/password", h.setPassword)
+			r.Delete(prefix+"/users/{username}", h.deleteUser)
+		}
+
+		if h.config.Authorization.Lockouts != nil {
+			r.Get(prefix+"/lockouts", h.listLockouts)
+			r.Delete(prefix+"/lockouts/{username}", h.unblock)
+		}
+
+		if h.config.Authorization.Provider != ProviderNone && h.config.Audit != nil {
+			r.Get(prefix+"/audit", h.listAudit)
+		}
+	})
+
+	// Auth
+	if h.config.Authorization.Provider == ProviderSimple {
+		r.Post(prefix+"/token", h.createToken)
+	}
+
+	if h.config.Authorization.Provider == ProviderSimple || h.config.Authorization.Provider == ProviderOIDC {
+		r.Delete(prefix+"/token", h.deleteToken)
+	}
+
+	if h.config.Authorization.Sessions != nil {
+		r.With(user.RequireAuthentication).Post(prefix+"/token/refresh", h.refreshToken)
+	}
+}
+
 func (h *handler) webhookFromRequest(r *http.Request) (*types.Webhook, *myErrors.HTTPError) {
 	webhookUUID := chi.URLParam(r, "webhookUUID")
 
-	log.Debugf("webhook UUID: %s", webhookUUID)
+	logFromRequest(r).Debugf("webhook UUID: %s", webhookUUID)
 
 	if err := uuid.Validate(webhookUUID); err != nil {
-		log.Errorf("wrong UUID: %s", webhookUUID)
-		log.Infof("Header.RemoteAddr: %+v\n", r.RemoteAddr)
-		log.Infof("Header.Authorization: %+v\n", r.Header)
+		logFromRequest(r).Errorf("wrong UUID: %s", webhookUUID)
 
 		return nil, &myErrors.HTTPError{
 			StatusCode: http.StatusBadRequest,
+			Code:       myErrors.CodeInvalidWebhookUUID,
 			Message:    fmt.Sprintf("error: %s", err),
 			Err:        err,
 		}
 	}
 
-	path, err := filepath.Abs("./data/webhooks.yml")
-	if err != nil {
-		log.Fatalf("Could not find absolute path to webhooks.yml file: %s", err)
-	}
-
-	webhooks, err := webhook.ReadWebhooksFromFile(path)
+	webhooks, err := readWebhooks()
 	if err != nil {
-		log.Errorf("unknown error: %s", err)
+		logFromRequest(r).Errorf("unknown error: %s", err)
 
 		return nil, &myErrors.HTTPError{
 			StatusCode: http.StatusInternalServerError,
@@ -154,10 +291,11 @@ func (h *handler) webhookFromRequest(r *http.Request) (*types.Webhook, *myErrors
 
 	webhookItem := webhooks.Find(webhookUUID)
 	if webhookItem == nil {
-		log.Errorf("no webhook found: %s", webhookUUID)
+		logFromRequest(r).Errorf("no webhook found: %s", webhookUUID)
 
 		return nil, &myErrors.HTTPError{
 			StatusCode: http.StatusNotFound,
+			Code:       myErrors.CodeWebhookNotFound,
 			Err:        err,
 		}
 	}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+// readScope limits what an API token can read to the hosts and containers its scope covers.
+// A token limited to webhooks only reads the containers targeted by the webhooks it may trigger.
+type readScope struct {
+	token    *user.Token
+	webhooks []*types.Webhook
+}
+
+func (h *handler) readScopeFromRequest(r *http.Request) (readScope, error) {
+	token := user.TokenFromContext(r.Context())
+	if token == nil {
+		return readScope{}, nil
+	}
+
+	scope := readScope{token: token}
+	if len(token.Scope.Webhooks) == 0 {
+		return scope, nil
+	}
+
+	webhooks, err := readWebhooks()
+	if err != nil {
+		return scope, err
+	}
+
+	for _, webhook := range webhooks.Webhooks {
+		if token.Scope.Allows(webhook) {
+			scope.webhooks = append(scope.webhooks, webhook)
+		}
+	}
+
+	return scope, nil
+}
+
+func (s readScope) allowsHost(host string) bool {
+	if s.token == nil {
+		return true
+	}
+
+	if len(s.token.Scope.Hosts) > 0 && !slices.Contains(s.token.Scope.Hosts, host) {
+		return false
+	}
+
+	if len(s.token.Scope.Webhooks) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(s.webhooks, func(webhook *types.Webhook) bool { return webhook.Host == host })
+}
+
+// allowsWholeHost reports whether every container of the host may be read, e.g. for host stats
+func (s readScope) allowsWholeHost(host string) bool {
+	return s.allowsHost(host) && (s.token == nil || len(s.token.Scope.Webhooks) == 0)
+}
+
+func (s readScope) allowsContainer(host string, id string, name string) bool {
+	if !s.allowsHost(host) {
+		return false
+	}
+
+	if s.token == nil || len(s.token.Scope.Webhooks) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(s.webhooks, func(webhook *types.Webhook) bool {
+		return webhook.Host == host && (webhook.ContainerName == name || sameContainerID(webhook.ContainerId, id))
+	})
+}
+
+func (s readScope) allowsEvent(event streamEvent) bool {
+	return s.allowsContainer(event.Host, event.ContainerID, event.ContainerName)
+}
+
+func errTokenNotAllowed() *myErrors.HTTPError {
+	return myErrors.New(http.StatusForbidden, myErrors.CodeAPITokenNotAllowed, "API token is not allowed to read this host or container")
+}
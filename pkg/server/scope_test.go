@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+// newScopedHandler adds a second host to the inventory and authenticates API tokens of a read-only user
+func newScopedHandler(t *testing.T) *handler {
+	h := newInventoryHandler(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := &fakeClient{host: &types.Host{ID: "h2", Name: "docker-2"}, containers: []types.Container{
+		{ID: "cdef01234567", Name: "db", Image: "postgres:16", State: "running", Host: "h2"},
+	}}
+	store := types.NewContainerStore(ctx, client)
+	_, err := store.List()
+	require.NoError(t, err)
+
+	h.clients["h2"] = client
+	h.stores["h2"] = store
+
+	users := &user.UsersDatabase{Users: map[string]*user.User{
+		"reader": {Username: "reader", Roles: []user.Role{user.RoleReadOnly}},
+	}}
+	tokens := &user.TokensDatabase{}
+
+	h.config.Authorization.Provider = ProviderSimple
+	h.config.Authorization.Users = users
+	h.config.Authorization.Tokens = tokens
+	h.tokenAuth = user.NewTokenAuth(tokens, users)
+
+	return h
+}
+
+func issueReadToken(t *testing.T, h *handler, scope user.TokenScope) string {
+	_, plaintext, err := h.config.Authorization.Tokens.Issue(user.Token{Name: "ci", Username: "reader", Scope: scope, Expires: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	return plaintext
+}
+
+func getWithToken[T any](t *testing.T, h *handler, token string, target string, expectedStatus int) T {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	createRouter(h).ServeHTTP(w, req)
+	require.Equal(t, expectedStatus, w.Code, w.Body.String())
+
+	var body struct {
+		Data  T `json:"data"`
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if expectedStatus == http.StatusForbidden {
+		assert.Equal(t, "api_token_not_allowed", body.Error.Code)
+	}
+
+	return body.Data
+}
+
+func Test_readScope_host_token(t *testing.T) {
+	h := newScopedHandler(t)
+	token := issueReadToken(t, h, user.TokenScope{Hosts: []string{"h2"}})
+
+	for _, target := range []string{
+		"/api/v1/containers/h1/web",
+		"/api/v1/containers/h1/web/logs",
+		"/api/v1/containers/h1/web/stats",
+		"/api/v1/hosts/h1/stats",
+	} {
+		t.Run(target, func(t *testing.T) {
+			getWithToken[any](t, h, token, target, http.StatusForbidden)
+		})
+	}
+
+	containers := getWithToken[[]types.Container](t, h, token, "/api/v1/containers", http.StatusOK)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "db", containers[0].Name)
+
+	hosts := getWithToken[[]hostResponse](t, h, token, "/api/v1/hosts", http.StatusOK)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "h2", hosts[0].ID)
+
+	assert.Empty(t, getWithToken[[]webhookSummary](t, h, token, "/api/v1/webhooks", http.StatusOK), "expected webhooks of other hosts to be hidden")
+	getWithToken[any](t, h, token, "/api/v1/containers/h2/db", http.StatusOK)
+	getWithToken[any](t, h, token, "/api/v1/hosts/h2/stats", http.StatusOK)
+}
+
+func Test_readScope_webhook_token(t *testing.T) {
+	h := newScopedHandler(t)
+	token := issueReadToken(t, h, user.TokenScope{Webhooks: []string{"4f8a2c1e-7d3b-4b6a-9c5e-2a1f0e9d8c7b"}})
+
+	containers := getWithToken[[]types.Container](t, h, token, "/api/v1/containers", http.StatusOK)
+	require.Len(t, containers, 1)
+	assert.Equal(t, "web", containers[0].Name, "expected only the target of the webhook")
+
+	getWithToken[any](t, h, token, "/api/v1/containers/h1/web", http.StatusOK)
+	getWithToken[any](t, h, token, "/api/v1/containers/h1/worker", http.StatusForbidden)
+	getWithToken[any](t, h, token, "/api/v1/containers/h2/db", http.StatusForbidden)
+	getWithToken[any](t, h, token, "/api/v1/hosts/h1/stats", http.StatusForbidden)
+
+	hosts := getWithToken[[]hostResponse](t, h, token, "/api/v1/hosts", http.StatusOK)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "h1", hosts[0].ID)
+}
+
+func Test_readScope_events(t *testing.T) {
+	h := newScopedHandler(t)
+	token := issueReadToken(t, h, user.TokenScope{Hosts: []string{"h2"}})
+
+	server := httptest.NewServer(createRouter(h))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	h.events.publish(streamEvent{Type: "start", Host: "h1", ContainerName: "web"})
+	h.events.publish(streamEvent{Type: EventActionStarted, Host: "h1", ContainerName: "web", Webhook: "w1"})
+	h.events.publish(streamEvent{Type: "start", Host: "h2", ContainerName: "db"})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				lines <- data
+			}
+		}
+	}()
+
+	select {
+	case data := <-lines:
+		var event streamEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		assert.Equal(t, "h2", event.Host, "expected events of other hosts to be left out")
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+	}
+}
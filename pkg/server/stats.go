@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/goccy/go-json"
+
+	"github.com/kekaadrenalin/dockhook/pkg/docker"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+// hostStatsInterval is how often a host stream sends the sum of the latest container samples
+const hostStatsInterval = 2 * time.Second
+
+// containerStats returns one sample of a running container, or a sample per line with stream=true
+func (h *handler) containerStats(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	container, myErr := h.containerFromRequest(r, scope)
+	if myErr != nil {
+		writeError(w, r, myErr)
+		return
+	}
+
+	if container.State != "running" {
+		writeError(w, r, myErrors.New(http.StatusConflict, myErrors.CodeConflict, "container is not running"))
+		return
+	}
+
+	stream, ok := streamFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	client, _ := h.client(container.Host)
+
+	if !stream {
+		samples := make(chan types.ContainerStats, 1)
+		if err := client.ContainerStats(r.Context(), container.ID, false, samples); err != nil || len(samples) == 0 {
+			logFromRequest(r).Errorf("Error while reading stats of container %s: %v", container.ID, err)
+			writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+			return
+		}
+
+		writeData(w, r, http.StatusOK, <-samples)
+		return
+	}
+
+	samples := make(chan types.ContainerStats)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.ContainerStats(r.Context(), container.ID, true, samples)
+	}()
+
+	controller, encoder := startStatsStream(w)
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				logFromRequest(r).Warnf("Stats stream of container %s ended: %v", container.ID, err)
+			}
+			return
+		case sample := <-samples:
+			if err := encoder.Encode(sample); err != nil {
+				return
+			}
+
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// hostStats sums the stats of the running containers of a host; a stream sends the sum every hostStatsInterval
+func (h *handler) hostStats(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.readerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "host")
+	if !scope.allowsWholeHost(id) {
+		writeError(w, r, errTokenNotAllowed())
+		return
+	}
+
+	client, ok := h.client(id)
+	store, hasStore := h.store(id)
+	if !ok || !hasStore {
+		writeError(w, r, myErrors.New(http.StatusNotFound, myErrors.CodeHostNotFound, "unknown host"))
+		return
+	}
+
+	stream, ok := streamFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ids := runningContainers(store)
+
+	if !stream {
+		writeData(w, r, http.StatusOK, docker.AggregateStats(client.Host(), docker.CollectStats(r.Context(), client, ids)))
+		return
+	}
+
+	samples := make(chan types.ContainerStats)
+	for _, containerID := range ids {
+		go func() {
+			if err := client.ContainerStats(r.Context(), containerID, true, samples); err != nil {
+				logFromRequest(r).Debugf("Stats stream of container %s ended: %v", containerID, err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(hostStatsInterval)
+	defer ticker.Stop()
+
+	latest := make(map[string]types.ContainerStats, len(ids))
+	controller, encoder := startStatsStream(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case sample := <-samples:
+			latest[sample.ID] = sample
+		case <-ticker.C:
+			collected := make([]types.ContainerStats, 0, len(latest))
+			for _, sample := range latest {
+				collected = append(collected, sample)
+			}
+
+			if err := encoder.Encode(docker.AggregateStats(client.Host(), collected)); err != nil {
+				return
+			}
+
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func streamFromRequest(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	value := r.URL.Query().Get("stream")
+	if value == "" {
+		return false, true
+	}
+
+	stream, err := strconv.ParseBool(value)
+	if err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, "stream must be true or false"))
+		return false, false
+	}
+
+	return stream, true
+}
+
+func startStatsStream(w http.ResponseWriter) (*http.ResponseController, *json.Encoder) {
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_ = controller.Flush()
+
+	return controller, json.NewEncoder(w)
+}
+
+func runningContainers(store *types.ContainerStore) []string {
+	ids := make([]string, 0)
+	for _, container := range store.Containers() {
+		if container.State == "running" {
+			ids = append(ids, container.ID)
+		}
+	}
+
+	return ids
+}
+
+// sampleStats refreshes the container stats exported as metrics until ctx is done
+func (h *handler) sampleStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// A round must not overlap the next one, samples that take longer are left out
+		round, cancel := context.WithTimeout(ctx, interval)
+		clients, stores := h.hosts()
+		for id, store := range stores {
+			if !store.IsConnected() {
+				metrics.RemoveHostStats(id)
+				continue
+			}
+
+			client := clients[id]
+			metrics.SetHostStats(id, docker.AggregateStats(client.Host(), docker.CollectStats(round, client, runningContainers(store))))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
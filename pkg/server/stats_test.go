@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+func Test_containerStats(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	stats := getData[types.ContainerStats](t, h, "/api/v1/containers/h1/web/stats", http.StatusOK)
+	assert.Equal(t, "0123456789ab", stats.ID)
+	assert.InDelta(t, 25, stats.CPUPercent, 0.001)
+
+	getData[any](t, h, "/api/v1/containers/h1/worker/stats", http.StatusConflict)
+	getData[any](t, h, "/api/v1/containers/h1/web/stats?stream=maybe", http.StatusBadRequest)
+	getData[any](t, h, "/api/v1/containers/h2/web/stats", http.StatusNotFound)
+}
+
+func Test_hostStats(t *testing.T) {
+	h := newInventoryHandler(t)
+
+	stats := getData[types.HostStats](t, h, "/api/v1/hosts/h1/stats", http.StatusOK)
+	assert.Equal(t, "h1", stats.Host)
+	assert.Equal(t, 1, stats.Containers, "expected only the running container")
+	assert.Equal(t, 4, stats.CPUs)
+	assert.Equal(t, uint64(1<<30), stats.MemoryUsage)
+	assert.InDelta(t, 12.5, stats.MemoryPercent, 0.001)
+	require.Len(t, stats.Stats, 1)
+
+	getData[any](t, h, "/api/v1/hosts/h2/stats", http.StatusNotFound)
+}
+
+func Test_containerStats_stream(t *testing.T) {
+	server := httptest.NewServer(createRouter(newInventoryHandler(t)))
+	t.Cleanup(server.Close)
+
+	response, err := http.Get(server.URL + "/api/v1/containers/h1/0123456789ab/stats?stream=true")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/x-ndjson", response.Header.Get("Content-Type"))
+
+	lines := make(chan []byte)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			lines <- scanner.Bytes()
+		}
+	}()
+
+	select {
+	case line := <-lines:
+		var stats types.ContainerStats
+		require.NoError(t, json.Unmarshal(line, &stats))
+		assert.Equal(t, "0123456789ab", stats.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a sample")
+	}
+}
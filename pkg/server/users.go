@@ -0,0 +1,257 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kekaadrenalin/dockhook/pkg/audit"
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+)
+
+func (h *handler) listUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := managerFromRequest(w, r); !ok {
+		return
+	}
+
+	writeData(w, r, http.StatusOK, h.config.Authorization.Users.List())
+}
+
+func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := managerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	password := r.PostFormValue("password")
+	if password == "" {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeInvalidUser, "password is required"))
+		return
+	}
+
+	roles, err := user.ParseRoles(formValues(r.PostForm, "role"))
+	if err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeInvalidUser, err.Error()))
+		return
+	}
+
+	hash, err := helper.HashPassword(password)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while hashing password: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	created, err := h.config.Authorization.Users.Add(user.User{
+		Username: r.PostFormValue("username"),
+		Email:    r.PostFormValue("email"),
+		Name:     r.PostFormValue("name"),
+		Password: hash,
+		Roles:    roles,
+		Webhooks: formValues(r.PostForm, "webhook"),
+		Hosts:    formValues(r.PostForm, "host"),
+	})
+	h.auditUser(r, audit.EventUserCreate, r.PostFormValue("username"), err)
+	if err != nil {
+		userError(w, r, err)
+		return
+	}
+
+	logFromRequest(r).Infof("User %s created by %s", created.Username, manager.Username)
+	created.Password = ""
+	writeData(w, r, http.StatusCreated, created)
+}
+
+// updateUser replaces the fields present in the form; an empty role, webhook or host clears the list
+func (h *handler) updateUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := managerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	roles, err := user.ParseRoles(formValues(r.PostForm, "role"))
+	if err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeInvalidUser, err.Error()))
+		return
+	}
+
+	var before user.User
+	updated, err := h.config.Authorization.Users.Update(chi.URLParam(r, "username"), func(u *user.User) error {
+		before = *u
+
+		if r.PostForm.Has("name") {
+			u.Name = r.PostFormValue("name")
+		}
+		if r.PostForm.Has("email") {
+			u.Email = r.PostFormValue("email")
+		}
+		if r.PostForm.Has("role") {
+			u.Roles = roles
+		}
+		if r.PostForm.Has("webhook") {
+			u.Webhooks = formValues(r.PostForm, "webhook")
+		}
+		if r.PostForm.Has("host") {
+			u.Hosts = formValues(r.PostForm, "host")
+		}
+
+		return nil
+	})
+	h.auditUser(r, audit.EventUserUpdate, chi.URLParam(r, "username"), err)
+	if err != nil {
+		userError(w, r, err)
+		return
+	}
+
+	if user.Demoted(before, updated) {
+		h.revokeSessions(r, updated.Username)
+	}
+
+	logFromRequest(r).Infof("User %s updated by %s", updated.Username, manager.Username)
+	updated.Password = ""
+	writeData(w, r, http.StatusOK, updated)
+}
+
+// setPassword lets managers change any password and users their own one, given their current password
+func (h *handler) setPassword(w http.ResponseWriter, r *http.Request) {
+	caller, ok := tokenOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeBadRequest, err.Error()))
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+	users := h.config.Authorization.Users
+
+	if !caller.Can(user.PermissionManage) {
+		if caller.Username != username {
+			writeError(w, r, myErrors.New(http.StatusForbidden, myErrors.CodeForbidden, http.StatusText(http.StatusForbidden)))
+			return
+		}
+
+		lockouts := h.config.Authorization.Lockouts
+		if lockouts != nil {
+			if retryAfter := lockouts.Blocked(r, username); retryAfter > 0 {
+				user.TooManyRequests(w, retryAfter)
+				return
+			}
+		}
+
+		if users.FindByPassword(username, r.PostFormValue("current_password")) == nil {
+			if lockouts != nil {
+				if retryAfter := lockouts.Failed(r, username); retryAfter > 0 {
+					user.TooManyRequests(w, retryAfter)
+					return
+				}
+			}
+
+			writeError(w, r, myErrors.New(http.StatusForbidden, myErrors.CodeInvalidCredentials, "current password is wrong"))
+			return
+		}
+
+		if lockouts != nil {
+			lockouts.Succeeded(r, username)
+		}
+	}
+
+	err := users.SetPassword(username, r.PostFormValue("password"))
+	h.auditUser(r, audit.EventUserPassword, username, err)
+	if err != nil {
+		userError(w, r, err)
+		return
+	}
+
+	logFromRequest(r).Infof("Password of user %s changed by %s", username, caller.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUser deletes the user and revokes their API tokens
+func (h *handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	manager, ok := managerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+
+	err := h.config.Authorization.Users.Delete(username)
+	h.auditUser(r, audit.EventUserDelete, username, err)
+	if err != nil {
+		userError(w, r, err)
+		return
+	}
+
+	if tokens := h.config.Authorization.Tokens; tokens != nil {
+		for _, token := range tokens.List(username) {
+			if err := tokens.Revoke(token.ID); err != nil {
+				logFromRequest(r).Errorf("Error while revoking API token %s of deleted user %s: %v", token.ID, username, err)
+			}
+		}
+	}
+
+	h.revokeSessions(r, username)
+
+	logFromRequest(r).Infof("User %s deleted by %s", username, manager.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions ends the sessions of a deleted or demoted user, whose roles may be kept in session tokens
+func (h *handler) revokeSessions(r *http.Request, username string) {
+	if h.config.Authorization.Sessions == nil {
+		return
+	}
+
+	if err := h.config.Authorization.Sessions.RevokeUser(username); err != nil {
+		logFromRequest(r).Errorf("Error while revoking sessions of user %s: %v", username, err)
+	}
+}
+
+func (h *handler) auditUser(r *http.Request, event string, username string, err error) {
+	result, message := auditResult(err)
+	h.audit(r, audit.Entry{Event: event, Target: username, Result: result, Error: message})
+}
+
+func userError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		writeError(w, r, myErrors.New(http.StatusNotFound, myErrors.CodeUserNotFound, err.Error()))
+	case errors.Is(err, user.ErrUserExists):
+		writeError(w, r, myErrors.New(http.StatusConflict, myErrors.CodeUserExists, err.Error()))
+	case errors.Is(err, user.ErrLastAdmin):
+		writeError(w, r, myErrors.New(http.StatusConflict, myErrors.CodeLastAdmin, err.Error()))
+	case errors.Is(err, user.ErrInvalidUser):
+		writeError(w, r, myErrors.New(http.StatusBadRequest, myErrors.CodeInvalidUser, err.Error()))
+	default:
+		logFromRequest(r).Errorf("Error while saving users: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+	}
+}
+
+// formValues returns the non-empty values of a form field
+func formValues(form url.Values, key string) []string {
+	values := make([]string, 0, len(form[key]))
+	for _, value := range form[key] {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
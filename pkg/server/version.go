@@ -5,7 +5,17 @@ import (
 	"net/http"
 )
 
-func (h *handler) version(w http.ResponseWriter, _ *http.Request) {
+type versionResponse struct {
+	Version  string `json:"version"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+func (h *handler) version(w http.ResponseWriter, r *http.Request) {
+	if isAPIV1(r) {
+		writeData(w, r, http.StatusOK, versionResponse{Version: h.config.Version, Hostname: h.config.Hostname})
+		return
+	}
+
 	w.Header().Add("Content-Type", "text/html")
 
 	_, _ = fmt.Fprintf(w, "<pre>%v</pre>", h.config.Version)
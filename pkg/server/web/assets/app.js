@@ -0,0 +1,372 @@
+"use strict";
+
+(function () {
+  const base = document.querySelector('meta[name="dockhook-base"]').content.replace(/\/$/, "");
+  const provider = document.querySelector('meta[name="dockhook-provider"]').content;
+  const refreshInterval = 10000;
+
+  let me = null;
+  let timer = null;
+  let stream = null;
+  let pending = null;
+
+  class APIError extends Error {
+    constructor(status, code, message) {
+      super(message);
+      this.status = status;
+      this.code = code;
+    }
+  }
+
+  // api calls the versioned API and unwraps its envelopes
+  async function api(method, path, form) {
+    const options = { method: method, headers: { Accept: "application/json" } };
+    if (form) {
+      options.body = new URLSearchParams(form);
+    }
+
+    const response = await fetch(base + "/api/v1" + path, options);
+    if (response.status === 204) {
+      return null;
+    }
+
+    const body = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      const error = body.error || {};
+      throw new APIError(response.status, error.code || "", error.message || response.statusText);
+    }
+
+    return body.data;
+  }
+
+  function element(tag, text, className) {
+    const node = document.createElement(tag);
+    if (text !== undefined && text !== null) {
+      node.textContent = String(text);
+    }
+    if (className) {
+      node.className = className;
+    }
+    return node;
+  }
+
+  function row(cells) {
+    const tr = element("tr");
+    for (const cell of cells) {
+      const td = element("td");
+      if (cell instanceof Node) {
+        td.appendChild(cell);
+      } else {
+        td.textContent = cell === undefined || cell === null ? "" : String(cell);
+      }
+      tr.appendChild(td);
+    }
+    return tr;
+  }
+
+  function fill(section, rows, empty) {
+    const tbody = document.querySelector("#" + section + " tbody");
+    tbody.replaceChildren();
+    if (rows.length === 0) {
+      const td = element("td", empty, "empty");
+      td.colSpan = document.querySelectorAll("#" + section + " th").length;
+      tbody.appendChild(element("tr")).appendChild(td);
+      return;
+    }
+    tbody.append(...rows);
+  }
+
+  function showMessage(text, isError) {
+    const message = document.getElementById("message");
+    message.textContent = text;
+    message.className = isError ? "error" : "info";
+    message.hidden = !text;
+  }
+
+  function formatTime(value) {
+    return value ? new Date(value).toLocaleString() : "";
+  }
+
+  function formatBytes(value) {
+    if (!value) {
+      return "";
+    }
+    const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+    let unit = 0;
+    while (value >= 1024 && unit < units.length - 1) {
+      value /= 1024;
+      unit++;
+    }
+    return value.toFixed(unit === 0 ? 0 : 1) + " " + units[unit];
+  }
+
+  function can(permission) {
+    return me !== null && me.permissions.includes(permission);
+  }
+
+  function connection(host) {
+    if (host.connected) {
+      return element("span", "connected", "ok");
+    }
+
+    const state = host.connection || {};
+    const label = state.attempts ? "disconnected, retrying (" + state.attempts + " attempts)" : "disconnected";
+    const node = element("span", label, "failure");
+    node.title = state.lastError || "";
+    return node;
+  }
+
+  async function loadHosts() {
+    const hosts = await api("GET", "/hosts");
+    fill("hosts", hosts.map((host) => row([
+      host.name,
+      host.id,
+      host.nCPU || "",
+      formatBytes(host.memTotal),
+      host.swarm.enabled ? host.swarm.nodeState + (host.swarm.controlAvailable ? " (manager)" : "") : "",
+      connection(host),
+    ])), "No hosts");
+  }
+
+  let containers = [];
+
+  function renderContainers() {
+    const filter = document.getElementById("container-filter").value.trim().toLowerCase();
+    const visible = containers.filter((container) => !filter ||
+      [container.name, container.image, container.host].some((value) => (value || "").toLowerCase().includes(filter)));
+
+    fill("containers", visible.map((container) => row([
+      container.name,
+      container.image,
+      container.host,
+      element("span", container.health ? container.state + " (" + container.health + ")" : container.state, "state-" + container.state),
+      container.status,
+    ])), "No containers");
+  }
+
+  async function loadContainers() {
+    containers = await api("GET", "/containers");
+    renderContainers();
+  }
+
+  function copyButton(url) {
+    const button = element("button", "Copy", "small");
+    button.type = "button";
+    button.addEventListener("click", async () => {
+      try {
+        await navigator.clipboard.writeText(url);
+        showMessage("Copied " + url, false);
+      } catch (e) {
+        showMessage("Could not copy the URL: " + e.message, true);
+      }
+    });
+    return button;
+  }
+
+  function triggerButton(webhook) {
+    const button = element("button", "Trigger " + webhook.action, "small");
+    button.type = "button";
+    button.addEventListener("click", async () => {
+      if (!window.confirm("Run " + webhook.action + " on " + webhook.containerName + "?")) {
+        return;
+      }
+
+      button.disabled = true;
+      showMessage("Running " + webhook.action + " on " + webhook.containerName + "...", false);
+      try {
+        const result = await api("POST", "/webhooks/" + encodeURIComponent(webhook.uuid));
+        showMessage(result.action + " finished for " + result.container, false);
+      } catch (e) {
+        showMessage(webhook.action + " failed: " + e.message, true);
+      } finally {
+        button.disabled = false;
+      }
+    });
+    return button;
+  }
+
+  async function loadWebhooks() {
+    const webhooks = await api("GET", "/webhooks");
+    fill("webhooks", webhooks.map((webhook) => {
+      const url = window.location.origin + webhook.url;
+      const link = element("code", url);
+      const actions = element("span");
+      actions.appendChild(copyButton(url));
+      if (webhook.canTrigger) {
+        actions.appendChild(triggerButton(webhook));
+      }
+      return row([webhook.containerName || webhook.containerId, webhook.host, webhook.action, link, actions]);
+    }), "No webhooks");
+  }
+
+  function result(entry) {
+    const label = entry.result + (entry.error ? ": " + entry.error : "");
+    return element("span", label, entry.result === "success" ? "ok" : "failure");
+  }
+
+  async function loadJobs() {
+    const jobs = await api("GET", "/jobs?limit=100");
+    fill("jobs", jobs.reverse().map((job) => row([
+      formatTime(job.time),
+      job.webhook,
+      job.action,
+      job.container,
+      job.host,
+      job.user || job.token,
+      result(job),
+      job.durationMs !== undefined ? job.durationMs + " ms" : "",
+    ])), "No jobs");
+  }
+
+  async function loadAudit() {
+    const entries = await api("GET", "/audit?limit=100");
+    fill("audit", entries.reverse().map((entry) => row([
+      formatTime(entry.time),
+      entry.event,
+      entry.user || entry.token,
+      entry.target || entry.webhook,
+      entry.ip,
+      result(entry),
+    ])), "No entries");
+  }
+
+  const loaders = {
+    hosts: loadHosts,
+    containers: loadContainers,
+    webhooks: loadWebhooks,
+    jobs: loadJobs,
+    audit: loadAudit,
+  };
+
+  function currentTab() {
+    const tab = window.location.hash.slice(1);
+    if (loaders[tab] && !document.querySelector('[data-tab="' + tab + '"]').hidden) {
+      return tab;
+    }
+    return can("read") ? "hosts" : "webhooks";
+  }
+
+  async function refresh() {
+    const tab = currentTab();
+    for (const section of document.querySelectorAll("section.tab")) {
+      section.hidden = section.id !== tab;
+    }
+    for (const link of document.querySelectorAll("#tabs a")) {
+      link.classList.toggle("active", link.dataset.tab === tab);
+    }
+
+    try {
+      await loaders[tab]();
+    } catch (e) {
+      if (e.status === 401) {
+        showLogin();
+        return;
+      }
+      showMessage(e.message, true);
+    }
+  }
+
+  // watch refreshes the open tab shortly after container events and webhook actions
+  function watch() {
+    if (stream !== null || typeof EventSource === "undefined") {
+      return;
+    }
+
+    stream = new EventSource(base + "/api/v1/events");
+    stream.onmessage = () => {
+      clearTimeout(pending);
+      pending = setTimeout(refresh, 500);
+    };
+  }
+
+  function showLogin() {
+    clearInterval(timer);
+    if (stream !== null) {
+      stream.close();
+      stream = null;
+    }
+    me = null;
+    document.getElementById("tabs").hidden = true;
+    document.getElementById("logout").hidden = true;
+    document.getElementById("user").textContent = "";
+    for (const section of document.querySelectorAll("section.tab")) {
+      section.hidden = true;
+    }
+
+    document.getElementById("login").hidden = false;
+    if (provider === "simple") {
+      document.getElementById("login-form").hidden = false;
+    } else if (provider === "oidc") {
+      const link = document.getElementById("oidc-login");
+      link.href = base + "/api/oidc/login";
+      link.hidden = false;
+    } else {
+      showMessage("You are not authenticated. Reload the page to enter your credentials.", true);
+    }
+  }
+
+  async function start() {
+    try {
+      me = await api("GET", "/me");
+    } catch (e) {
+      if (e.status === 401) {
+        showLogin();
+        return;
+      }
+      showMessage(e.message, true);
+      return;
+    }
+
+    document.getElementById("login").hidden = true;
+    document.getElementById("tabs").hidden = false;
+    document.getElementById("user").textContent = me.name || me.username || "";
+    document.getElementById("logout").hidden = provider !== "simple" && provider !== "oidc";
+
+    const readable = can("read");
+    for (const tab of ["hosts", "containers"]) {
+      document.querySelector('[data-tab="' + tab + '"]').hidden = !readable;
+    }
+    document.querySelector('[data-tab="audit"]').hidden = provider === "none" || !can("manage");
+
+    await refresh();
+    clearInterval(timer);
+    timer = setInterval(refresh, refreshInterval);
+    if (readable) {
+      watch();
+    }
+  }
+
+  document.getElementById("login-form").addEventListener("submit", async (event) => {
+    event.preventDefault();
+    showMessage("", false);
+    try {
+      await api("POST", "/token", new FormData(event.target));
+      event.target.reset();
+      document.getElementById("otp").hidden = true;
+      await start();
+    } catch (e) {
+      if (e.code === "second_factor_required") {
+        document.getElementById("otp").hidden = false;
+      }
+      showMessage(e.message, true);
+    }
+  });
+
+  document.getElementById("logout").addEventListener("click", async () => {
+    try {
+      await api("DELETE", "/token");
+    } catch (e) {
+      showMessage(e.message, true);
+      return;
+    }
+    showLogin();
+  });
+
+  document.getElementById("container-filter").addEventListener("input", renderContainers);
+  window.addEventListener("hashchange", () => {
+    showMessage("", false);
+    refresh();
+  });
+
+  start();
+})();
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	myErrors "github.com/kekaadrenalin/dockhook/pkg/errors"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/kekaadrenalin/dockhook/pkg/user"
+	"github.com/kekaadrenalin/dockhook/pkg/webhook"
+)
+
+// webhookSummary describes a webhook without its registry credentials
+type webhookSummary struct {
+	UUID          string                `json:"uuid"`
+	ContainerID   string                `json:"containerId,omitempty"`
+	ContainerName string                `json:"containerName,omitempty"`
+	Host          string                `json:"host,omitempty"`
+	Action        types.ContainerAction `json:"action"`
+	Created       time.Time             `json:"created"`
+	URL           string                `json:"url"`
+	CanTrigger    bool                  `json:"canTrigger"`
+}
+
+func readWebhooks() (webhook.WebhooksDatabase, error) {
+	path, err := filepath.Abs("./data/webhooks.yml")
+	if err != nil {
+		log.Fatalf("Could not find absolute path to webhooks.yml file: %s", err)
+	}
+
+	return webhook.ReadWebhooksFromFile(path)
+}
+
+// listWebhooks returns every webhook to readers and only the webhooks they may trigger to other users
+func (h *handler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	summaries, err := h.visibleWebhooks(r)
+	if err != nil {
+		logFromRequest(r).Errorf("Error while reading webhooks: %v", err)
+		writeError(w, r, myErrors.New(http.StatusInternalServerError, myErrors.CodeInternal, http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	writeData(w, r, http.StatusOK, summaries)
+}
+
+func (h *handler) visibleWebhooks(r *http.Request) ([]webhookSummary, error) {
+	webhooks, err := readWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := h.authorize(r, func(u *user.User) bool { return u.Can(user.PermissionRead) })
+	scope, err := h.readScopeFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]webhookSummary, 0, len(webhooks.Webhooks))
+	for _, item := range webhooks.Webhooks {
+		canTrigger := h.authorize(r, func(u *user.User) bool { return u.CanTrigger(item) })
+		if token := user.TokenFromContext(r.Context()); token != nil && !token.Scope.Allows(item) {
+			canTrigger = false
+		}
+
+		if (!reader && !canTrigger) || !scope.allowsContainer(item.Host, item.ContainerId, item.ContainerName) {
+			continue
+		}
+
+		summaries = append(summaries, webhookSummary{
+			UUID:          item.UUID,
+			ContainerID:   item.ContainerId,
+			ContainerName: item.ContainerName,
+			Host:          item.Host,
+			Action:        item.Action,
+			Created:       item.Created,
+			URL:           path.Join(h.config.Base, "api/v1/webhooks", item.UUID),
+			CanTrigger:    canTrigger,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Created.Before(summaries[j].Created)
+	})
+
+	return summaries, nil
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 var (
 	Version = "head"
 )
@@ -8,33 +10,172 @@ type Args struct {
 	Addr                 string              `arg:"env:DOCKHOOK_ADDR" default:":8080" help:"sets host:port to bind for server. This is rarely needed inside a docker container."`
 	Base                 string              `arg:"env:DOCKHOOK_BASE" default:"/" help:"sets the base for http router."`
 	Hostname             string              `arg:"env:DOCKHOOK_HOSTNAME" help:"sets the hostname for display. This is useful with multiple DockHook instances."`
-	AuthProvider         string              `arg:"--auth-provider,env:DOCKHOOK_AUTH_PROVIDER" default:"basic" help:"sets the auth provider to use. Currently only simple and basic is supported."`
+	AuthProvider         string              `arg:"--auth-provider,env:DOCKHOOK_AUTH_PROVIDER" default:"basic" help:"sets the auth provider to use: none, simple, basic, oidc, forward-proxy, ldap or mtls."`
 	Level                string              `arg:"env:DOCKHOOK_LEVEL" default:"info" help:"set DockHook log level. Use debug for more logging."`
+	LogFormat            string              `arg:"--log-format,env:DOCKHOOK_LOG_FORMAT" default:"text" help:"sets the log format: text or json."`
+	Readiness            string              `arg:"--readiness,env:DOCKHOOK_READINESS" default:"all" help:"sets when /readyz reports ready: all when every Docker host is reachable, any when one is."`
 	WaitForDockerSeconds int                 `arg:"--wait-for-docker-seconds,env:DOCKHOOK_WAIT_FOR_DOCKER_SECONDS" help:"wait for docker to be available for at most this many seconds before starting the server."`
 	FilterStrings        []string            `arg:"env:DOCKHOOK_FILTER,--filter,separate" help:"filters docker containers using Docker syntax."`
 	Filter               map[string][]string `arg:"-"`
 	RemoteHost           []string            `arg:"env:DOCKHOOK_REMOTE_HOST,--remote-host,separate" help:"list of hosts to connect remotely"`
+	SSHKey               string              `arg:"--ssh-key,env:DOCKHOOK_SSH_KEY" help:"sets the private key for ssh:// remote hosts. Defaults to the keys of the agent at SSH_AUTH_SOCK."`
+	SSHKnownHosts        string              `arg:"--ssh-known-hosts,env:DOCKHOOK_SSH_KNOWN_HOSTS" help:"sets the known_hosts file used to verify ssh:// remote hosts. Defaults to ~/.ssh/known_hosts."`
+	TrustedProxies       []string            `arg:"--trusted-proxy,env:DOCKHOOK_TRUSTED_PROXIES,separate" help:"list of reverse proxy addresses or CIDRs allowed to pass client identities and addresses."`
+	ForwardUserHeader    string              `arg:"--forward-user-header,env:DOCKHOOK_FORWARD_USER_HEADER" default:"Remote-User" help:"sets the header holding the username for the forward-proxy auth provider."`
+	ForwardEmailHeader   string              `arg:"--forward-email-header,env:DOCKHOOK_FORWARD_EMAIL_HEADER" default:"Remote-Email" help:"sets the header holding the email for the forward-proxy auth provider."`
+	ForwardNameHeader    string              `arg:"--forward-name-header,env:DOCKHOOK_FORWARD_NAME_HEADER" default:"Remote-Name" help:"sets the header holding the display name for the forward-proxy auth provider."`
+	ForwardGroupsHeader  string              `arg:"--forward-groups-header,env:DOCKHOOK_FORWARD_GROUPS_HEADER" default:"Remote-Groups" help:"sets the header holding comma-separated groups for the forward-proxy auth provider."`
+	GroupRoles           []string            `arg:"env:DOCKHOOK_GROUP_ROLES,--group-role,separate" help:"maps an identity provider group to a role or grant, e.g. ops=operator, ci=webhook:<uuid> or an LDAP group DN such as cn=ops,ou=groups,dc=example,dc=org=operator"`
+	OIDCIssuer           string              `arg:"--oidc-issuer,env:DOCKHOOK_OIDC_ISSUER" help:"sets the OpenID Connect issuer URL for the oidc auth provider."`
+	OIDCClientID         string              `arg:"--oidc-client-id,env:DOCKHOOK_OIDC_CLIENT_ID" help:"sets the OpenID Connect client id."`
+	OIDCClientSecret     string              `arg:"--oidc-client-secret,env:DOCKHOOK_OIDC_CLIENT_SECRET" help:"sets the OpenID Connect client secret."`
+	OIDCRedirectURL      string              `arg:"--oidc-redirect-url,env:DOCKHOOK_OIDC_REDIRECT_URL" help:"sets the public URL of <base>/api/oidc/callback."`
+	OIDCScopes           []string            `arg:"--oidc-scope,env:DOCKHOOK_OIDC_SCOPES,separate" help:"sets the requested scopes. Defaults to openid, profile and email."`
+	OIDCAudience         string              `arg:"--oidc-audience,env:DOCKHOOK_OIDC_AUDIENCE" help:"sets the audience expected in client-credentials bearer tokens. Defaults to the client id."`
+	OIDCUsernameClaim    string              `arg:"--oidc-username-claim,env:DOCKHOOK_OIDC_USERNAME_CLAIM" default:"sub" help:"sets the claim used as username."`
+	OIDCLocalUserClaim   string              `arg:"--oidc-local-user-claim,env:DOCKHOOK_OIDC_LOCAL_USER_CLAIM" help:"sets the claim matched against users in users.yml, whose roles and grants are kept. Users are not matched when unset."`
+	OIDCGroupsClaim      string              `arg:"--oidc-groups-claim,env:DOCKHOOK_OIDC_GROUPS_CLAIM" default:"groups" help:"sets the claim holding the user's groups."`
+	LDAPURL              string              `arg:"--ldap-url,env:DOCKHOOK_LDAP_URL" help:"sets the LDAP server URL for the ldap auth provider, e.g. ldaps://ldap.example.org."`
+	LDAPStartTLS         bool                `arg:"--ldap-start-tls,env:DOCKHOOK_LDAP_START_TLS" help:"upgrades ldap:// connections with StartTLS."`
+	LDAPSkipVerify       bool                `arg:"--ldap-insecure-skip-verify,env:DOCKHOOK_LDAP_INSECURE_SKIP_VERIFY" help:"disables verification of the LDAP server certificate."`
+	LDAPBindDN           string              `arg:"--ldap-bind-dn,env:DOCKHOOK_LDAP_BIND_DN" help:"sets the service account used to search for users."`
+	LDAPBindPassword     string              `arg:"--ldap-bind-password,env:DOCKHOOK_LDAP_BIND_PASSWORD" help:"sets the password of the LDAP service account."`
+	LDAPBaseDN           string              `arg:"--ldap-base-dn,env:DOCKHOOK_LDAP_BASE_DN" help:"sets the base DN of user searches."`
+	LDAPUserFilter       string              `arg:"--ldap-user-filter,env:DOCKHOOK_LDAP_USER_FILTER" default:"(uid=%s)" help:"sets the filter used to find a user, use (sAMAccountName=%s) for Active Directory."`
+	LDAPUserDN           string              `arg:"--ldap-user-dn,env:DOCKHOOK_LDAP_USER_DN" help:"binds directly as this DN when no service account is set, e.g. uid=%s,ou=people,dc=example,dc=org."`
+	LDAPEmailAttribute   string              `arg:"--ldap-email-attribute,env:DOCKHOOK_LDAP_EMAIL_ATTRIBUTE" default:"mail" help:"sets the attribute holding the user's email."`
+	LDAPNameAttribute    string              `arg:"--ldap-name-attribute,env:DOCKHOOK_LDAP_NAME_ATTRIBUTE" default:"cn" help:"sets the attribute holding the user's display name."`
+	LDAPGroupAttribute   string              `arg:"--ldap-group-attribute,env:DOCKHOOK_LDAP_GROUP_ATTRIBUTE" default:"memberOf" help:"sets the attribute holding the user's group DNs."`
+	LDAPCacheTTL         time.Duration       `arg:"--ldap-cache-ttl,env:DOCKHOOK_LDAP_CACHE_TTL" default:"1m" help:"sets how long a successful login is cached. Set to 0 to disable."`
+	TLSCert              string              `arg:"--tls-cert,env:DOCKHOOK_TLS_CERT" help:"serves HTTPS with this PEM certificate, reloaded when it changes."`
+	TLSKey               string              `arg:"--tls-key,env:DOCKHOOK_TLS_KEY" help:"sets the PEM private key of the TLS certificate."`
+	HTTPRedirectAddr     string              `arg:"--http-redirect-addr,env:DOCKHOOK_HTTP_REDIRECT_ADDR" help:"redirects plain HTTP requests on this host:port to HTTPS, e.g. :80."`
+	TLSClientCA          string              `arg:"--tls-client-ca,env:DOCKHOOK_TLS_CLIENT_CA" help:"verifies client certificates against the PEM CA certificates in this file."`
+	MTLSUsers            []string            `arg:"--mtls-user,env:DOCKHOOK_MTLS_USERS,separate" help:"maps a certificate identity to a user, e.g. cn:ci-runner=deployer or uri:spiffe://example.org/ci=deployer"`
+	MTLSBasicFallback    bool                `arg:"--mtls-basic-fallback,env:DOCKHOOK_MTLS_BASIC_FALLBACK" help:"accepts basic auth from users.yml for requests without a client certificate."`
+	SessionTTL           time.Duration       `arg:"--session-ttl,env:DOCKHOOK_SESSION_TTL" default:"12h" help:"sets the lifetime of a login session token."`
+	SessionMaxAge        time.Duration       `arg:"--session-max-age,env:DOCKHOOK_SESSION_MAX_AGE" default:"168h" help:"sets how long a session can be refreshed before logging in again."`
+	CookieDomain         string              `arg:"--cookie-domain,env:DOCKHOOK_COOKIE_DOMAIN" help:"sets the domain of the session cookie."`
+	CookiePath           string              `arg:"--cookie-path,env:DOCKHOOK_COOKIE_PATH" help:"sets the path of the session cookie. Defaults to the base."`
+	CookieSecure         bool                `arg:"--cookie-secure,env:DOCKHOOK_COOKIE_SECURE" help:"marks the session cookie as Secure, always done when serving HTTPS."`
+	TrustedOrigins       []string            `arg:"--trusted-origin,env:DOCKHOOK_TRUSTED_ORIGINS,separate" help:"list of origins besides this server allowed to send state-changing requests with the session cookie, e.g. https://admin.example.org"`
+	MetricsToken         string              `arg:"--metrics-token,env:DOCKHOOK_METRICS_TOKEN" help:"serves Prometheus metrics at <base>/metrics to callers with this bearer token."`
+	MetricsAllow         []string            `arg:"--metrics-allow,env:DOCKHOOK_METRICS_ALLOW,separate" help:"serves Prometheus metrics at <base>/metrics to these addresses or CIDRs."`
+	MetricsStats         time.Duration       `arg:"--metrics-stats-interval,env:DOCKHOOK_METRICS_STATS_INTERVAL" help:"samples CPU, memory, network and block I/O of running containers for the metrics at this interval, e.g. 30s."`
+	LockoutMaxFailures   int                 `arg:"--lockout-max-failures,env:DOCKHOOK_LOCKOUT_MAX_FAILURES" default:"5" help:"sets the number of failed logins from one address that blocks a user."`
+	LockoutBaseDelay     time.Duration       `arg:"--lockout-base-delay,env:DOCKHOOK_LOCKOUT_BASE_DELAY" default:"1m" help:"sets the first lockout, doubled for each following one."`
+	LockoutMaxDelay      time.Duration       `arg:"--lockout-max-delay,env:DOCKHOOK_LOCKOUT_MAX_DELAY" default:"1h" help:"sets the longest lockout."`
+	LockoutWindow        time.Duration       `arg:"--lockout-window,env:DOCKHOOK_LOCKOUT_WINDOW" default:"15m" help:"forgets failed logins and lockouts after this quiet period."`
 
-	HealthcheckCmd   *HealthcheckCmd   `arg:"subcommand:command" help:"checks if the server is running"`
+	HealthcheckCmd   *HealthcheckCmd   `arg:"subcommand:healthcheck" help:"checks if the server is ready, for container health checks"`
+	CommandCmd       *HealthcheckCmd   `arg:"subcommand:command" help:"deprecated alias of healthcheck, kept for existing health checks"`
 	CreateUserCmd    *CreateUserCmd    `arg:"subcommand:create-user" help:"creates a new user and saves it in configuration file for simple auth"`
+	ListUsersCmd     *ListUsersCmd     `arg:"subcommand:list-users" help:"lists users"`
+	UpdateUserCmd    *UpdateUserCmd    `arg:"subcommand:update-user" help:"changes the name, email, roles or grants of a user"`
+	SetPasswordCmd   *SetPasswordCmd   `arg:"subcommand:set-password" help:"changes the password of a user, read from a prompt or stdin"`
+	DeleteUserCmd    *DeleteUserCmd    `arg:"subcommand:delete-user" help:"deletes a user and revokes their API tokens"`
+	EnableTOTPCmd    *EnableTOTPCmd    `arg:"subcommand:enable-totp" help:"enrolls a user in TOTP two-factor authentication"`
+	DisableTOTPCmd   *DisableTOTPCmd   `arg:"subcommand:disable-totp" help:"removes the TOTP second factor of a user"`
 	CreateWebhookCmd *CreateWebhookCmd `arg:"subcommand:create-webhook" help:"creates a new webhook and saves it in configuration file"`
+	CreateTokenCmd   *CreateTokenCmd   `arg:"subcommand:create-token" help:"creates a new API token for a user"`
+	ListTokensCmd    *ListTokensCmd    `arg:"subcommand:list-tokens" help:"lists API tokens"`
+	RevokeTokenCmd   *RevokeTokenCmd   `arg:"subcommand:revoke-token" help:"revokes an API token"`
+	RotateKeyCmd     *RotateKeyCmd     `arg:"subcommand:rotate-session-key" help:"generates a new key for signing session tokens"`
+	ListLockoutsCmd  *ListLockoutsCmd  `arg:"subcommand:list-lockouts" help:"lists blocked users"`
+	UnblockCmd       *UnblockCmd       `arg:"subcommand:unblock" help:"removes the lockouts of a user"`
+	AuditCmd         *AuditCmd         `arg:"subcommand:audit" help:"shows or verifies the audit log"`
 }
 
 type HealthcheckCmd struct {
 }
 
 type CreateUserCmd struct {
-	Username    string `arg:"positional"`
-	Password    string `arg:"--password, -p" help:"sets the password for the user"`
-	Name        string `arg:"--name, -n" help:"sets the display name for the user"`
-	Email       string `arg:"--email, -e" help:"sets the email for the user"`
-	WithoutSave bool   `arg:"--without-save, -w" help:"don't save the user to file"`
+	Username    string   `arg:"positional"`
+	Password    string   `arg:"--password, -p" help:"sets the password for the user, prompted for when omitted"`
+	Name        string   `arg:"--name, -n" help:"sets the display name for the user"`
+	Email       string   `arg:"--email, -e" help:"sets the email for the user"`
+	Roles       []string `arg:"--role,separate" help:"grants a role to the user: admin, operator or read-only"`
+	Webhooks    []string `arg:"--webhook,separate" help:"allows the user to trigger a webhook UUID"`
+	Hosts       []string `arg:"--host,separate" help:"allows the user to trigger every webhook on a host"`
+	WithoutSave bool     `arg:"--without-save, -w" help:"don't save the user to file"`
+}
+
+type ListUsersCmd struct {
+}
+
+type UpdateUserCmd struct {
+	Username      string   `arg:"positional,required" help:"user to update"`
+	Name          *string  `arg:"--name, -n" help:"sets the display name for the user"`
+	Email         *string  `arg:"--email, -e" help:"sets the email for the user"`
+	Roles         []string `arg:"--role,separate" help:"replaces the roles of the user: admin, operator or read-only"`
+	Webhooks      []string `arg:"--webhook,separate" help:"replaces the webhook UUIDs the user may trigger"`
+	Hosts         []string `arg:"--host,separate" help:"replaces the hosts the user may trigger every webhook on"`
+	ClearRoles    bool     `arg:"--clear-roles" help:"removes all roles of the user"`
+	ClearWebhooks bool     `arg:"--clear-webhooks" help:"removes all webhook grants of the user"`
+	ClearHosts    bool     `arg:"--clear-hosts" help:"removes all host grants of the user"`
+}
+
+type SetPasswordCmd struct {
+	Username string `arg:"positional,required" help:"user to change the password of"`
+}
+
+type DeleteUserCmd struct {
+	Username string `arg:"positional,required" help:"user to delete"`
+}
+
+type EnableTOTPCmd struct {
+	Username string `arg:"positional,required" help:"user to enroll"`
+	Issuer   string `arg:"--issuer" default:"DockHook" help:"name shown in authenticator apps"`
+}
+
+type DisableTOTPCmd struct {
+	Username string `arg:"positional,required" help:"user to remove the second factor of"`
 }
 
 type CreateWebhookCmd struct {
 	DockerComposeOnly bool `arg:"--docker-compose-only, -o" help:"find only docker compose container'"`
 }
 
+type CreateTokenCmd struct {
+	Username  string        `arg:"positional" help:"owner of the token"`
+	Name      string        `arg:"--name, -n" help:"sets a description for the token"`
+	Webhooks  []string      `arg:"--webhook,separate" help:"restricts the token to a webhook UUID"`
+	Hosts     []string      `arg:"--host,separate" help:"restricts the token to a host"`
+	Actions   []string      `arg:"--action,separate" help:"restricts the token to an action"`
+	ExpiresIn time.Duration `arg:"--expires-in" default:"2160h" help:"sets the lifetime of the token"`
+}
+
+type ListTokensCmd struct {
+	Username string `arg:"positional" help:"lists only the tokens of this user"`
+}
+
+type RevokeTokenCmd struct {
+	ID string `arg:"positional,required" help:"ID of the token"`
+}
+
+type RotateKeyCmd struct {
+	RevokePrevious bool `arg:"--revoke-previous" help:"drops previous keys right away, ending all sessions"`
+}
+
+type ListLockoutsCmd struct {
+}
+
+type UnblockCmd struct {
+	Username string `arg:"positional,required" help:"user to unblock"`
+	IP       string `arg:"--ip" help:"unblocks only this client address"`
+}
+
+type AuditCmd struct {
+	Webhook string `arg:"--webhook" help:"shows only calls of this webhook UUID"`
+	User    string `arg:"--user" help:"shows only entries by or about this user"`
+	Host    string `arg:"--host" help:"shows only entries of this host"`
+	Since   string `arg:"--since" help:"shows entries from this RFC 3339 time or duration ago, e.g. 24h"`
+	Until   string `arg:"--until" help:"shows entries up to this RFC 3339 time or duration ago"`
+	Limit   int    `arg:"--limit" help:"shows only the newest entries"`
+	JSON    bool   `arg:"--json" help:"prints the entries as JSON lines"`
+	Verify  bool   `arg:"--verify" help:"checks that the audit log was not modified"`
+}
+
 func (Args) Version() string {
 	return Version
 }
@@ -5,19 +5,42 @@ import (
 	"errors"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
 	"github.com/puzpuzpuz/xsync/v3"
 )
 
+// Waits between attempts to reconnect to a Docker host
+const (
+	reconnectMinWait = time.Second
+	reconnectMaxWait = time.Minute
+)
+
+// ConnectionState describes the connection of a store to its Docker host
+type ConnectionState struct {
+	Connected bool `json:"connected"`
+	// Since is the time of the last connect or disconnect
+	Since time.Time `json:"since"`
+	// Attempts counts the failed attempts since the host was last connected
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"lastError,omitempty"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+}
+
 type ContainerStore struct {
 	containers              *xsync.MapOf[string, *Container]
 	subscribers             *xsync.MapOf[context.Context, chan ContainerEvent]
 	newContainerSubscribers *xsync.MapOf[context.Context, chan Container]
 	client                  Client
-	wg                      sync.WaitGroup
+	ready                   chan struct{}
+	readyOnce               sync.Once
 	connected               atomic.Bool
+	state                   ConnectionState
+	stateMu                 sync.RWMutex
+	retry                   chan struct{}
 	events                  chan ContainerEvent
 	ctx                     context.Context
 }
@@ -28,56 +51,164 @@ func NewContainerStore(ctx context.Context, client Client) *ContainerStore {
 		client:                  client,
 		subscribers:             xsync.NewMapOf[context.Context, chan ContainerEvent](),
 		newContainerSubscribers: xsync.NewMapOf[context.Context, chan Container](),
-		wg:                      sync.WaitGroup{},
+		ready:                   make(chan struct{}),
+		state:                   ConnectionState{Since: time.Now()},
+		retry:                   make(chan struct{}, 1),
 		events:                  make(chan ContainerEvent),
 		ctx:                     ctx,
 	}
 
-	s.wg.Add(1)
-
+	go s.supervise()
 	go s.init()
 
 	return s
 }
 
-func (s *ContainerStore) checkConnectivity() error {
-	if s.connected.CompareAndSwap(false, true) {
-		go func() {
-			log.Debugf("subscribing to docker events from container store %+v", s.client.Host())
-			err := s.client.Events(s.ctx, s.events)
-			if !errors.Is(err, context.Canceled) {
-				log.Errorf("docker store unexpectedly disconnected from docker events from %+v with %v", s.client.Host(), err)
-			}
-			s.connected.Store(false)
-		}()
+// supervise keeps the store subscribed to Docker events and reloads the containers after every reconnect,
+// waiting longer after each failed attempt
+func (s *ContainerStore) supervise() {
+	for {
+		err := s.connect()
+		s.readyOnce.Do(func() { close(s.ready) })
 
-		containers, err := s.client.ListContainers()
-		if err != nil {
-			return err
+		if s.ctx.Err() != nil {
+			return
 		}
 
-		s.containers.Clear()
-		for _, c := range containers {
-			s.containers.Store(c.ID, &c)
+		timer := time.NewTimer(s.disconnected(err))
+
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-s.retry:
+			timer.Stop()
+		case <-timer.C:
 		}
 	}
+}
+
+// connect reloads the containers and returns once the event stream ends
+func (s *ContainerStore) connect() error {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	log.Debugf("subscribing to docker events from container store %+v", s.client.Host())
+	stream := make(chan error, 1)
+	go func() {
+		stream <- s.client.Events(ctx, s.events)
+	}()
+
+	containers, err := s.client.ListContainers()
+	if err != nil {
+		return err
+	}
+
+	s.containers.Clear()
+	for _, c := range containers {
+		s.containers.Store(c.ID, &c)
+	}
+
+	s.setConnected()
+	s.readyOnce.Do(func() { close(s.ready) })
 
-	return nil
+	select {
+	case err = <-stream:
+	case <-s.ctx.Done():
+		return nil
+	}
+
+	if err == nil {
+		err = errors.New("event stream closed")
+	}
+
+	return err
 }
 
+func (s *ContainerStore) setConnected() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.state.Attempts > 0 || !s.state.Connected {
+		log.Infof("connected to docker host %s", s.client.Host().Name)
+	}
+
+	s.connected.Store(true)
+	s.state = ConnectionState{Connected: true, Since: time.Now()}
+}
+
+// disconnected records a failed connection and returns the wait before the next attempt
+func (s *ContainerStore) disconnected(err error) time.Duration {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.state.Connected {
+		log.Errorf("docker store unexpectedly disconnected from docker events from %+v with %v", s.client.Host(), err)
+		s.state = ConnectionState{Since: time.Now()}
+	} else {
+		log.Warnf("could not connect to docker host %s: %v", s.client.Host().Name, err)
+	}
+
+	s.connected.Store(false)
+	s.state.Attempts++
+	s.state.LastError = err.Error()
+
+	wait := helper.Backoff(s.state.Attempts, reconnectMinWait, reconnectMaxWait)
+	next := time.Now().Add(wait)
+	s.state.NextAttempt = &next
+
+	return wait
+}
+
+// List returns the containers after the first connection attempt; while the host is not connected they are
+// requested directly and the next reconnect is not waited for
 func (s *ContainerStore) List() ([]Container, error) {
-	s.wg.Wait()
+	<-s.ready
 
-	if err := s.checkConnectivity(); err != nil {
-		return nil, err
+	if !s.IsConnected() {
+		containers, err := s.client.ListContainers()
+		if err != nil {
+			return nil, err
+		}
+
+		s.Reconnect()
+
+		return containers, nil
 	}
+
+	return s.Containers(), nil
+}
+
+// Containers returns the known containers without waiting for or checking the connection
+func (s *ContainerStore) Containers() []Container {
 	containers := make([]Container, 0)
 	s.containers.Range(func(_ string, c *Container) bool {
 		containers = append(containers, *c)
 		return true
 	})
 
-	return containers, nil
+	return containers
+}
+
+// IsConnected reports whether the store receives events from the Docker host
+func (s *ContainerStore) IsConnected() bool {
+	return s.connected.Load()
+}
+
+// State returns the connection state of the store
+func (s *ContainerStore) State() ConnectionState {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+
+	return s.state
+}
+
+// Reconnect skips the wait before the next connection attempt
+func (s *ContainerStore) Reconnect() {
+	select {
+	case s.retry <- struct{}{}:
+	default:
+	}
 }
 
 func (s *ContainerStore) Client() Client {
@@ -96,14 +227,8 @@ func (s *ContainerStore) SubscribeNewContainers(ctx context.Context, containers
 	s.newContainerSubscribers.Store(ctx, containers)
 }
 
+// init applies the events of the Docker host to the containers and passes them on to the subscribers
 func (s *ContainerStore) init() {
-	err := s.checkConnectivity()
-	if err != nil {
-		panic(any(err))
-	}
-
-	s.wg.Done()
-
 	for {
 		select {
 		case event := <-s.events:
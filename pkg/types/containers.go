@@ -25,9 +25,54 @@ type Container struct {
 
 // ContainerEvent represents events that are triggered
 type ContainerEvent struct {
-	ActorID string `json:"actorId"`
-	Name    string `json:"name"`
-	Host    string `json:"host"`
+	ActorID string    `json:"actorId"`
+	Name    string    `json:"name"`
+	Host    string    `json:"host"`
+	Time    time.Time `json:"time"`
+	// Attributes of the actor, such as the container name, image and labels
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// LogEntry is a line of container output
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Stream  string    `json:"stream"`
+	Message string    `json:"message"`
+}
+
+// ContainerStats is a resource usage sample of a container, computed the way `docker stats` does
+type ContainerStats struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Host          string    `json:"host,omitempty"`
+	Time          time.Time `json:"time"`
+	CPUPercent    float64   `json:"cpuPercent"`
+	MemoryUsage   uint64    `json:"memoryUsage"`
+	MemoryLimit   uint64    `json:"memoryLimit"`
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetworkRx     uint64    `json:"networkRx"`
+	NetworkTx     uint64    `json:"networkTx"`
+	BlockRead     uint64    `json:"blockRead"`
+	BlockWrite    uint64    `json:"blockWrite"`
+	PIDs          uint64    `json:"pids"`
+}
+
+// HostStats sums the stats of the running containers of a host
+type HostStats struct {
+	Host          string           `json:"host"`
+	Time          time.Time        `json:"time"`
+	Containers    int              `json:"containers"`
+	CPUs          int              `json:"cpus"`
+	CPUPercent    float64          `json:"cpuPercent"`
+	MemoryUsage   uint64           `json:"memoryUsage"`
+	MemoryTotal   uint64           `json:"memoryTotal"`
+	MemoryPercent float64          `json:"memoryPercent"`
+	NetworkRx     uint64           `json:"networkRx"`
+	NetworkTx     uint64           `json:"networkTx"`
+	BlockRead     uint64           `json:"blockRead"`
+	BlockWrite    uint64           `json:"blockWrite"`
+	PIDs          uint64           `json:"pids"`
+	Stats         []ContainerStats `json:"stats"`
 }
 
 type ContainerAction string
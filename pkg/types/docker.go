@@ -41,6 +41,8 @@ type Client interface {
 	ContainerLogs(context.Context, string, *time.Time, StdType) (io.ReadCloser, error)
 	Events(context.Context, chan<- ContainerEvent) error
 	ContainerLogsBetweenDates(context.Context, string, time.Time, time.Time, StdType) (io.ReadCloser, error)
+	ContainerLogsWithOptions(context.Context, string, LogOptions) (io.ReadCloser, error)
+	ContainerStats(context.Context, string, bool, chan<- ContainerStats) error
 	Ping(context.Context) (types.Ping, error)
 	Host() *Host
 	ContainerActions(webhook *Webhook) (*Container, *myErrors.HTTPError)
@@ -58,6 +60,15 @@ const (
 )
 const STDALL = STDOUT | STDERR
 
+// LogOptions selects container logs; zero times are unbounded and an empty Tail returns every line
+type LogOptions struct {
+	Since   time.Time
+	Until   time.Time
+	Tail    string
+	Follow  bool
+	StdType StdType
+}
+
 func (s StdType) String() string {
 	switch s {
 	case STDOUT:
@@ -79,6 +90,8 @@ type Host struct {
 	CACertPath string   `json:"-"`
 	KeyPath    string   `json:"-"`
 	ValidCerts bool     `json:"-"`
+	SSHKey     string   `json:"-"`
+	KnownHosts string   `json:"-"`
 	NCPU       int      `json:"nCPU"`
 	MemTotal   int64    `json:"memTotal"`
 }
@@ -2,32 +2,41 @@ package user
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
-	"fmt"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
+)
 
-	log "github.com/sirupsen/logrus"
+// basicAuthCacheTTL is how long verified credentials skip the password hash, which costs 19 MiB and tens of
+// milliseconds on every request otherwise
+const basicAuthCacheTTL = time.Minute
 
-	"golang.org/x/time/rate"
-)
+type basicAuthCacheEntry struct {
+	// passwordHash is the stored hash the credentials were verified against, so that a new password misses the cache
+	passwordHash string
+	expires      time.Time
+}
 
 type basicAuthContext struct {
-	UsersDatabase UsersDatabase
-	rateLimiter   map[string]*rate.Limiter
-	blockedUsers  map[string]time.Time
-	failureCount  map[string]int64
-	mu            sync.Mutex
+	UsersDatabase *UsersDatabase
+	Lockouts      *LockoutsDatabase
+	// cache is keyed by a hash of username and password and never holds either
+	cache map[[sha256.Size]byte]basicAuthCacheEntry
+	mu    sync.Mutex
 }
 
-func NewBasicAuth(userDatabase UsersDatabase) *basicAuthContext {
+func NewBasicAuth(userDatabase *UsersDatabase, lockouts *LockoutsDatabase) *basicAuthContext {
+	if lockouts == nil {
+		lockouts = &LockoutsDatabase{}
+	}
+
 	return &basicAuthContext{
 		UsersDatabase: userDatabase,
-		rateLimiter:   make(map[string]*rate.Limiter),
-		blockedUsers:  make(map[string]time.Time),
-		failureCount:  make(map[string]int64),
+		Lockouts:      lockouts,
+		cache:         make(map[[sha256.Size]byte]basicAuthCacheEntry),
 	}
 }
 
@@ -58,97 +67,83 @@ func (a *basicAuthContext) AuthMiddleware(next http.Handler) http.Handler {
 
 		username, password := parts[0], parts[1]
 
-		if a.isBlocked(username) {
-			a.httpError(w, http.StatusTooManyRequests)
+		if retryAfter := a.Lockouts.Blocked(r, username); retryAfter > 0 {
+			TooManyRequests(w, retryAfter)
 			return
 		}
 
-		if !a.allow(username) {
-			a.blockUser(w, r, username)
-			a.httpError(w, http.StatusTooManyRequests)
-			return
-		}
+		user := a.findByPassword(username, password)
+		if user == nil {
+			if retryAfter := a.Lockouts.Failed(r, username); retryAfter > 0 {
+				TooManyRequests(w, retryAfter)
+				return
+			}
 
-		if !a.authenticate(username, password) {
-			a.touchFailureCount(w, r, username)
 			a.httpError(w, http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), remoteUser, User{Username: username})
+		a.Lockouts.Succeeded(r, username)
+
+		authenticated := *user
+		authenticated.Password = ""
+
+		ctx := context.WithValue(r.Context(), remoteUser, authenticated)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (a *basicAuthContext) CreateToken(_, _ string) (string, error) {
-	log.Fatalf("CreateToken not implemented for proxy auth")
+// findByPassword verifies the credentials, which every request carries, against the cache before hashing the password.
+// The user is always read from the database, so that changes to roles apply at once and deleted users are rejected.
+func (a *basicAuthContext) findByPassword(username, password string) *User {
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+	now := time.Now()
 
-	return "", nil
-}
+	if user := a.UsersDatabase.Find(username); user != nil && a.cached(key, user.Password, now) {
+		return user
+	}
 
-func (a *basicAuthContext) authenticate(username, password string) bool {
 	user := a.UsersDatabase.FindByPassword(username, password)
+	if user == nil {
+		return nil
+	}
 
-	return user != nil
-}
-
-func (a *basicAuthContext) httpError(w http.ResponseWriter, status int) {
-	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-	http.Error(w, http.StatusText(status), status)
-}
-
-func (a *basicAuthContext) allow(username string) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	limiter, exists := a.rateLimiter[username]
-	if !exists {
-		limiter = rate.NewLimiter(1, 5)
-		a.rateLimiter[username] = limiter
+	for cachedKey, entry := range a.cache {
+		if now.After(entry.expires) {
+			delete(a.cache, cachedKey)
+		}
 	}
 
-	return limiter.Allow()
+	a.cache[key] = basicAuthCacheEntry{passwordHash: user.Password, expires: now.Add(basicAuthCacheTTL)}
+
+	return user
 }
 
-func (a *basicAuthContext) isBlocked(username string) bool {
+func (a *basicAuthContext) cached(key [sha256.Size]byte, passwordHash string, now time.Time) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	blockTime, exists := a.blockedUsers[username]
-	if !exists {
+	entry, found := a.cache[key]
+	if !found {
 		return false
 	}
 
-	if time.Now().After(blockTime) {
-		delete(a.blockedUsers, username)
-		delete(a.failureCount, username)
+	if now.After(entry.expires) || entry.passwordHash != passwordHash {
+		delete(a.cache, key)
 		return false
 	}
 
 	return true
 }
 
-func (a *basicAuthContext) blockUser(w http.ResponseWriter, r *http.Request, username string) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	log.Warningf("blocked user %s", username)
-	log.Infof("RemoteAddr: %+v\n", r.RemoteAddr)
-	log.Infof("Header: %+v\n", r.Header)
-
-	blockTimer := 1 * time.Hour
-	a.blockedUsers[username] = time.Now().Add(blockTimer)
-
-	w.Header().Set("Retry-After", fmt.Sprintf("%d", int64(blockTimer.Seconds())))
+func (a *basicAuthContext) CreateToken(_, _ string) (string, error) {
+	return "", ErrNotSupported
 }
 
-func (a *basicAuthContext) touchFailureCount(w http.ResponseWriter, r *http.Request, username string) {
-	a.failureCount[username]++
-
-	if a.failureCount[username] > 10 {
-		a.blockUser(w, r, username)
-		return
-	}
-
-	log.Debugf("failure count touch: %s\n", username)
+func (a *basicAuthContext) httpError(w http.ResponseWriter, status int) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+	http.Error(w, http.StatusText(status), status)
 }
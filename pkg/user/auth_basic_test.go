@@ -12,12 +12,12 @@ import (
 )
 
 func Test_AuthBasic_AuthMiddleware_happy(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewBasicAuth(usersDB)
+	authContext := NewBasicAuth(usersDB, nil)
 
 	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -39,12 +39,12 @@ func Test_AuthBasic_AuthMiddleware_happy(t *testing.T) {
 }
 
 func Test_AuthBasic_AuthMiddleware_error(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewBasicAuth(usersDB)
+	authContext := NewBasicAuth(usersDB, nil)
 
 	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -65,12 +65,12 @@ func Test_AuthBasic_AuthMiddleware_error(t *testing.T) {
 }
 
 func Test_AuthBasic_AuthMiddleware_block_user(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewBasicAuth(usersDB)
+	authContext := NewBasicAuth(usersDB, nil)
 
 	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -97,16 +97,19 @@ func Test_AuthBasic_AuthMiddleware_block_user(t *testing.T) {
 	defer resp.Body.Close()
 
 	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
 }
 
 func Test_AuthBasic_AuthMiddleware_block_user_timeout(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewBasicAuth(usersDB)
-	authContext.blockedUsers["test_user"] = time.Now().Add(-2 * time.Hour)
+	authContext := NewBasicAuth(usersDB, nil)
+	authContext.Lockouts.Lockouts = map[string]*Lockout{
+		lockoutKey("test_user", "127.0.0.1"): {Username: "test_user", IP: "127.0.0.1", Lockouts: 1, BlockedUntil: time.Now().Add(-2 * time.Hour)},
+	}
 
 	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -130,3 +133,94 @@ func basicAuth(username, password string) string {
 	auth := username + ":" + password
 	return base64.StdEncoding.EncodeToString([]byte(auth))
 }
+
+func Test_AuthBasic_AuthMiddleware_deleted_user(t *testing.T) {
+	usersDB := &UsersDatabase{
+		Users: map[string]*User{
+			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass"), Roles: []Role{RoleReadOnly}},
+			"admin":     {Username: "admin", Password: helper.Sha512sum("admin_pass"), Roles: []Role{RoleAdmin}},
+		},
+	}
+	authContext := NewBasicAuth(usersDB, nil)
+
+	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// The admin API changes the same database, so the change applies to the next login
+	assert.NoError(t, usersDB.Delete("test_user"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Basic "+basicAuth("test_user", "test_pass"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func Test_AuthBasic_AuthMiddleware_valid_burst(t *testing.T) {
+	usersDB := &UsersDatabase{
+		Users: map[string]*User{
+			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass"), Roles: []Role{RoleReadOnly}},
+		},
+	}
+	authContext := NewBasicAuth(usersDB, nil)
+
+	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Dashboards, event streams and CI send many requests with the same credentials
+	for i := 0; i < 4*clientBurst; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Basic "+basicAuth("test_user", "test_pass"))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code, "request %d", i)
+	}
+}
+
+func Test_AuthBasic_AuthMiddleware_cache(t *testing.T) {
+	usersDB := &UsersDatabase{
+		Users: map[string]*User{
+			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass"), Roles: []Role{RoleReadOnly}},
+		},
+	}
+	authContext := NewBasicAuth(usersDB, nil)
+
+	var current *User
+	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(password string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Basic "+basicAuth("test_user", password))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("test_pass"))
+	assert.Len(t, authContext.cache, 1, "expected verified credentials to be cached")
+	assert.Equal(t, http.StatusUnauthorized, serve("wrong_pass"))
+	assert.Len(t, authContext.cache, 1, "expected wrong credentials not to be cached")
+
+	_, err := usersDB.Update("test_user", func(u *User) error {
+		u.Roles = []Role{RoleOperator}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve("test_pass"))
+	assert.True(t, current.HasRole(RoleOperator), "expected cached credentials to get the current roles")
+
+	assert.NoError(t, usersDB.SetPassword("test_user", "new_pass"))
+	assert.Equal(t, http.StatusUnauthorized, serve("test_pass"), "expected a new password to invalidate the cache")
+	assert.Equal(t, http.StatusOK, serve("new_pass"))
+
+	assert.NoError(t, usersDB.Delete("test_user"))
+	assert.Equal(t, http.StatusUnauthorized, serve("new_pass"), "expected deleted users to be rejected")
+}
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+)
+
+type ForwardAuthConfig struct {
+	UserHeader     string
+	EmailHeader    string
+	NameHeader     string
+	GroupsHeader   string
+	TrustedProxies []*net.IPNet
+	GroupMapping   GroupMapping
+}
+
+type forwardAuthContext struct {
+	UsersDatabase *UsersDatabase
+	config        ForwardAuthConfig
+}
+
+// NewForwardAuth trusts identity headers set by a reverse proxy such as Authelia, Authentik or oauth2-proxy.
+// The headers are only honored when the request comes directly from one of the trusted proxies.
+func NewForwardAuth(config ForwardAuthConfig, usersDatabase *UsersDatabase) *forwardAuthContext {
+	if config.UserHeader == "" {
+		config.UserHeader = "Remote-User"
+	}
+
+	return &forwardAuthContext{
+		UsersDatabase: usersDatabase,
+		config:        config,
+	}
+}
+
+func (a *forwardAuthContext) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := strings.TrimSpace(r.Header.Get(a.config.UserHeader))
+		if username == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if remoteIP := helper.RemoteIP(r); !helper.ContainsIP(a.config.TrustedProxies, remoteIP) {
+			log.Warnf("ignoring %s header from untrusted address %s", a.config.UserHeader, remoteIP)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := externalUser(
+			a.UsersDatabase,
+			a.config.GroupMapping,
+			username,
+			a.header(r, a.config.EmailHeader),
+			a.header(r, a.config.NameHeader),
+			a.groups(r),
+		)
+
+		ctx := context.WithValue(r.Context(), remoteUser, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *forwardAuthContext) CreateToken(_, _ string) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (a *forwardAuthContext) header(r *http.Request, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	return strings.TrimSpace(r.Header.Get(name))
+}
+
+func (a *forwardAuthContext) groups(r *http.Request) []string {
+	value := a.header(r, a.config.GroupsHeader)
+	if value == "" {
+		return nil
+	}
+
+	groups := make([]string, 0)
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestForwardAuth(t *testing.T, users *UsersDatabase) *forwardAuthContext {
+	trusted, err := helper.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	mapping, err := ParseGroupMapping([]string{"admins=admin", "edge=host:edge-1"})
+	require.NoError(t, err)
+
+	return NewForwardAuth(ForwardAuthConfig{
+		UserHeader:     "Remote-User",
+		EmailHeader:    "Remote-Email",
+		NameHeader:     "Remote-Name",
+		GroupsHeader:   "Remote-Groups",
+		TrustedProxies: trusted,
+		GroupMapping:   mapping,
+	}, users)
+}
+
+func Test_AuthForward_AuthMiddleware(t *testing.T) {
+	users := UsersDatabase{
+		Users: map[string]*User{
+			"bob": {Username: "bob", Name: "Bob", Roles: []Role{RoleReadOnly}},
+		},
+	}
+	authContext := newTestForwardAuth(t, &users)
+
+	var current *User
+	handler := authContext.AuthMiddleware(RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		status     int
+		check      func(t *testing.T, user *User)
+	}{
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"Remote-User": "jane", "Remote-Email": "jane@example.com", "Remote-Groups": "admins, edge"},
+			status:     http.StatusOK,
+			check: func(t *testing.T, user *User) {
+				assert.Equal(t, "jane", user.Username)
+				assert.Equal(t, "jane", user.Name)
+				assert.Equal(t, "jane@example.com", user.Email)
+				assert.Equal(t, []Role{RoleAdmin}, user.Roles)
+				assert.Equal(t, []string{"edge-1"}, user.Hosts)
+			},
+		},
+		{
+			name:       "known user",
+			remoteAddr: "10.0.0.2:4321",
+			headers:    map[string]string{"Remote-User": "bob"},
+			status:     http.StatusOK,
+			check: func(t *testing.T, user *User) {
+				assert.Equal(t, "Bob", user.Name)
+				assert.Equal(t, []Role{RoleReadOnly}, user.Roles)
+			},
+		},
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.5:4321",
+			headers:    map[string]string{"Remote-User": "jane", "Remote-Groups": "admins"},
+			status:     http.StatusUnauthorized,
+		},
+		{
+			name:       "no header",
+			remoteAddr: "10.0.0.2:4321",
+			status:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current = nil
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, test.status, rec.Code)
+
+			if test.check != nil {
+				require.NotNil(t, current)
+				test.check(t, current)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const ldapTimeout = 10 * time.Second
+
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// BindDN and BindPassword enable search-then-bind with a service account
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string
+	// UserDNTemplate is used to bind directly when no service account is configured, e.g. uid=%s,ou=people,dc=example,dc=org
+	UserDNTemplate string
+	EmailAttribute string
+	NameAttribute  string
+	GroupAttribute string
+	GroupMapping   GroupMapping
+	CacheTTL       time.Duration
+	Lockouts       *LockoutsDatabase
+}
+
+// ldapConn is the subset of *ldap.Conn used for authentication
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+type ldapCacheEntry struct {
+	password [sha256.Size]byte
+	user     User
+	expires  time.Time
+}
+
+type ldapAuthContext struct {
+	UsersDatabase *UsersDatabase
+	config        LDAPConfig
+	dial          func() (ldapConn, error)
+	cache         map[string]ldapCacheEntry
+	mu            sync.Mutex
+}
+
+// NewLDAPAuth authenticates basic auth credentials against an LDAP directory.
+// The users database is optional and contributes roles and grants of known users.
+func NewLDAPAuth(config LDAPConfig, usersDatabase *UsersDatabase) (*ldapAuthContext, error) {
+	if config.URL == "" {
+		return nil, errors.New("ldap url is required")
+	}
+	if config.BindDN == "" && config.UserDNTemplate == "" {
+		return nil, errors.New("either an ldap bind dn or a user dn template is required")
+	}
+	if config.BindDN != "" && config.BaseDN == "" {
+		return nil, errors.New("ldap base dn is required for search-then-bind")
+	}
+	if config.UserDNTemplate != "" && strings.Count(config.UserDNTemplate, "%s") != 1 {
+		return nil, errors.New("ldap user dn template should contain exactly one %s")
+	}
+
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.NameAttribute == "" {
+		config.NameAttribute = "cn"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Lockouts == nil {
+		config.Lockouts = &LockoutsDatabase{}
+	}
+
+	a := &ldapAuthContext{
+		UsersDatabase: usersDatabase,
+		config:        config,
+		cache:         make(map[string]ldapCacheEntry),
+	}
+	a.dial = a.dialURL
+
+	return a, nil
+}
+
+func (a *ldapAuthContext) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			a.httpError(w, http.StatusUnauthorized)
+			return
+		}
+
+		if retryAfter := a.config.Lockouts.Blocked(r, username); retryAfter > 0 {
+			TooManyRequests(w, retryAfter)
+			return
+		}
+
+		user, err := a.authenticate(username, password)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidCredentials) {
+				log.Errorf("ldap authentication failed: %s", err)
+			} else if retryAfter := a.config.Lockouts.Failed(r, username); retryAfter > 0 {
+				TooManyRequests(w, retryAfter)
+				return
+			}
+
+			a.httpError(w, http.StatusUnauthorized)
+			return
+		}
+
+		a.config.Lockouts.Succeeded(r, username)
+
+		ctx := context.WithValue(r.Context(), remoteUser, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *ldapAuthContext) CreateToken(_, _ string) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (a *ldapAuthContext) httpError(w http.ResponseWriter, status int) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (a *ldapAuthContext) authenticate(username, password string) (User, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return User{}, ErrInvalidCredentials
+	}
+
+	passwordHash := sha256.Sum256([]byte(password))
+	if user, found := a.cached(username, passwordHash); found {
+		return user, nil
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return User{}, err
+	}
+	defer conn.Close()
+
+	entry, err := a.bind(conn, username, password)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := externalUser(
+		a.UsersDatabase,
+		a.config.GroupMapping,
+		username,
+		entry.GetAttributeValue(a.config.EmailAttribute),
+		entry.GetAttributeValue(a.config.NameAttribute),
+		ldapGroups(entry.GetAttributeValues(a.config.GroupAttribute), a.config.GroupMapping),
+	)
+
+	if a.config.CacheTTL > 0 {
+		a.mu.Lock()
+		a.cache[username] = ldapCacheEntry{password: passwordHash, user: user, expires: time.Now().Add(a.config.CacheTTL)}
+		a.mu.Unlock()
+	}
+
+	return user, nil
+}
+
+// bind verifies the password and returns the user's entry with the configured attributes
+func (a *ldapAuthContext) bind(conn ldapConn, username, password string) (*ldap.Entry, error) {
+	attributes := []string{a.config.EmailAttribute, a.config.NameAttribute, a.config.GroupAttribute}
+
+	if a.config.BindDN == "" {
+		userDN := fmt.Sprintf(a.config.UserDNTemplate, ldap.EscapeDN(username))
+		if err := conn.Bind(userDN, password); err != nil {
+			return nil, ldapBindError(err)
+		}
+
+		return a.searchOne(conn, ldap.NewSearchRequest(
+			userDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, int(ldapTimeout.Seconds()), false,
+			"(objectClass=*)", attributes, nil,
+		))
+	}
+
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return nil, fmt.Errorf("could not bind ldap service account: %w", err)
+	}
+
+	entry, err := a.searchOne(conn, ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(username)), attributes, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, ldapBindError(err)
+	}
+
+	return entry, nil
+}
+
+func (a *ldapAuthContext) searchOne(conn ldapConn, request *ldap.SearchRequest) (*ldap.Entry, error) {
+	result, err := conn.Search(request)
+	if err != nil {
+		if ldap.IsErrorAnyOf(err, ldap.LDAPResultNoSuchObject, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
+
+func (a *ldapAuthContext) cached(username string, passwordHash [sha256.Size]byte) (User, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, found := a.cache[username]
+	if !found {
+		return User{}, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(a.cache, username)
+		return User{}, false
+	}
+
+	if subtle.ConstantTimeCompare(entry.password[:], passwordHash[:]) != 1 {
+		return User{}, false
+	}
+
+	return entry.user, true
+}
+
+func (a *ldapAuthContext) dialURL() (ldapConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.config.InsecureSkipVerify} //nolint:gosec
+
+	conn, err := ldap.DialURL(a.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to ldap server: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not start tls with ldap server: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func ldapBindError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+
+	return err
+}
+
+// ldapGroups converts group DNs such as cn=ops,ou=groups,dc=example,dc=org to their common names
+// ldapGroups names the groups for the mapping: by a full DN key of the mapping when one matches, so that groups with
+// the same common name in different OUs can be told apart, and by their common name otherwise
+func ldapGroups(values []string, mapping GroupMapping) []string {
+	keys := make(map[string]*ldap.DN)
+	for key := range mapping {
+		if dn, err := ldap.ParseDN(key); err == nil && len(dn.RDNs) > 1 {
+			keys[key] = dn
+		}
+	}
+
+	groups := make([]string, 0, len(values))
+	for _, value := range values {
+		dn, err := ldap.ParseDN(value)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			groups = append(groups, value)
+			continue
+		}
+
+		group := dn.RDNs[0].Attributes[0].Value
+		for key, keyDN := range keys {
+			if keyDN.EqualFold(dn) {
+				group = key
+				break
+			}
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups
+}
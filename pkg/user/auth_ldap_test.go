@@ -0,0 +1,263 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockServiceDN       = "cn=dockhook,ou=services,dc=example,dc=org"
+	mockServicePassword = "service-secret"
+)
+
+type mockLDAPEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+// mockDirectory is an in-process LDAP stand-in supporting simple binds and uid searches
+type mockDirectory struct {
+	entries map[string]mockLDAPEntry
+	binds   int
+	mu      sync.Mutex
+}
+
+type mockLDAPConn struct {
+	directory *mockDirectory
+	bound     string
+}
+
+func newMockDirectory() *mockDirectory {
+	return &mockDirectory{entries: map[string]mockLDAPEntry{
+		mockServiceDN: {password: mockServicePassword},
+		"uid=jane,ou=people,dc=example,dc=org": {
+			password: "jane-pass",
+			attributes: map[string][]string{
+				"uid":      {"jane"},
+				"mail":     {"jane@example.com"},
+				"cn":       {"Jane Doe"},
+				"memberOf": {"cn=ops,ou=groups,dc=example,dc=org", "cn=staff,ou=groups,dc=example,dc=org"},
+			},
+		},
+		"uid=bob,ou=people,dc=example,dc=org": {
+			password:   "bob-pass",
+			attributes: map[string][]string{"uid": {"bob"}},
+		},
+	}}
+}
+
+func (d *mockDirectory) dial() (ldapConn, error) {
+	return &mockLDAPConn{directory: d}, nil
+}
+
+func (c *mockLDAPConn) Bind(username, password string) error {
+	c.directory.mu.Lock()
+	defer c.directory.mu.Unlock()
+	c.directory.binds++
+
+	entry, found := c.directory.entries[username]
+	if !found || entry.password != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+	}
+
+	c.bound = username
+	return nil
+}
+
+func (c *mockLDAPConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.bound == "" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, nil)
+	}
+
+	result := &ldap.SearchResult{}
+	for dn, entry := range c.directory.entries {
+		if !c.matches(request, dn, entry) {
+			continue
+		}
+
+		found := ldap.NewEntry(dn, map[string][]string{})
+		for _, attribute := range request.Attributes {
+			if values, ok := entry.attributes[attribute]; ok {
+				found.Attributes = append(found.Attributes, ldap.NewEntryAttribute(attribute, values))
+			}
+		}
+		result.Entries = append(result.Entries, found)
+	}
+
+	if len(result.Entries) == 0 && request.Scope == ldap.ScopeBaseObject {
+		return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, nil)
+	}
+
+	return result, nil
+}
+
+func (c *mockLDAPConn) matches(request *ldap.SearchRequest, dn string, entry mockLDAPEntry) bool {
+	if request.Scope == ldap.ScopeBaseObject {
+		return dn == request.BaseDN
+	}
+
+	if !strings.HasSuffix(dn, ","+request.BaseDN) {
+		return false
+	}
+
+	uid, found := strings.CutPrefix(request.Filter, "(uid=")
+	if !found {
+		return false
+	}
+
+	values := entry.attributes["uid"]
+	return len(values) > 0 && values[0] == strings.TrimSuffix(uid, ")")
+}
+
+func (c *mockLDAPConn) Close() error {
+	return nil
+}
+
+func newTestLDAPAuth(t *testing.T, config LDAPConfig, directory *mockDirectory) *ldapAuthContext {
+	mapping, err := ParseGroupMapping([]string{"ops=operator", "staff=host:localhost"})
+	require.NoError(t, err)
+
+	config.URL = "ldap://directory.example.org"
+	config.GroupMapping = mapping
+
+	authContext, err := NewLDAPAuth(config, nil)
+	require.NoError(t, err)
+	authContext.dial = directory.dial
+
+	return authContext
+}
+
+func Test_AuthLDAP_authenticate(t *testing.T) {
+	configs := map[string]LDAPConfig{
+		"search then bind": {BindDN: mockServiceDN, BindPassword: mockServicePassword, BaseDN: "ou=people,dc=example,dc=org"},
+		"direct bind":      {UserDNTemplate: "uid=%s,ou=people,dc=example,dc=org"},
+	}
+
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			authContext := newTestLDAPAuth(t, config, newMockDirectory())
+
+			user, err := authContext.authenticate("jane", "jane-pass")
+			require.NoError(t, err)
+			assert.Equal(t, "jane", user.Username)
+			assert.Equal(t, "Jane Doe", user.Name)
+			assert.Equal(t, "jane@example.com", user.Email)
+			assert.Equal(t, []Role{RoleOperator}, user.Roles)
+			assert.Equal(t, []string{"localhost"}, user.Hosts)
+
+			user, err = authContext.authenticate("bob", "bob-pass")
+			require.NoError(t, err)
+			assert.Equal(t, "bob", user.Name)
+			assert.Empty(t, user.Roles)
+
+			_, err = authContext.authenticate("jane", "wrong")
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+			_, err = authContext.authenticate("jane", "")
+			assert.ErrorIs(t, err, ErrInvalidCredentials, "expected unauthenticated bind to be rejected")
+
+			_, err = authContext.authenticate("nobody", "jane-pass")
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+			_, err = authContext.authenticate("*", "jane-pass")
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+}
+
+func Test_AuthLDAP_authenticate_service_account_error(t *testing.T) {
+	authContext := newTestLDAPAuth(t, LDAPConfig{
+		BindDN:       mockServiceDN,
+		BindPassword: "wrong",
+		BaseDN:       "ou=people,dc=example,dc=org",
+	}, newMockDirectory())
+
+	_, err := authContext.authenticate("jane", "jane-pass")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials, "expected a misconfigured service account to be reported")
+}
+
+func Test_AuthLDAP_authenticate_cache(t *testing.T) {
+	directory := newMockDirectory()
+	authContext := newTestLDAPAuth(t, LDAPConfig{
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=org",
+		CacheTTL:       time.Minute,
+	}, directory)
+
+	_, err := authContext.authenticate("jane", "jane-pass")
+	require.NoError(t, err)
+	_, err = authContext.authenticate("jane", "jane-pass")
+	require.NoError(t, err)
+	assert.Equal(t, 1, directory.binds, "expected second login to be served from the cache")
+
+	_, err = authContext.authenticate("jane", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "expected cache to be keyed by password")
+
+	authContext.cache["jane"] = ldapCacheEntry{expires: time.Now().Add(-time.Second)}
+	_, err = authContext.authenticate("jane", "jane-pass")
+	require.NoError(t, err)
+	assert.Equal(t, 3, directory.binds, "expected expired entry to hit the directory")
+}
+
+func Test_AuthLDAP_AuthMiddleware(t *testing.T) {
+	authContext := newTestLDAPAuth(t, LDAPConfig{UserDNTemplate: "uid=%s,ou=people,dc=example,dc=org"}, newMockDirectory())
+
+	var current *User
+	handler := authContext.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("jane", "jane-pass")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, current)
+	assert.Equal(t, "jane", current.Username)
+
+	req.SetBasicAuth("jane", "wrong")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+}
+
+func Test_ldapGroups(t *testing.T) {
+	assert.Equal(t,
+		[]string{"ops", "Domain Admins", "plain"},
+		ldapGroups([]string{"cn=ops,ou=groups,dc=example,dc=org", "CN=Domain Admins,CN=Users,DC=corp,DC=local", "plain"}, nil),
+	)
+}
+
+func Test_ldapGroups_distinguished_name(t *testing.T) {
+	mapping, err := ParseGroupMapping([]string{"cn=admins,ou=ops,dc=example,dc=org=admin", "admins=read-only"})
+	require.NoError(t, err)
+
+	groups := ldapGroups([]string{"CN=admins,OU=ops,DC=example,DC=org", "cn=admins,ou=contractors,dc=example,dc=org"}, mapping)
+	assert.Equal(t, []string{"cn=admins,ou=ops,dc=example,dc=org", "admins"}, groups, "expected full DN keys to be preferred")
+
+	user := newUser("jane", "", "")
+	mapping.Apply(&user, groups[:1])
+	assert.Equal(t, []Role{RoleAdmin}, user.Roles, "expected only the group of the ops unit to grant admin")
+}
+
+func Test_NewLDAPAuth_error(t *testing.T) {
+	_, err := NewLDAPAuth(LDAPConfig{URL: "ldap://localhost"}, nil)
+	assert.Error(t, err, "expected bind dn or template to be required")
+
+	_, err = NewLDAPAuth(LDAPConfig{URL: "ldap://localhost", BindDN: mockServiceDN}, nil)
+	assert.Error(t, err, "expected base dn to be required")
+
+	_, err = NewLDAPAuth(LDAPConfig{URL: "ldap://localhost", UserDNTemplate: "uid=jane"}, nil)
+	assert.Error(t, err, "expected template placeholder to be required")
+}
@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type MTLSConfig struct {
+	// Users maps certificate identities such as cn:ci-runner or dns:ci.internal to users from users.yml
+	Users map[string]string
+	// GroupMapping grants roles, webhooks or hosts to certificate identities
+	GroupMapping GroupMapping
+	// Fallback authenticates requests without a known client certificate, e.g. humans with basic auth
+	Fallback interface {
+		AuthMiddleware(http.Handler) http.Handler
+	}
+}
+
+type mtlsAuthContext struct {
+	UsersDatabase *UsersDatabase
+	config        MTLSConfig
+}
+
+// ParseMTLSUsers parses identity=username pairs, e.g. cn:ci-runner=deployer or uri:spiffe://example.org/ci=deployer
+func ParseMTLSUsers(values []string) (map[string]string, error) {
+	users := make(map[string]string, len(values))
+
+	for _, value := range values {
+		identity, username, found := strings.Cut(value, "=")
+		if !found || username == "" {
+			return nil, fmt.Errorf("certificate user should be of the form identity=username: %s", value)
+		}
+
+		kind, name, found := strings.Cut(identity, ":")
+		if !found || name == "" || !isCertificateIdentityKind(kind) {
+			return nil, fmt.Errorf("certificate identity should start with cn:, dns:, email: or uri: %s", value)
+		}
+
+		users[identity] = username
+	}
+
+	return users, nil
+}
+
+// NewMTLSAuth authenticates callers by the client certificate verified during the TLS handshake.
+// Certificates are only trusted when the server verifies them against the client CA.
+func NewMTLSAuth(config MTLSConfig, usersDatabase *UsersDatabase) *mtlsAuthContext {
+	return &mtlsAuthContext{
+		UsersDatabase: usersDatabase,
+		config:        config,
+	}
+}
+
+func (a *mtlsAuthContext) AuthMiddleware(next http.Handler) http.Handler {
+	var fallback http.Handler
+	if a.config.Fallback != nil {
+		fallback = a.config.Fallback.AuthMiddleware(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			if user, found := a.userFromCertificate(r.TLS.VerifiedChains[0][0]); found {
+				ctx := context.WithValue(r.Context(), remoteUser, user)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+
+		if fallback != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *mtlsAuthContext) CreateToken(_, _ string) (string, error) {
+	return "", ErrNotSupported
+}
+
+// userFromCertificate resolves the user of a certificate that is either mapped to a user or granted access directly
+func (a *mtlsAuthContext) userFromCertificate(certificate *x509.Certificate) (User, bool) {
+	identities := certificateIdentities(certificate)
+	if len(identities) == 0 {
+		return User{}, false
+	}
+
+	username := certificate.Subject.CommonName
+	mapped := false
+	for _, identity := range identities {
+		if name, found := a.config.Users[identity]; found {
+			username, mapped = name, true
+			break
+		}
+	}
+
+	if mapped && (a.UsersDatabase == nil || a.UsersDatabase.Find(username) == nil) {
+		log.Warnf("client certificate %s is mapped to unknown user %s", identities[0], username)
+		return User{}, false
+	}
+
+	if username == "" {
+		_, username, _ = strings.Cut(identities[0], ":")
+	}
+
+	// Only mapped certificates inherit roles from users.yml, a matching common name is not enough
+	users := a.UsersDatabase
+	if !mapped {
+		users = nil
+	}
+
+	user := externalUser(users, a.config.GroupMapping, username, "", "", identities)
+	if !mapped && len(user.Roles) == 0 && len(user.Webhooks) == 0 && len(user.Hosts) == 0 {
+		log.Debugf("client certificate %s has no user or grants", identities[0])
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// certificateIdentities lists the subject common name and the SANs of a certificate with their kind as prefix
+func certificateIdentities(certificate *x509.Certificate) []string {
+	identities := make([]string, 0)
+
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, "cn:"+certificate.Subject.CommonName)
+	}
+	for _, name := range certificate.DNSNames {
+		identities = append(identities, "dns:"+name)
+	}
+	for _, email := range certificate.EmailAddresses {
+		identities = append(identities, "email:"+email)
+	}
+	for _, uri := range certificate.URIs {
+		identities = append(identities, "uri:"+uri.String())
+	}
+
+	return identities
+}
+
+func isCertificateIdentityKind(kind string) bool {
+	return kind == "cn" || kind == "dns" || kind == "email" || kind == "uri"
+}
@@ -0,0 +1,175 @@
+package user
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	serial      int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{certificate: certificate, key: key, serial: 1}
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	ca.serial++
+	template.SerialNumber = big.NewInt(ca.serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func Test_AuthMTLS_AuthMiddleware(t *testing.T) {
+	ca := newTestCA(t)
+	users := UsersDatabase{
+		Users: map[string]*User{
+			"deployer": {Username: "deployer", Roles: []Role{RoleOperator}},
+			"admin":    {Username: "admin", Password: helper.Sha512sum("admin_pass"), Roles: []Role{RoleAdmin}},
+		},
+	}
+
+	mapping, err := ParseGroupMapping([]string{"dns:edge.internal=host:edge-1"})
+	require.NoError(t, err)
+	mtlsUsers, err := ParseMTLSUsers([]string{"uri:spiffe://example.org/ci=deployer"})
+	require.NoError(t, err)
+
+	authContext := NewMTLSAuth(MTLSConfig{
+		Users:        mtlsUsers,
+		GroupMapping: mapping,
+		Fallback:     NewBasicAuth(&users, nil),
+	}, &users)
+
+	var current *User
+	srv := httptest.NewUnstartedServer(authContext.AuthMiddleware(RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))))
+	srv.TLS = &tls.Config{ClientCAs: x509.NewCertPool(), ClientAuth: tls.VerifyClientCertIfGiven, MinVersion: tls.VersionTLS12}
+	srv.TLS.ClientCAs.AddCert(ca.certificate)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	spiffe, err := url.Parse("spiffe://example.org/ci")
+	require.NoError(t, err)
+
+	request := func(t *testing.T, certificate *tls.Certificate, basic bool) int {
+		client := *srv.Client()
+		transport := client.Transport.(*http.Transport).Clone()
+		if certificate != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*certificate}
+		}
+		client.Transport = transport
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		if basic {
+			req.SetBasicAuth("admin", "admin_pass")
+		}
+
+		current = nil
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("mapped user", func(t *testing.T) {
+		certificate := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "runner-7"}, URIs: []*url.URL{spiffe}})
+
+		require.Equal(t, http.StatusOK, request(t, &certificate, false))
+		assert.Equal(t, "deployer", current.Username)
+		assert.Equal(t, []Role{RoleOperator}, current.Roles)
+	})
+
+	t.Run("granted identity", func(t *testing.T) {
+		certificate := ca.issue(t, &x509.Certificate{DNSNames: []string{"edge.internal"}})
+
+		require.Equal(t, http.StatusOK, request(t, &certificate, false))
+		assert.Equal(t, "edge.internal", current.Username)
+		assert.Equal(t, []string{"edge-1"}, current.Hosts)
+		assert.Empty(t, current.Roles)
+	})
+
+	t.Run("common name of a known user", func(t *testing.T) {
+		certificate := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "admin"}})
+
+		assert.Equal(t, http.StatusUnauthorized, request(t, &certificate, false), "expected unmapped certificate to be rejected")
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		certificate := newTestCA(t).issue(t, &x509.Certificate{URIs: []*url.URL{spiffe}})
+
+		client := *srv.Client()
+		transport := client.Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = []tls.Certificate{certificate}
+		client.Transport = transport
+
+		_, err := client.Get(srv.URL)
+		assert.Error(t, err, "expected handshake to fail")
+	})
+
+	t.Run("basic auth fallback", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, request(t, nil, true))
+		assert.Equal(t, "admin", current.Username)
+
+		assert.Equal(t, http.StatusUnauthorized, request(t, nil, false))
+	})
+}
+
+func Test_ParseMTLSUsers(t *testing.T) {
+	users, err := ParseMTLSUsers([]string{"cn:ci-runner=deployer", "email:ci@example.org=deployer"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cn:ci-runner": "deployer", "email:ci@example.org": "deployer"}, users)
+
+	_, err = ParseMTLSUsers([]string{"ci-runner=deployer"})
+	assert.Error(t, err, "expected identity without kind to be rejected")
+
+	_, err = ParseMTLSUsers([]string{"cn:ci-runner"})
+	assert.Error(t, err, "expected identity without user to be rejected")
+}
@@ -0,0 +1,438 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/goccy/go-json"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	oidcLoginCookie   = "oidc_login"
+	oidcLoginLifetime = 10 * time.Minute
+
+	// oidcKeysRefreshInterval limits how often an unknown signing key triggers a JWKS refresh
+	oidcKeysRefreshInterval = time.Minute
+)
+
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	Audience      string
+	UsernameClaim string
+	GroupsClaim   string
+	// LocalUserClaim names the claim matched against users.yml; without it local users are not consulted
+	LocalUserClaim string
+	GroupMapping   GroupMapping
+	Base           string
+	HTTPClient     *http.Client
+	Sessions       *SessionManager
+	Cookies        CookieConfig
+}
+
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+}
+
+type oidcAuthContext struct {
+	UsersDatabase *UsersDatabase
+	config        OIDCConfig
+	provider      oidcProviderMetadata
+	keysCache     *jwk.Cache
+	keys          jwk.Set
+	loginAuth     *jwtauth.JWTAuth
+	lastRefresh   time.Time
+	mu            sync.Mutex
+}
+
+// NewOIDCAuth discovers the issuer and prepares authorization-code logins and bearer token verification.
+// The users database is optional and contributes roles and grants of users matched through LocalUserClaim.
+func NewOIDCAuth(ctx context.Context, config OIDCConfig, usersDatabase *UsersDatabase) (*oidcAuthContext, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc issuer, client id and redirect url are required")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.Audience == "" {
+		config.Audience = config.ClientID
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "sub"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.Sessions == nil {
+		sessions, err := NewSessionManager("", "", DefaultSessionTTL, DefaultSessionMaxAge)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Sessions = sessions
+	}
+
+	a := &oidcAuthContext{
+		UsersDatabase: usersDatabase,
+		config:        config,
+	}
+
+	if err := a.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	a.keysCache = jwk.NewCache(ctx)
+	if err := a.keysCache.Register(a.provider.JWKSURI, jwk.WithHTTPClient(config.HTTPClient)); err != nil {
+		return nil, err
+	}
+	if _, err := a.keysCache.Refresh(ctx, a.provider.JWKSURI); err != nil {
+		return nil, fmt.Errorf("could not fetch JWKS from %s: %w", a.provider.JWKSURI, err)
+	}
+	a.keys = jwk.NewCachedSet(a.keysCache, a.provider.JWKSURI)
+	a.lastRefresh = time.Now()
+
+	secret, err := randomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	a.loginAuth = jwtauth.New("HS256", secret, nil)
+
+	return a, nil
+}
+
+func (a *oidcAuthContext) discover(ctx context.Context) error {
+	discoveryURL := strings.TrimSuffix(a.config.Issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.config.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not discover oidc issuer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc discovery failed with status code %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&a.provider); err != nil {
+		return err
+	}
+
+	if a.provider.Issuer != a.config.Issuer {
+		return fmt.Errorf("oidc issuer mismatch: expected %s, got %s", a.config.Issuer, a.provider.Issuer)
+	}
+
+	if a.provider.AuthorizationEndpoint == "" || a.provider.TokenEndpoint == "" || a.provider.JWKSURI == "" {
+		return errors.New("oidc discovery document is incomplete")
+	}
+
+	return nil
+}
+
+func (a *oidcAuthContext) AuthMiddleware(next http.Handler) http.Handler {
+	sessions := a.config.Sessions.Verifier(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearer := bearerToken(r); bearer != "" {
+			token, err := a.verify(r.Context(), bearer, a.config.Audience)
+			if err != nil {
+				log.Debugf("oidc bearer token rejected: %s", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), remoteUser, a.userFromClaims(token))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		sessions.ServeHTTP(w, r)
+	})
+}
+
+func (a *oidcAuthContext) CreateToken(_, _ string) (string, error) {
+	return "", ErrNotSupported
+}
+
+// RegisterRoutes adds the login and callback endpoints of the authorization-code flow
+func (a *oidcAuthContext) RegisterRoutes(r chi.Router) {
+	r.Get("/api/oidc/login", a.login)
+	r.Get("/api/oidc/callback", a.callback)
+}
+
+func (a *oidcAuthContext) login(w http.ResponseWriter, r *http.Request) {
+	state, err1 := randomBytes(16)
+	nonce, err2 := randomBytes(16)
+	verifier, err3 := randomBytes(32)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		log.Errorf("Error while starting oidc login: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	login := map[string]interface{}{
+		"state":    base64.RawURLEncoding.EncodeToString(state),
+		"nonce":    base64.RawURLEncoding.EncodeToString(nonce),
+		"verifier": base64.RawURLEncoding.EncodeToString(verifier),
+	}
+	jwtauth.SetExpiryIn(login, oidcLoginLifetime)
+
+	_, loginToken, err := a.loginAuth.Encode(login)
+	if err != nil {
+		log.Errorf("Error while starting oidc login: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, a.config.Cookies.Cookie(r, oidcLoginCookie, loginToken, oidcLoginLifetime))
+
+	challenge := sha256.Sum256([]byte(login["verifier"].(string)))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", a.config.ClientID)
+	query.Set("redirect_uri", a.config.RedirectURL)
+	query.Set("scope", strings.Join(a.config.Scopes, " "))
+	query.Set("state", login["state"].(string))
+	query.Set("nonce", login["nonce"].(string))
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(a.provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	http.Redirect(w, r, a.provider.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+func (a *oidcAuthContext) callback(w http.ResponseWriter, r *http.Request) {
+	if oidcError := r.URL.Query().Get("error"); oidcError != "" {
+		log.Warnf("oidc login failed: %s", oidcError)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	loginToken, err := jwtauth.VerifyRequest(a.loginAuth, r, func(r *http.Request) string {
+		if cookie, err := r.Cookie(oidcLoginCookie); err == nil {
+			return cookie.Value
+		}
+
+		return ""
+	})
+	if err != nil {
+		log.Warnf("oidc login rejected: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	login := loginToken.PrivateClaims()
+	if state, _ := login["state"].(string); state == "" || state != r.URL.Query().Get("state") {
+		log.Warn("oidc login rejected: state mismatch")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	verifier, _ := login["verifier"].(string)
+	tokens, err := a.exchange(r.Context(), url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {r.URL.Query().Get("code")},
+		"redirect_uri":  {a.config.RedirectURL},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		log.Warnf("oidc code exchange failed: %s", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	idToken, err := a.verify(r.Context(), tokens.IDToken, a.config.ClientID)
+	if err != nil {
+		log.Warnf("oidc id token rejected: %s", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if nonce, _ := idToken.PrivateClaims()["nonce"].(string); nonce == "" || nonce != login["nonce"] {
+		log.Warn("oidc id token rejected: nonce mismatch")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	user := a.userFromClaims(idToken)
+	if user.Username == "" {
+		log.Warnf("oidc id token has no %s claim", a.config.UsernameClaim)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := a.config.Sessions.Issue(&user)
+	if err != nil {
+		log.Errorf("Error while creating session: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, a.config.Cookies.Expired(r, oidcLoginCookie))
+	http.SetCookie(w, a.config.Cookies.Cookie(r, SessionCookieName, session, a.config.Sessions.TTL))
+
+	log.Infof("Token created for user %s", user.Username)
+
+	base := a.config.Base
+	if base == "" {
+		base = "/"
+	}
+	http.Redirect(w, r, base, http.StatusFound)
+}
+
+func (a *oidcAuthContext) exchange(ctx context.Context, form url.Values) (oidcTokenResponse, error) {
+	var tokens oidcTokenResponse
+
+	if a.config.ClientSecret == "" {
+		form.Set("client_id", a.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokens, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if a.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+	}
+
+	resp, err := a.config.HTTPClient.Do(req)
+	if err != nil {
+		return tokens, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return tokens, fmt.Errorf("token endpoint responded with status code %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return tokens, err
+	}
+
+	if tokens.IDToken == "" {
+		return tokens, errors.New("token endpoint returned no id_token")
+	}
+
+	return tokens, nil
+}
+
+// verify checks the signature against the issuer's JWKS, refreshing the keys once when the issuer may have rotated them
+func (a *oidcAuthContext) verify(ctx context.Context, raw string, audience string) (jwt.Token, error) {
+	token, err := a.parse(raw, audience)
+	if err == nil {
+		return token, nil
+	}
+
+	a.mu.Lock()
+	refresh := time.Since(a.lastRefresh) > oidcKeysRefreshInterval
+	if refresh {
+		a.lastRefresh = time.Now()
+	}
+	a.mu.Unlock()
+
+	if !refresh {
+		return nil, err
+	}
+
+	if _, refreshErr := a.keysCache.Refresh(ctx, a.provider.JWKSURI); refreshErr != nil {
+		log.Warnf("Could not refresh JWKS from %s: %s", a.provider.JWKSURI, refreshErr)
+		return nil, err
+	}
+
+	return a.parse(raw, audience)
+}
+
+func (a *oidcAuthContext) parse(raw string, audience string) (jwt.Token, error) {
+	return jwt.ParseString(
+		raw,
+		jwt.WithKeySet(a.keys),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(a.provider.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithAcceptableSkew(30*time.Second),
+	)
+}
+
+func (a *oidcAuthContext) userFromClaims(token jwt.Token) User {
+	claims := token.PrivateClaims()
+
+	username := claimString(token, a.config.UsernameClaim)
+	if username == "" {
+		username = token.Subject()
+	}
+
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	groups := claimStrings(claims, a.config.GroupsClaim)
+
+	if local := a.localUser(token); local != "" {
+		return externalUser(a.UsersDatabase, a.config.GroupMapping, local, email, name, groups)
+	}
+
+	return externalUser(nil, a.config.GroupMapping, username, email, name, groups)
+}
+
+// localUser returns the users.yml user named by the configured claim. Names like preferred_username can often be
+// chosen by users themselves, so nothing is matched unless the admin picked a claim the issuer vouches for.
+func (a *oidcAuthContext) localUser(token jwt.Token) string {
+	if a.config.LocalUserClaim == "" || a.UsersDatabase == nil {
+		return ""
+	}
+
+	username := claimString(token, a.config.LocalUserClaim)
+	if username == "" || a.UsersDatabase.Find(username) == nil {
+		return ""
+	}
+
+	return username
+}
+
+// claimString reads a string claim, registered claims like sub included
+func claimString(token jwt.Token, key string) string {
+	value, _ := token.Get(key)
+	str, _ := value.(string)
+
+	return str
+}
@@ -0,0 +1,344 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/goccy/go-json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockClientID     = "dockhook"
+	mockClientSecret = "secret"
+	mockRedirectURL  = "https://dockhook.example.com/api/oidc/callback"
+)
+
+type mockAuthorization struct {
+	nonce     string
+	challenge string
+}
+
+// mockIssuer is an in-process OpenID Connect provider with discovery, JWKS, authorize and token endpoints
+type mockIssuer struct {
+	*httptest.Server
+	t      *testing.T
+	key    jwk.Key
+	codes  map[string]mockAuthorization
+	groups []string
+	mu     sync.Mutex
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := jwk.FromRaw(raw)
+	require.NoError(t, err)
+	require.NoError(t, key.Set(jwk.KeyIDKey, "test-key"))
+	require.NoError(t, key.Set(jwk.AlgorithmKey, jwa.RS256))
+
+	issuer := &mockIssuer{t: t, key: key, codes: map[string]mockAuthorization{}, groups: []string{"ops"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(oidcProviderMetadata{
+		Issuer:                m.URL,
+		AuthorizationEndpoint: m.URL + "/authorize",
+		TokenEndpoint:         m.URL + "/token",
+		JWKSURI:               m.URL + "/jwks",
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	public, err := m.key.PublicKey()
+	require.NoError(m.t, err)
+
+	set := jwk.NewSet()
+	require.NoError(m.t, set.AddKey(public))
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+func (m *mockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.codes["code-123"] = mockAuthorization{nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	m.mu.Unlock()
+
+	http.Redirect(w, r, query.Get("redirect_uri")+"?code=code-123&state="+url.QueryEscape(query.Get("state")), http.StatusFound)
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != mockClientID || clientSecret != mockClientSecret {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		m.mu.Lock()
+		authorization, found := m.codes[r.PostFormValue("code")]
+		delete(m.codes, r.PostFormValue("code"))
+		m.mu.Unlock()
+
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !found || base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.challenge {
+			http.Error(w, "invalid grant", http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(oidcTokenResponse{
+			IDToken: m.sign(mockClientID, map[string]interface{}{
+				"sub":                "8d0f7c4e-jane",
+				"nonce":              authorization.nonce,
+				"preferred_username": "jane",
+				"email":              "jane@example.com",
+				"groups":             m.groups,
+			}),
+			TokenType: "Bearer",
+		})
+
+	case "client_credentials":
+		_ = json.NewEncoder(w).Encode(oidcTokenResponse{
+			AccessToken: m.sign(mockClientID, map[string]interface{}{"sub": "ci-runner", "azp": "dockhook", "groups": []string{"ci"}}),
+			TokenType:   "Bearer",
+		})
+
+	default:
+		http.Error(w, "unsupported grant type", http.StatusBadRequest)
+	}
+}
+
+func (m *mockIssuer) sign(audience string, claims map[string]interface{}) string {
+	token := jwt.New()
+	require.NoError(m.t, token.Set(jwt.IssuerKey, m.URL))
+	require.NoError(m.t, token.Set(jwt.AudienceKey, audience))
+	require.NoError(m.t, token.Set(jwt.SubjectKey, "subject"))
+	require.NoError(m.t, token.Set(jwt.IssuedAtKey, time.Now()))
+	require.NoError(m.t, token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour)))
+	for key, value := range claims {
+		require.NoError(m.t, token.Set(key, value))
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, m.key))
+	require.NoError(m.t, err)
+
+	return string(signed)
+}
+
+func newTestOIDCAuth(t *testing.T, issuer *mockIssuer) *oidcAuthContext {
+	mapping, err := ParseGroupMapping([]string{"ops=operator", "ci=webhook:c3413cb2-c1d2-7e8b-a329-8dff7bcfac86"})
+	require.NoError(t, err)
+
+	authContext, err := NewOIDCAuth(context.Background(), OIDCConfig{
+		Issuer:       issuer.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+		GroupMapping: mapping,
+		Base:         "/",
+		HTTPClient:   issuer.Client(),
+	}, nil)
+	require.NoError(t, err)
+
+	return authContext
+}
+
+func newOIDCTestRouter(authContext *oidcAuthContext, current **User) http.Handler {
+	r := chi.NewRouter()
+	r.Use(authContext.AuthMiddleware)
+	authContext.RegisterRoutes(r)
+	r.With(RequireAuthentication).Get("/protected", func(w http.ResponseWriter, r *http.Request) {
+		*current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return r
+}
+
+func Test_AuthOIDC_login_happy(t *testing.T) {
+	issuer := newMockIssuer(t)
+	authContext := newTestOIDCAuth(t, issuer)
+
+	var current *User
+	router := newOIDCTestRouter(authContext, &current)
+
+	// Start the login and follow the redirect to the issuer
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+	loginCookies := rec.Result().Cookies()
+
+	noRedirect := *issuer.Client()
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := noRedirect.Get(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	// Come back to DockHook with the code
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+callback.RawQuery, nil)
+	for _, cookie := range loginCookies {
+		req.AddCookie(cookie)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "jwt" {
+			session = cookie
+		}
+	}
+	require.NotNil(t, session, "expected session cookie")
+
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.AddCookie(session)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, current)
+	assert.Equal(t, "8d0f7c4e-jane", current.Username, "expected the stable subject as username")
+	assert.Equal(t, "jane@example.com", current.Email)
+	assert.Equal(t, []Role{RoleOperator}, current.Roles)
+}
+
+func Test_AuthOIDC_callback_state_mismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	authContext := newTestOIDCAuth(t, issuer)
+
+	var current *User
+	router := newOIDCTestRouter(authContext, &current)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=code-123&state=forged", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=code-123&state=forged", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "expected callback without login cookie to fail")
+}
+
+func Test_AuthOIDC_client_credentials(t *testing.T) {
+	issuer := newMockIssuer(t)
+	authContext := newTestOIDCAuth(t, issuer)
+
+	var current *User
+	router := newOIDCTestRouter(authContext, &current)
+
+	req, err := http.NewRequest(http.MethodPost, issuer.URL+"/token", strings.NewReader("grant_type=client_credentials"))
+	require.NoError(t, err)
+	req.SetBasicAuth(mockClientID, mockClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := issuer.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var tokens oidcTokenResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	accessToken := tokens.AccessToken
+
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, current)
+	assert.Equal(t, "ci-runner", current.Username)
+	assert.Equal(t, []string{"c3413cb2-c1d2-7e8b-a329-8dff7bcfac86"}, current.Webhooks)
+	assert.Empty(t, current.Roles)
+
+	req.Header.Set("Authorization", "Bearer "+issuer.sign("other-audience", map[string]interface{}{"azp": "ci-runner"}))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "expected token for another audience to be rejected")
+}
+
+func Test_AuthOIDC_local_user_claim(t *testing.T) {
+	issuer := newMockIssuer(t)
+	authContext := newTestOIDCAuth(t, issuer)
+	authContext.UsersDatabase = &UsersDatabase{Users: map[string]*User{
+		"jane": {Username: "jane", Roles: []Role{RoleAdmin}},
+	}}
+
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.SubjectKey, "8d0f7c4e-jane"))
+	require.NoError(t, token.Set("preferred_username", "jane"))
+	require.NoError(t, token.Set("azp", "jane"))
+	require.NoError(t, token.Set("groups", []interface{}{"ops"}))
+
+	current := authContext.userFromClaims(token)
+	assert.Equal(t, "8d0f7c4e-jane", current.Username)
+	assert.Equal(t, []Role{RoleOperator}, current.Roles, "expected local users not to be matched without a configured claim")
+
+	authContext.config.LocalUserClaim = "preferred_username"
+	current = authContext.userFromClaims(token)
+	assert.Equal(t, "jane", current.Username)
+	assert.Equal(t, []Role{RoleAdmin, RoleOperator}, current.Roles)
+
+	require.NoError(t, token.Set("preferred_username", "john"))
+	assert.Equal(t, "8d0f7c4e-jane", authContext.userFromClaims(token).Username, "expected unknown local users to be ignored")
+}
+
+func Test_NewOIDCAuth_issuer_mismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	_, err := NewOIDCAuth(context.Background(), OIDCConfig{
+		Issuer:      issuer.URL + "/other",
+		ClientID:    mockClientID,
+		RedirectURL: mockRedirectURL,
+		HTTPClient:  issuer.Client(),
+	}, nil)
+	assert.Error(t, err)
+}
@@ -1,46 +1,77 @@
 package user
 
 import (
-	"crypto/sha256"
+	"context"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/jwtauth/v5"
+	log "github.com/sirupsen/logrus"
 )
 
 type simpleAuthContext struct {
-	UsersDatabase UsersDatabase
-	tokenAuth     *jwtauth.JWTAuth
+	UsersDatabase *UsersDatabase
+	sessions      *SessionManager
 }
 
-func NewSimpleAuth(userDatabase UsersDatabase) *simpleAuthContext {
-	h := sha256.New()
-	for _, user := range userDatabase.Users {
-		h.Write([]byte(user.Password))
-	}
-
-	tokenAuth := jwtauth.New("HS256", h.Sum(nil), nil)
-
+func NewSimpleAuth(userDatabase *UsersDatabase, sessions *SessionManager) *simpleAuthContext {
 	return &simpleAuthContext{
 		UsersDatabase: userDatabase,
-		tokenAuth:     tokenAuth,
+		sessions:      sessions,
 	}
 }
 
 func (a *simpleAuthContext) CreateToken(username, password string) (string, error) {
+	return a.CreateTokenWithCode(username, password, "")
+}
+
+// CreateTokenWithCode also checks the one-time or recovery code of users with TOTP enabled
+func (a *simpleAuthContext) CreateTokenWithCode(username, password, code string) (string, error) {
 	user := a.UsersDatabase.FindByPassword(username, password)
 	if user == nil {
 		return "", ErrInvalidCredentials
 	}
 
-	_, tokenString, err := a.tokenAuth.Encode(map[string]interface{}{"username": user.Username, "email": user.Email, "name": user.Name, "timestamp": time.Now()})
-	if err != nil {
+	if err := a.UsersDatabase.VerifySecondFactor(username, code); err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	return a.sessions.Issue(user)
 }
 
+// AuthMiddleware verifies the session and takes the user from users.yml, so that changed roles and grants apply
+// right away and sessions of deleted users end
 func (a *simpleAuthContext) AuthMiddleware(next http.Handler) http.Handler {
-	return jwtauth.Verifier(a.tokenAuth)(next)
+	return a.sessions.Verifier(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, claims, err := jwtauth.FromContext(r.Context())
+		if err != nil || token == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, _ := claims["username"].(string)
+		user := a.UsersDatabase.Find(username)
+		if user == nil {
+			log.Warnf("Rejected session of unknown user %s", username)
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), nil, ErrUserNotFound)))
+			return
+		}
+
+		current := *user
+		current.Password = ""
+
+		ctx := context.WithValue(r.Context(), remoteUser, current)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
+// sessionClaims describes the user in a session token so that UserFromContext can restore it
+func sessionClaims(user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"username": user.Username,
+		"email":    user.Email,
+		"name":     user.Name,
+		"roles":    rolesToStrings(user.Roles),
+		"webhooks": user.Webhooks,
+		"hosts":    user.Hosts,
+	}
 }
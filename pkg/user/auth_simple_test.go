@@ -1,19 +1,22 @@
 package user
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/kekaadrenalin/dockhook/pkg/helper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_AuthSimple_CreateToken_happy(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewSimpleAuth(usersDB)
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
 
 	token, err := authContext.CreateToken("test_user", "test_pass")
 	assert.NoError(t, err)
@@ -21,12 +24,12 @@ func Test_AuthSimple_CreateToken_happy(t *testing.T) {
 }
 
 func Test_AuthSimple_CreateToken_error(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewSimpleAuth(usersDB)
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
 
 	token, err := authContext.CreateToken("test_user", "wrong_pass")
 	assert.Error(t, err)
@@ -35,12 +38,12 @@ func Test_AuthSimple_CreateToken_error(t *testing.T) {
 }
 
 func Test_AuthSimple_AuthMiddleware_happy(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewSimpleAuth(usersDB)
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
 
 	token, err := authContext.CreateToken("test_user", "test_pass")
 	assert.NoError(t, err)
@@ -48,14 +51,55 @@ func Test_AuthSimple_AuthMiddleware_happy(t *testing.T) {
 }
 
 func Test_AuthSimple_AuthMiddleware_wrong_password(t *testing.T) {
-	usersDB := UsersDatabase{
+	usersDB := &UsersDatabase{
 		Users: map[string]*User{
 			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass")},
 		},
 	}
-	authContext := NewSimpleAuth(usersDB)
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
 
 	token, err := authContext.CreateToken("test_user", "wrong_pass")
 	assert.Error(t, err)
 	assert.Empty(t, token)
 }
+
+func Test_AuthSimple_AuthMiddleware_current_user(t *testing.T) {
+	usersDB := &UsersDatabase{
+		Users: map[string]*User{
+			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass"), Roles: []Role{RoleAdmin}},
+			"admin":     {Username: "admin", Password: helper.Sha512sum("admin_pass"), Roles: []Role{RoleAdmin}},
+		},
+	}
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
+
+	token, err := authContext.CreateToken("test_user", "test_pass")
+	require.NoError(t, err)
+
+	var current *User
+	handler := authContext.AuthMiddleware(RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	_, err = usersDB.Update("test_user", func(user *User) error {
+		user.Roles = []Role{RoleReadOnly}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, get())
+	assert.Equal(t, []Role{RoleReadOnly}, current.Roles, "expected the demotion to apply to the running session")
+	assert.Empty(t, current.Password)
+
+	require.NoError(t, usersDB.Delete("test_user"))
+	assert.Equal(t, http.StatusUnauthorized, get(), "expected sessions of deleted users to end")
+}
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"net/http"
+	"time"
+)
+
+const SessionCookieName = "jwt"
+
+// CookieConfig sets the attributes of the cookies issued on login
+type CookieConfig struct {
+	Domain string
+	Path   string
+	// Secure is always set for requests received over TLS
+	Secure bool
+}
+
+// Cookie creates an HttpOnly cookie that expires after maxAge, or when the browser closes if maxAge is zero
+func (c CookieConfig) Cookie(r *http.Request, name, value string, maxAge time.Duration) *http.Cookie {
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Expired creates a cookie that deletes the cookie with the same name
+func (c CookieConfig) Expired(r *http.Request, name string) *http.Cookie {
+	cookie := c.Cookie(r, name, "", 0)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+
+	return cookie
+}
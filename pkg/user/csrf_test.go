@@ -0,0 +1,77 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RequireSameOrigin(t *testing.T) {
+	handler := RequireSameOrigin([]string{"https://admin.example.org/"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(method string, headers map[string]string, withCookie bool) int {
+		req := httptest.NewRequest(method, "http://dockhook.example.org/api/webhooks/1", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		if withCookie {
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "session"})
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, map[string]string{"Origin": "http://dockhook.example.org"}, true), "expected same origin to pass")
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, map[string]string{"Referer": "http://dockhook.example.org/ui"}, true), "expected same-origin referer to pass")
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"}, true), "expected fetch metadata to pass")
+	assert.Equal(t, http.StatusOK, request(http.MethodDelete, map[string]string{"Origin": "https://admin.example.org"}, true), "expected trusted origin to pass")
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, map[string]string{"Origin": "https://evil.example.com"}, true), "expected foreign origin to be rejected")
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, map[string]string{"Origin": "null"}, true), "expected opaque origin to be rejected")
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, nil, true), "expected request without origin to be rejected")
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, map[string]string{"Origin": "https://evil.example.com"}, true), "expected safe methods to be exempt")
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, map[string]string{"Origin": "https://evil.example.com"}, false), "expected requests without the cookie to be exempt")
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, map[string]string{"Authorization": "Bearer dh_token"}, true), "expected bearer callers to be exempt")
+}
+
+func Test_CheckWebSocketOrigin(t *testing.T) {
+	check := CheckWebSocketOrigin([]string{"https://admin.example.org"})
+
+	request := func(origin string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://dockhook.example.org/api/events/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		return req
+	}
+
+	assert.True(t, check(request("http://dockhook.example.org")), "expected same origin to pass")
+	assert.True(t, check(request("https://admin.example.org")), "expected trusted origin to pass")
+	assert.True(t, check(request("")), "expected clients without origin to pass")
+	assert.False(t, check(request("https://evil.example.com")), "expected foreign origin to be rejected")
+	assert.False(t, check(request("null")), "expected opaque origin to be rejected")
+}
+
+func Test_CookieConfig(t *testing.T) {
+	config := CookieConfig{Domain: "example.org", Path: "/dockhook"}
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.org/dockhook/api/token", nil)
+	cookie := config.Cookie(req, SessionCookieName, "token", 0)
+	assert.Equal(t, "/dockhook", cookie.Path)
+	assert.Equal(t, "example.org", cookie.Domain)
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure, "expected plain HTTP to stay without Secure")
+
+	req = httptest.NewRequest(http.MethodPost, "https://example.org/dockhook/api/token", nil)
+	assert.True(t, config.Cookie(req, SessionCookieName, "token", 0).Secure, "expected TLS requests to get Secure cookies")
+	assert.Equal(t, -1, config.Expired(req, SessionCookieName).MaxAge)
+}
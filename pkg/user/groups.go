@@ -0,0 +1,94 @@
+package user
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GroupMapping maps identity provider groups to roles ("ops=operator") or grants ("ci=webhook:<uuid>", "edge=host:<host>")
+type GroupMapping map[string][]string
+
+func ParseGroupMapping(values []string) (GroupMapping, error) {
+	mapping := GroupMapping{}
+
+	for _, value := range values {
+		// Groups may be distinguished names, which contain "=" themselves, roles and grants never do
+		separator := strings.LastIndex(value, "=")
+		if separator <= 0 || separator == len(value)-1 {
+			return nil, fmt.Errorf("group mapping should be of the form group=role: %s", value)
+		}
+
+		group, target := value[:separator], value[separator+1:]
+
+		kind, name, isGrant := strings.Cut(target, ":")
+		switch {
+		case isGrant && (kind == "webhook" || kind == "host") && name != "":
+		case isGrant:
+			return nil, fmt.Errorf("unknown grant in group mapping: %s", value)
+		default:
+			if _, err := ParseRoles([]string{target}); err != nil {
+				return nil, err
+			}
+		}
+
+		mapping[group] = append(mapping[group], target)
+	}
+
+	return mapping, nil
+}
+
+// Apply adds the roles and grants of every mapped group to the user
+func (m GroupMapping) Apply(user *User, groups []string) {
+	for _, group := range groups {
+		for _, target := range m[group] {
+			kind, name, isGrant := strings.Cut(target, ":")
+
+			switch {
+			case isGrant && kind == "webhook":
+				user.Webhooks = appendUnique(user.Webhooks, name)
+			case isGrant && kind == "host":
+				user.Hosts = appendUnique(user.Hosts, name)
+			case !slices.Contains(user.Roles, Role(target)):
+				user.Roles = append(user.Roles, Role(target))
+			}
+		}
+	}
+}
+
+// externalUser builds the user for an identity asserted by an external provider.
+// Roles and grants from users.yml, when the user exists there, are kept and extended by the group mapping.
+func externalUser(users *UsersDatabase, mapping GroupMapping, username, email, name string, groups []string) User {
+	user := newUser(username, email, name)
+
+	if users != nil {
+		if known := users.Find(username); known != nil {
+			user.Roles = slices.Clone(known.Roles)
+			user.Webhooks = slices.Clone(known.Webhooks)
+			user.Hosts = slices.Clone(known.Hosts)
+
+			if user.Email == "" {
+				user.Email = known.Email
+			}
+			if name == "" {
+				user.Name = known.Name
+			}
+		}
+	}
+
+	if user.Name == "" {
+		user.Name = username
+	}
+
+	mapping.Apply(&user, groups)
+
+	return user
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+
+	return append(values, value)
+}
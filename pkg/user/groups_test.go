@@ -0,0 +1,38 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseGroupMapping_happy(t *testing.T) {
+	mapping, err := ParseGroupMapping([]string{"ops=operator", "ops=host:edge", "ci=webhook:abc"})
+	require.NoError(t, err)
+
+	user := newUser("jane", "", "")
+	mapping.Apply(&user, []string{"ops", "ci", "unknown"})
+
+	assert.Equal(t, []Role{RoleOperator}, user.Roles)
+	assert.Equal(t, []string{"edge"}, user.Hosts)
+	assert.Equal(t, []string{"abc"}, user.Webhooks)
+}
+
+func Test_ParseGroupMapping_distinguished_name(t *testing.T) {
+	mapping, err := ParseGroupMapping([]string{"cn=admins,ou=ops,dc=example,dc=org=admin"})
+	require.NoError(t, err)
+
+	assert.Equal(t, GroupMapping{"cn=admins,ou=ops,dc=example,dc=org": {"admin"}}, mapping)
+}
+
+func Test_ParseGroupMapping_error(t *testing.T) {
+	tests := []string{"ops", "=admin", "ops=", "ops=root", "ops=container:abc", "ops=host:"}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			_, err := ParseGroupMapping([]string{test})
+			assert.Error(t, err)
+		})
+	}
+}
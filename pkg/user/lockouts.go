@@ -0,0 +1,462 @@
+package user
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultLockoutMaxFailures = 5
+	DefaultLockoutBaseDelay   = time.Minute
+	DefaultLockoutMaxDelay    = time.Hour
+	DefaultLockoutWindow      = 15 * time.Minute
+
+	// clientRate and clientBurst limit failed logins per client address, whatever the username
+	clientRate  = rate.Limit(1)
+	clientBurst = 5
+)
+
+// maxTrackedLockouts and maxTrackedClients cap what is kept in memory, so that guessing many usernames
+// from many addresses cannot exhaust it
+var (
+	maxTrackedLockouts = 10000
+	maxTrackedClients  = 10000
+)
+
+type LockoutPolicy struct {
+	// MaxFailures is the number of failed logins that triggers a lockout
+	MaxFailures int
+	// BaseDelay is the first lockout, doubled for every following lockout up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window forgets failures and past lockouts after a quiet period
+	Window time.Duration
+}
+
+type Lockout struct {
+	Username     string    `json:"username" yaml:"username"`
+	IP           string    `json:"ip" yaml:"ip"`
+	Failures     int       `json:"failures" yaml:"failures"`
+	Lockouts     int       `json:"lockouts" yaml:"lockouts"`
+	LastFailure  time.Time `json:"lastFailure" yaml:"lastFailure"`
+	BlockedUntil time.Time `json:"blockedUntil,omitempty" yaml:"blockedUntil,omitempty"`
+}
+
+// LockoutsDatabase tracks failed logins per username and client IP, so that guessing a username
+// from one address does not lock the user out everywhere. Only blocked entries are written to the file.
+type LockoutsDatabase struct {
+	Lockouts       map[string]*Lockout `yaml:"lockouts"`
+	Policy         LockoutPolicy       `yaml:"-"`
+	TrustedProxies []*net.IPNet        `yaml:"-"`
+	LastRead       time.Time           `yaml:"-"`
+	Path           string              `yaml:"-"`
+
+	clients map[string]*rate.Limiter
+	// mu guards Lockouts and clients against concurrent logins and reloads
+	mu sync.Mutex
+}
+
+func (l *Lockout) IsBlocked() bool {
+	return time.Now().Before(l.BlockedUntil)
+}
+
+// lastActivity is the end of the last lockout or the last failure, whichever is later
+func (l *Lockout) lastActivity() time.Time {
+	if l.BlockedUntil.After(l.LastFailure) {
+		return l.BlockedUntil
+	}
+
+	return l.LastFailure
+}
+
+func ReadLockoutsFromFile(path string) (*LockoutsDatabase, error) {
+	lockouts, err := decodeLockoutsFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LockoutsDatabase{Lockouts: lockouts, LastRead: time.Now(), Path: path}, nil
+}
+
+// Blocked returns how long logins of the user from the client of the request are still blocked,
+// or how long the client has to wait after failing too often. It does not count as an attempt.
+func (d *LockoutsDatabase) Blocked(r *http.Request, username string) time.Duration {
+	ip := d.clientIP(r)
+	if delay := d.throttled(ip); delay > 0 {
+		return delay
+	}
+
+	if err := d.readFileIfChanged(); err != nil {
+		log.Errorf("Could not read lockouts: %s", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lockout, found := d.Lockouts[lockoutKey(username, ip)]
+	if !found || !lockout.IsBlocked() {
+		return 0
+	}
+
+	return time.Until(lockout.BlockedUntil)
+}
+
+// Failed records a failed login and returns the lockout it caused, if any
+func (d *LockoutsDatabase) Failed(r *http.Request, username string) time.Duration {
+	policy := d.policy()
+	ip := d.clientIP(r)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Lockouts == nil {
+		d.Lockouts = map[string]*Lockout{}
+	}
+
+	key := lockoutKey(username, ip)
+	lockout := Lockout{Username: username, IP: ip}
+	if existing, found := d.Lockouts[key]; found && now.Sub(existing.lastActivity()) < policy.Window {
+		lockout = *existing
+	}
+
+	lockout.Failures++
+	lockout.LastFailure = now
+	metrics.AuthFailures.WithLabelValues("password").Inc()
+	d.clientLimiter(ip).Allow()
+
+	var delay time.Duration
+	if lockout.Failures >= policy.MaxFailures {
+		delay = policy.BaseDelay << lockout.Lockouts
+		if delay > policy.MaxDelay || delay <= 0 {
+			delay = policy.MaxDelay
+		}
+
+		lockout.Failures = 0
+		lockout.Lockouts++
+		lockout.BlockedUntil = now.Add(delay)
+
+		metrics.Lockouts.Inc()
+		log.Warnf("Blocked logins of user %s from %s for %s", username, ip, delay)
+	}
+
+	d.Lockouts[key] = &lockout
+	d.prune(now)
+	d.evict()
+
+	if delay == 0 {
+		return 0
+	}
+
+	if err := d.save(); err != nil {
+		log.Errorf("Could not save lockouts: %s", err)
+	}
+
+	return delay
+}
+
+// Succeeded forgets the failures of the user from the client of the request
+func (d *LockoutsDatabase) Succeeded(r *http.Request, username string) {
+	key := lockoutKey(username, d.clientIP(r))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lockout, found := d.Lockouts[key]
+	if !found {
+		return
+	}
+
+	delete(d.Lockouts, key)
+
+	// Failures without a lockout were never written to the file
+	if lockout.BlockedUntil.IsZero() {
+		return
+	}
+
+	if err := d.save(); err != nil {
+		log.Errorf("Could not save lockouts: %s", err)
+	}
+}
+
+// List returns the tracked lockouts, blocked ones first
+func (d *LockoutsDatabase) List() []Lockout {
+	if err := d.readFileIfChanged(); err != nil {
+		log.Errorf("Could not read lockouts: %s", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]Lockout, 0, len(d.Lockouts))
+	for _, lockout := range d.Lockouts {
+		result = append(result, *lockout)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IsBlocked() != result[j].IsBlocked() {
+			return result[i].IsBlocked()
+		}
+
+		return result[i].LastFailure.After(result[j].LastFailure)
+	})
+
+	return result
+}
+
+// Unblock removes the lockouts of a user, from every address when ip is empty, and returns how many were removed
+func (d *LockoutsDatabase) Unblock(username, ip string) (int, error) {
+	if err := d.readFileIfChanged(); err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	removed := 0
+	for key, lockout := range d.Lockouts {
+		if lockout.Username == username && (ip == "" || lockout.IP == ip) {
+			delete(d.Lockouts, key)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	return removed, d.save()
+}
+
+// TooManyRequests rejects a login attempt during a lockout
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+func (d *LockoutsDatabase) policy() LockoutPolicy {
+	policy := d.Policy
+	if policy.MaxFailures <= 0 {
+		policy.MaxFailures = DefaultLockoutMaxFailures
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultLockoutBaseDelay
+	}
+	if policy.MaxDelay < policy.BaseDelay {
+		policy.MaxDelay = max(DefaultLockoutMaxDelay, policy.BaseDelay)
+	}
+	if policy.Window <= 0 {
+		policy.Window = DefaultLockoutWindow
+	}
+
+	return policy
+}
+
+func (d *LockoutsDatabase) clientIP(r *http.Request) string {
+	ip := helper.ClientIP(r, d.TrustedProxies)
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// prune drops entries that are neither blocked nor recent; callers must hold d.mu
+func (d *LockoutsDatabase) prune(now time.Time) {
+	window := d.policy().Window
+
+	for key, lockout := range d.Lockouts {
+		if now.Sub(lockout.lastActivity()) > window {
+			delete(d.Lockouts, key)
+		}
+	}
+}
+
+// evict drops the oldest entries beyond maxTrackedLockouts, failures before lockouts; callers must hold d.mu
+func (d *LockoutsDatabase) evict() {
+	if len(d.Lockouts) <= maxTrackedLockouts {
+		return
+	}
+
+	keys := make([]string, 0, len(d.Lockouts))
+	for key := range d.Lockouts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := d.Lockouts[keys[i]], d.Lockouts[keys[j]]
+		if a.IsBlocked() != b.IsBlocked() {
+			return b.IsBlocked()
+		}
+
+		return a.lastActivity().Before(b.lastActivity())
+	})
+
+	// Dropping a tenth at once keeps a flood of failures from sorting on every one of them
+	for _, key := range keys[:len(keys)-maxTrackedLockouts*9/10] {
+		delete(d.Lockouts, key)
+	}
+}
+
+// throttled returns how long the client has to wait until it may fail another login
+func (d *LockoutsDatabase) throttled(ip string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	limiter, found := d.clients[ip]
+	if !found {
+		return 0
+	}
+
+	tokens := limiter.Tokens()
+	if tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - tokens) / float64(clientRate) * float64(time.Second))
+}
+
+// clientLimiter returns the limiter of failed logins of the client; callers must hold d.mu
+func (d *LockoutsDatabase) clientLimiter(ip string) *rate.Limiter {
+	if len(d.clients) >= maxTrackedClients {
+		// Limiters that have refilled hold no state
+		for client, limiter := range d.clients {
+			if limiter.Tokens() >= clientBurst {
+				delete(d.clients, client)
+			}
+		}
+
+		if len(d.clients) >= maxTrackedClients {
+			d.clients = nil
+		}
+	}
+
+	if d.clients == nil {
+		d.clients = map[string]*rate.Limiter{}
+	}
+
+	limiter, found := d.clients[ip]
+	if !found {
+		limiter = rate.NewLimiter(clientRate, clientBurst)
+		d.clients[ip] = limiter
+	}
+
+	return limiter
+}
+
+// save writes the blocked entries to the file; callers must hold d.mu
+func (d *LockoutsDatabase) save() error {
+	if d.Path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.Path), 0700); err != nil {
+		return err
+	}
+
+	blocked := map[string]*Lockout{}
+	for key, lockout := range d.Lockouts {
+		if lockout.IsBlocked() {
+			blocked[key] = lockout
+		}
+	}
+
+	data, err := yaml.Marshal(&LockoutsDatabase{Lockouts: blocked})
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(d.Path, data, 0600); err != nil {
+		return err
+	}
+
+	d.LastRead = time.Now()
+
+	return nil
+}
+
+func decodeLockoutsFromFile(path string) (map[string]*Lockout, error) {
+	var lockouts struct {
+		Lockouts map[string]*Lockout `yaml:"lockouts"`
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]*Lockout{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := yaml.NewDecoder(file).Decode(&lockouts); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if lockouts.Lockouts == nil {
+		lockouts.Lockouts = map[string]*Lockout{}
+	}
+
+	return lockouts.Lockouts, nil
+}
+
+// readFileIfChanged picks up unblocks made by another process, e.g. the unblock command
+func (d *LockoutsDatabase) readFileIfChanged() error {
+	if d.Path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(d.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !info.ModTime().After(d.LastRead) {
+		return nil
+	}
+
+	log.Debugf("Found changes to %s. Updating lockouts...", d.Path)
+	lockouts, err := decodeLockoutsFromFile(d.Path)
+	if err != nil {
+		return err
+	}
+
+	// Failures below the limit are only kept in memory
+	for key, lockout := range d.Lockouts {
+		if _, found := lockouts[key]; !found && !lockout.IsBlocked() {
+			lockouts[key] = lockout
+		}
+	}
+
+	d.Lockouts = lockouts
+	d.LastRead = time.Now()
+
+	return nil
+}
+
+func lockoutKey(username, ip string) string {
+	return strings.ToLower(username) + "|" + ip
+}
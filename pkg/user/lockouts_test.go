@@ -0,0 +1,169 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoginRequest(remoteAddr string, forwardedFor string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/token", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	return req
+}
+
+func Test_LockoutsDatabase_Failed_backoff(t *testing.T) {
+	lockouts := LockoutsDatabase{Policy: LockoutPolicy{MaxFailures: 3, BaseDelay: time.Minute, MaxDelay: 3 * time.Minute}}
+	req := newLoginRequest("192.0.2.1:1234", "")
+
+	assert.Zero(t, lockouts.Failed(req, "test_user"))
+	assert.Zero(t, lockouts.Failed(req, "test_user"))
+	assert.Equal(t, time.Minute, lockouts.Failed(req, "test_user"), "expected first lockout")
+	assert.Greater(t, lockouts.Blocked(req, "test_user"), 59*time.Second)
+
+	other := newLoginRequest("198.51.100.7:1234", "")
+	assert.Zero(t, lockouts.Blocked(other, "test_user"), "expected other addresses to stay unblocked")
+
+	// The lockout has passed; the next ones back off exponentially up to the maximum
+	lockouts.Lockouts[lockoutKey("test_user", "192.0.2.1")].BlockedUntil = time.Now()
+	for i := 0; i < 2; i++ {
+		lockouts.Failed(req, "test_user")
+	}
+	assert.Equal(t, 2*time.Minute, lockouts.Failed(req, "test_user"))
+
+	lockouts.Lockouts[lockoutKey("test_user", "192.0.2.1")].BlockedUntil = time.Now()
+	for i := 0; i < 2; i++ {
+		lockouts.Failed(req, "test_user")
+	}
+	assert.Equal(t, 3*time.Minute, lockouts.Failed(req, "test_user"))
+
+	lockouts.Succeeded(req, "test_user")
+	assert.Greater(t, lockouts.Blocked(req, "test_user"), time.Duration(0), "expected the address to stay throttled for failing quickly")
+	lockouts.clients = nil
+	assert.Zero(t, lockouts.Blocked(req, "test_user"))
+	assert.Empty(t, lockouts.List())
+}
+
+func Test_LockoutsDatabase_Failed_window(t *testing.T) {
+	lockouts := LockoutsDatabase{Policy: LockoutPolicy{MaxFailures: 2, Window: time.Minute}}
+	req := newLoginRequest("192.0.2.1:1234", "")
+
+	lockouts.Failed(req, "test_user")
+	lockouts.Lockouts[lockoutKey("test_user", "192.0.2.1")].LastFailure = time.Now().Add(-2 * time.Minute)
+
+	assert.Zero(t, lockouts.Failed(req, "test_user"), "expected old failures to be forgotten")
+}
+
+func Test_LockoutsDatabase_trusted_proxies(t *testing.T) {
+	trusted, err := helper.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	lockouts := LockoutsDatabase{Policy: LockoutPolicy{MaxFailures: 1}, TrustedProxies: trusted}
+
+	lockouts.Failed(newLoginRequest("10.0.0.2:1234", "192.0.2.1"), "test_user")
+
+	assert.NotZero(t, lockouts.Blocked(newLoginRequest("10.0.0.2:1234", "192.0.2.1"), "test_user"))
+	assert.Zero(t, lockouts.Blocked(newLoginRequest("10.0.0.2:1234", "198.51.100.7"), "test_user"),
+		"expected clients behind the same proxy to be told apart")
+	assert.Zero(t, lockouts.Blocked(newLoginRequest("203.0.113.9:1234", "192.0.2.1"), "test_user"),
+		"expected forwarded addresses from untrusted peers to be ignored")
+}
+
+func Test_LockoutsDatabase_Unblock_persisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockouts.yml")
+	lockouts, err := ReadLockoutsFromFile(path)
+	require.NoError(t, err)
+	lockouts.Policy = LockoutPolicy{MaxFailures: 1}
+
+	lockouts.Failed(newLoginRequest("192.0.2.1:1234", ""), "test_user")
+	lockouts.Failed(newLoginRequest("198.51.100.7:1234", ""), "test_user")
+	lockouts.Failed(newLoginRequest("192.0.2.1:1234", ""), "other_user")
+
+	// Another process, e.g. the unblock command, sees and edits the same file
+	admin, err := ReadLockoutsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, admin.List(), 3, "expected lockouts to be persisted")
+	assert.True(t, admin.List()[0].IsBlocked())
+
+	removed, err := admin.Unblock("test_user", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	removed, err = admin.Unblock("test_user", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	lockouts.LastRead = time.Time{}
+	assert.Zero(t, lockouts.Blocked(newLoginRequest("198.51.100.7:1234", ""), "test_user"), "expected unblock to be picked up")
+	assert.NotZero(t, lockouts.Blocked(newLoginRequest("192.0.2.1:1234", ""), "other_user"))
+}
+
+func Test_LockoutsDatabase_Blocked_throttle(t *testing.T) {
+	lockouts := LockoutsDatabase{}
+	req := newLoginRequest("192.0.2.1:1234", "")
+
+	for i := 0; i < 2*clientBurst; i++ {
+		require.Zero(t, lockouts.Blocked(req, "test_user"), "expected checks without failures not to be throttled")
+	}
+
+	for i := 0; i < clientBurst; i++ {
+		require.Zero(t, lockouts.Blocked(req, "user"+strconv.Itoa(i)))
+		lockouts.Failed(req, "user"+strconv.Itoa(i))
+	}
+
+	assert.Greater(t, lockouts.Blocked(req, "another_user"), time.Duration(0), "expected the address to be throttled across usernames")
+	assert.Zero(t, lockouts.Blocked(newLoginRequest("198.51.100.7:1234", ""), "another_user"), "expected other addresses not to be throttled")
+}
+
+func Test_LockoutsDatabase_Failed_evict(t *testing.T) {
+	defer func(previous int) { maxTrackedLockouts = previous }(maxTrackedLockouts)
+	maxTrackedLockouts = 10
+
+	lockouts := LockoutsDatabase{Policy: LockoutPolicy{MaxFailures: 2}}
+	req := newLoginRequest("192.0.2.1:1234", "")
+
+	lockouts.Failed(req, "blocked_user")
+	lockouts.Failed(req, "blocked_user")
+	for i := 0; i < 20; i++ {
+		lockouts.Failed(req, "user"+strconv.Itoa(i))
+	}
+
+	assert.LessOrEqual(t, len(lockouts.Lockouts), maxTrackedLockouts)
+	assert.Contains(t, lockouts.Lockouts, lockoutKey("blocked_user", "192.0.2.1"), "expected lockouts to outlive failures")
+	assert.Contains(t, lockouts.Lockouts, lockoutKey("user19", "192.0.2.1"), "expected the newest failures to be kept")
+	assert.NotContains(t, lockouts.Lockouts, lockoutKey("user0", "192.0.2.1"))
+}
+
+func Test_LockoutsDatabase_save_blocked_only(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockouts.yml")
+	lockouts, err := ReadLockoutsFromFile(path)
+	require.NoError(t, err)
+	lockouts.Policy = LockoutPolicy{MaxFailures: 2}
+
+	lockouts.Failed(newLoginRequest("192.0.2.1:1234", ""), "test_user")
+	assert.NoFileExists(t, path, "expected failures below the limit not to be written")
+
+	lockouts.Failed(newLoginRequest("198.51.100.7:1234", ""), "test_user")
+	lockouts.Failed(newLoginRequest("198.51.100.7:1234", ""), "test_user")
+
+	stored, err := ReadLockoutsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, stored.Lockouts, 1)
+	assert.Contains(t, stored.Lockouts, lockoutKey("test_user", "198.51.100.7"))
+
+	// Reading changes of another process keeps the failures only known in memory
+	lockouts.LastRead = time.Time{}
+	lockouts.Blocked(newLoginRequest("192.0.2.1:1234", ""), "test_user")
+	assert.Len(t, lockouts.List(), 2)
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+)
+
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleOperator Role = "operator"
+	RoleReadOnly Role = "read-only"
+)
+
+var Roles = []Role{
+	RoleAdmin,
+	RoleOperator,
+	RoleReadOnly,
+}
+
+type Permission string
+
+const (
+	// PermissionRead allows viewing hosts, containers and webhooks
+	PermissionRead Permission = "read"
+	// PermissionTrigger allows firing any webhook on any host
+	PermissionTrigger Permission = "trigger"
+	// PermissionManage allows managing users, tokens and other server state
+	PermissionManage Permission = "manage"
+)
+
+var Permissions = []Permission{
+	PermissionRead,
+	PermissionTrigger,
+	PermissionManage,
+}
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:    {PermissionRead, PermissionTrigger, PermissionManage},
+	RoleOperator: {PermissionRead, PermissionTrigger},
+	RoleReadOnly: {PermissionRead},
+}
+
+// ParseRoles converts role names and rejects unknown ones
+func ParseRoles(names []string) ([]Role, error) {
+	roles := make([]Role, 0, len(names))
+	for _, name := range names {
+		role := Role(name)
+		if !slices.Contains(Roles, role) {
+			return nil, fmt.Errorf("unknown role: %s", name)
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+func (u *User) HasRole(role Role) bool {
+	return slices.Contains(u.Roles, role)
+}
+
+// Can reports whether any role of the user grants the permission
+func (u *User) Can(permission Permission) bool {
+	for _, role := range u.Roles {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanTrigger reports whether the user may fire the webhook, either through a role or a webhook or host grant
+func (u *User) CanTrigger(webhook *types.Webhook) bool {
+	if u.Can(PermissionTrigger) {
+		return true
+	}
+
+	return slices.Contains(u.Webhooks, webhook.UUID) || slices.Contains(u.Hosts, webhook.Host)
+}
+
+// Demoted reports whether the user lost a role or a webhook or host grant
+func Demoted(before, after User) bool {
+	for _, role := range before.Roles {
+		if !after.HasRole(role) {
+			return true
+		}
+	}
+
+	for _, webhook := range before.Webhooks {
+		if !slices.Contains(after.Webhooks, webhook) {
+			return true
+		}
+	}
+
+	for _, host := range before.Hosts {
+		if !slices.Contains(after.Hosts, host) {
+			return true
+		}
+	}
+
+	return false
+}
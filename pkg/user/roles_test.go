@@ -0,0 +1,109 @@
+package user
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_User_Can(t *testing.T) {
+	admin := User{Roles: []Role{RoleAdmin}}
+	operator := User{Roles: []Role{RoleOperator}}
+	readOnly := User{Roles: []Role{RoleReadOnly}}
+
+	assert.True(t, admin.Can(PermissionManage))
+	assert.True(t, operator.Can(PermissionTrigger))
+	assert.False(t, operator.Can(PermissionManage))
+	assert.True(t, readOnly.Can(PermissionRead))
+	assert.False(t, readOnly.Can(PermissionTrigger))
+	assert.False(t, (&User{}).Can(PermissionRead))
+}
+
+func Test_User_CanTrigger(t *testing.T) {
+	webhook := &types.Webhook{UUID: "c3413cb2-c1d2-7e8b-a329-8dff7bcfac86", Host: "localhost", Action: types.ActionStart}
+
+	tests := []struct {
+		name     string
+		user     User
+		expected bool
+	}{
+		{"operator", User{Roles: []Role{RoleOperator}}, true},
+		{"read-only", User{Roles: []Role{RoleReadOnly}}, false},
+		{"webhook grant", User{Roles: []Role{RoleReadOnly}, Webhooks: []string{webhook.UUID}}, true},
+		{"other webhook grant", User{Webhooks: []string{"other"}}, false},
+		{"host grant", User{Hosts: []string{"localhost"}}, true},
+		{"other host grant", User{Hosts: []string{"remote"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.user.CanTrigger(webhook))
+		})
+	}
+}
+
+func Test_ParseRoles(t *testing.T) {
+	roles, err := ParseRoles([]string{"admin", "read-only"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Role{RoleAdmin, RoleReadOnly}, roles)
+
+	_, err = ParseRoles([]string{"root"})
+	assert.Error(t, err)
+}
+
+func Test_UserFromContext_jwt_roles(t *testing.T) {
+	usersDB := &UsersDatabase{
+		Users: map[string]*User{
+			"test_user": {
+				Username: "test_user",
+				Password: helper.Sha512sum("test_pass"),
+				Roles:    []Role{RoleReadOnly},
+				Webhooks: []string{"c3413cb2-c1d2-7e8b-a329-8dff7bcfac86"},
+			},
+		},
+	}
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
+
+	tokenString, err := authContext.CreateToken("test_user", "test_pass")
+	require.NoError(t, err)
+
+	token, err := authContext.sessions.Verify(tokenString)
+	require.NoError(t, err)
+
+	current := UserFromContext(jwtauth.NewContext(context.Background(), token, nil))
+	require.NotNil(t, current)
+	assert.Equal(t, []Role{RoleReadOnly}, current.Roles)
+	assert.Equal(t, []string{"c3413cb2-c1d2-7e8b-a329-8dff7bcfac86"}, current.Webhooks)
+}
+
+func Test_ReadUsersFromFile_no_roles(t *testing.T) {
+	tmpFile, err := createTempFile(t, generateYml(t, User{Username: "test_user", Password: helper.Sha512sum("test_pass")}))
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	users, err := ReadUsersFromFile(tmpFile.Name())
+	require.NoError(t, err)
+	current := users.Find("test_user")
+	assert.Empty(t, current.Roles, "expected users without roles not to become admins")
+	assert.False(t, current.Can(PermissionRead))
+	assert.False(t, current.Can(PermissionManage))
+
+	require.NoError(t, users.save(users.Users))
+	users, err = ReadUsersFromFile(tmpFile.Name())
+	require.NoError(t, err)
+	assert.Empty(t, users.Find("test_user").Roles, "expected no role to be written back")
+}
+
+func Test_Demoted(t *testing.T) {
+	before := User{Roles: []Role{RoleOperator}, Hosts: []string{"h1"}}
+
+	assert.False(t, Demoted(before, User{Roles: []Role{RoleOperator, RoleAdmin}, Hosts: []string{"h1"}}))
+	assert.True(t, Demoted(before, User{Roles: []Role{RoleReadOnly}, Hosts: []string{"h1"}}))
+	assert.True(t, Demoted(before, User{Roles: []Role{RoleOperator}}))
+}
@@ -0,0 +1,532 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultSessionTTL    = 12 * time.Hour
+	DefaultSessionMaxAge = 7 * 24 * time.Hour
+
+	sessionKeySize = 32
+
+	// authTimeClaim keeps the time of the original login across refreshes
+	authTimeClaim = "auth_time"
+)
+
+var (
+	ErrSessionRevoked = errors.New("session revoked")
+	ErrSessionTooOld  = errors.New("session is too old to be refreshed")
+)
+
+type SessionKey struct {
+	ID      string    `yaml:"id"`
+	Secret  string    `yaml:"secret"`
+	Created time.Time `yaml:"created"`
+}
+
+type sessionKeysFile struct {
+	Keys []SessionKey `yaml:"keys"`
+}
+
+type revokedSessionsFile struct {
+	Sessions map[string]time.Time `yaml:"sessions"`
+	// Users rejects the sessions of each user issued before the time, e.g. after the user was deleted or demoted
+	Users map[string]time.Time `yaml:"users,omitempty"`
+}
+
+// SessionManager signs session tokens with keys kept in the data directory and tracks revoked sessions.
+// The newest key signs new tokens; older keys keep verifying until their tokens have expired.
+type SessionManager struct {
+	KeysPath    string
+	RevokedPath string
+	TTL         time.Duration
+	MaxAge      time.Duration
+
+	keys         []SessionKey
+	keySet       jwk.Set
+	keysRead     time.Time
+	revoked      map[string]time.Time
+	revokedUsers map[string]time.Time
+	revokedRead  time.Time
+	mu           sync.Mutex
+}
+
+// NewSessionManager loads the signing keys and revocation list, generating a first key when there is none.
+// Empty paths keep everything in memory.
+func NewSessionManager(keysPath, revokedPath string, ttl, maxAge time.Duration) (*SessionManager, error) {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	if maxAge < ttl {
+		maxAge = ttl
+	}
+
+	m := &SessionManager{
+		KeysPath:    keysPath,
+		RevokedPath: revokedPath,
+		TTL:         ttl,
+		MaxAge:      maxAge,
+	}
+
+	if err := m.readKeys(); err != nil {
+		return nil, err
+	}
+
+	if len(m.keys) == 0 {
+		if _, err := m.Rotate(false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.readRevoked(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Issue signs a session token for the user
+func (m *SessionManager) Issue(user *User) (string, error) {
+	return m.issue(user, time.Now())
+}
+
+// Refresh replaces a valid session token with a new one and revokes the old one.
+// The login time is carried over so that sessions cannot be extended past MaxAge.
+func (m *SessionManager) Refresh(token jwt.Token, user *User) (string, error) {
+	authTime := token.IssuedAt()
+	if value, ok := token.PrivateClaims()[authTimeClaim].(float64); ok {
+		authTime = time.Unix(int64(value), 0)
+	}
+
+	if time.Since(authTime) > m.MaxAge {
+		return "", ErrSessionTooOld
+	}
+
+	refreshed, err := m.issue(user, authTime)
+	if err != nil {
+		return "", err
+	}
+
+	if err := m.Revoke(token); err != nil {
+		return "", err
+	}
+
+	return refreshed, nil
+}
+
+// Verify checks the signature, expiry and revocation of a session token
+func (m *SessionManager) Verify(tokenString string) (jwt.Token, error) {
+	if err := m.readKeysIfChanged(); err != nil {
+		log.Errorf("Could not reload session keys: %s", err)
+	}
+
+	m.mu.Lock()
+	keySet := m.keySet
+	m.mu.Unlock()
+
+	token, err := jwt.ParseString(tokenString,
+		jwt.WithKeySet(keySet),
+		jwt.WithValidate(true),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithRequiredClaim(jwt.JwtIDKey),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.readRevokedIfChanged(); err != nil {
+		log.Errorf("Could not reload revoked sessions: %s", err)
+	}
+
+	username, _ := token.PrivateClaims()["username"].(string)
+	if m.IsRevoked(token.JwtID()) || m.isUserRevoked(username, token.IssuedAt()) {
+		return nil, ErrSessionRevoked
+	}
+
+	return token, nil
+}
+
+// Verifier reads the session token from the Authorization header or the jwt cookie, like jwtauth.Verifier
+func (m *SessionManager) Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := jwtauth.TokenFromHeader(r)
+		if tokenString == "" {
+			tokenString = jwtauth.TokenFromCookie(r)
+		}
+
+		if tokenString == "" {
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), nil, jwtauth.ErrNoTokenFound)))
+			return
+		}
+
+		token, err := m.Verify(tokenString)
+		next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+	})
+}
+
+// Revoke rejects the token until it expires
+func (m *SessionManager) Revoke(token jwt.Token) error {
+	if token.JwtID() == "" {
+		return ErrInvalidToken
+	}
+
+	if err := m.readRevokedIfChanged(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneRevoked()
+	m.revoked[token.JwtID()] = token.Expiration()
+
+	return m.saveRevoked()
+}
+
+// RevokeUser rejects every session of the user issued until now
+func (m *SessionManager) RevokeUser(username string) error {
+	if err := m.readRevokedIfChanged(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneRevoked()
+	m.revokedUsers[username] = time.Now()
+
+	return m.saveRevoked()
+}
+
+func (m *SessionManager) IsRevoked(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, revoked := m.revoked[id]
+
+	return revoked
+}
+
+// isUserRevoked reports whether the sessions of the user were revoked after the session was issued.
+// Issue times are whole seconds, so a login in the second of the revocation is rejected too.
+func (m *SessionManager) isUserRevoked(username string, issued time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notBefore, found := m.revokedUsers[username]
+
+	return found && !issued.After(notBefore.Truncate(time.Second))
+}
+
+// Rotate adds a new signing key. Previous keys are kept for one TTL after their successor was created,
+// unless revokePrevious drops them right away, ending all existing sessions.
+func (m *SessionManager) Rotate(revokePrevious bool) (SessionKey, error) {
+	secret, err1 := randomBytes(sessionKeySize)
+	id, err2 := randomBytes(8)
+	if err := errors.Join(err1, err2); err != nil {
+		return SessionKey{}, err
+	}
+
+	key := SessionKey{
+		ID:      hex.EncodeToString(id),
+		Secret:  base64.StdEncoding.EncodeToString(secret),
+		Created: time.Now(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := []SessionKey{key}
+	if !revokePrevious {
+		successor := key.Created
+		for _, previous := range m.keys {
+			if time.Since(successor) > m.TTL {
+				break
+			}
+
+			keys = append(keys, previous)
+			successor = previous.Created
+		}
+	}
+
+	if err := m.setKeys(keys); err != nil {
+		return SessionKey{}, err
+	}
+
+	if err := m.saveKeys(); err != nil {
+		return SessionKey{}, err
+	}
+
+	return key, nil
+}
+
+// Keys returns the signing keys, newest first
+func (m *SessionManager) Keys() []SessionKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]SessionKey(nil), m.keys...)
+}
+
+func (m *SessionManager) issue(user *User, authTime time.Time) (string, error) {
+	if err := m.readKeysIfChanged(); err != nil {
+		log.Errorf("Could not reload session keys: %s", err)
+	}
+
+	id, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.New()
+	for name, value := range sessionClaims(user) {
+		if err := token.Set(name, value); err != nil {
+			return "", err
+		}
+	}
+
+	if err := errors.Join(
+		token.Set(jwt.JwtIDKey, hex.EncodeToString(id)),
+		token.Set(jwt.IssuedAtKey, now),
+		token.Set(jwt.ExpirationKey, now.Add(m.TTL)),
+		token.Set(authTimeClaim, authTime.Unix()),
+	); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	signingKey, _ := m.keySet.Key(0)
+	m.mu.Unlock()
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, signingKey))
+	if err != nil {
+		return "", err
+	}
+
+	return string(signed), nil
+}
+
+// setKeys replaces the keys and the verification key set; callers must hold m.mu
+func (m *SessionManager) setKeys(keys []SessionKey) error {
+	keySet := jwk.NewSet()
+
+	for _, key := range keys {
+		secret, err := base64.StdEncoding.DecodeString(key.Secret)
+		if err != nil || len(secret) < sessionKeySize {
+			return fmt.Errorf("invalid session key %s", key.ID)
+		}
+
+		jwkKey, err := jwk.FromRaw(secret)
+		if err != nil {
+			return err
+		}
+
+		if err := errors.Join(jwkKey.Set(jwk.KeyIDKey, key.ID), jwkKey.Set(jwk.AlgorithmKey, jwa.HS256)); err != nil {
+			return err
+		}
+
+		if err := keySet.AddKey(jwkKey); err != nil {
+			return err
+		}
+	}
+
+	m.keys = keys
+	m.keySet = keySet
+
+	return nil
+}
+
+func (m *SessionManager) readKeys() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var file sessionKeysFile
+	if err := readYAMLFile(m.KeysPath, &file); err != nil {
+		return err
+	}
+
+	m.keysRead = time.Now()
+
+	return m.setKeys(file.Keys)
+}
+
+// readKeysIfChanged picks up keys rotated by another process, e.g. the rotate-session-key command
+func (m *SessionManager) readKeysIfChanged() error {
+	if m.KeysPath == "" {
+		return nil
+	}
+
+	info, err := os.Stat(m.KeysPath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	changed := info.ModTime().After(m.keysRead)
+	m.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	log.Debugf("Found changes to %s. Updating session keys...", m.KeysPath)
+
+	return m.readKeys()
+}
+
+// saveKeys writes the keys to their file; callers must hold m.mu
+func (m *SessionManager) saveKeys() error {
+	if err := writeYAMLFile(m.KeysPath, sessionKeysFile{Keys: m.keys}); err != nil {
+		return err
+	}
+
+	m.keysRead = time.Now()
+
+	return nil
+}
+
+func (m *SessionManager) readRevoked() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var file revokedSessionsFile
+	if err := readYAMLFile(m.RevokedPath, &file); err != nil {
+		return err
+	}
+
+	m.revoked = file.Sessions
+	m.revokedUsers = file.Users
+	if m.revoked == nil {
+		m.revoked = map[string]time.Time{}
+	}
+	if m.revokedUsers == nil {
+		m.revokedUsers = map[string]time.Time{}
+	}
+	m.revokedRead = time.Now()
+
+	return nil
+}
+
+// readRevokedIfChanged picks up revocations of another process, e.g. the delete-user command
+func (m *SessionManager) readRevokedIfChanged() error {
+	m.mu.Lock()
+	loaded := m.revoked != nil
+	m.mu.Unlock()
+
+	if !loaded {
+		return m.readRevoked()
+	}
+
+	if m.RevokedPath == "" {
+		return nil
+	}
+
+	info, err := os.Stat(m.RevokedPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	changed := info.ModTime().After(m.revokedRead)
+	m.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	log.Debugf("Found changes to %s. Updating revoked sessions...", m.RevokedPath)
+
+	return m.readRevoked()
+}
+
+// pruneRevoked forgets revocations of sessions that have expired anyway; callers must hold m.mu
+func (m *SessionManager) pruneRevoked() {
+	now := time.Now()
+	for id, expires := range m.revoked {
+		if now.After(expires) {
+			delete(m.revoked, id)
+		}
+	}
+
+	ttl := m.TTL
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+
+	for username, notBefore := range m.revokedUsers {
+		if now.Sub(notBefore) > ttl {
+			delete(m.revokedUsers, username)
+		}
+	}
+}
+
+// saveRevoked writes the revocation list to its file; callers must hold m.mu
+func (m *SessionManager) saveRevoked() error {
+	if err := writeYAMLFile(m.RevokedPath, revokedSessionsFile{Sessions: m.revoked, Users: m.revokedUsers}); err != nil {
+		return err
+	}
+
+	m.revokedRead = time.Now()
+
+	return nil
+}
+
+func readYAMLFile(path string, data interface{}) error {
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := yaml.NewDecoder(file).Decode(data); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+func writeYAMLFile(path string, data interface{}) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
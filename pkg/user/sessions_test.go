@@ -0,0 +1,206 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessions(t *testing.T) *SessionManager {
+	dir := t.TempDir()
+
+	sessions, err := NewSessionManager(filepath.Join(dir, "session_keys.yml"), filepath.Join(dir, "revoked_sessions.yml"), time.Hour, 2*time.Hour)
+	require.NoError(t, err, "expected no error creating sessions")
+
+	return sessions
+}
+
+func Test_SessionManager_Issue_happy(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	tokenString, err := sessions.Issue(&User{Username: "test_user", Roles: []Role{RoleOperator}})
+	require.NoError(t, err)
+
+	token, err := sessions.Verify(tokenString)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token.JwtID())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiration(), time.Minute)
+	assert.Equal(t, "test_user", token.PrivateClaims()["username"])
+
+	info, err := os.Stat(sessions.KeysPath)
+	require.NoError(t, err, "expected key to be saved")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reloaded, err := NewSessionManager(sessions.KeysPath, sessions.RevokedPath, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	_, err = reloaded.Verify(tokenString)
+	assert.NoError(t, err, "expected key to survive a restart")
+}
+
+func Test_SessionManager_Verify_error(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	_, err := sessions.Verify("not-a-token")
+	assert.Error(t, err)
+
+	expired, err := NewSessionManager(sessions.KeysPath, "", -time.Hour, 0)
+	require.NoError(t, err)
+	expired.TTL = -time.Minute
+
+	tokenString, err := expired.Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+	_, err = sessions.Verify(tokenString)
+	assert.Error(t, err, "expected expired token to be rejected")
+
+	other, err := newTestSessions(t).Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+	_, err = sessions.Verify(other)
+	assert.Error(t, err, "expected token signed with another key to be rejected")
+}
+
+func Test_SessionManager_Revoke(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	tokenString, err := sessions.Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+
+	token, err := sessions.Verify(tokenString)
+	require.NoError(t, err)
+	require.NoError(t, sessions.Revoke(token))
+
+	_, err = sessions.Verify(tokenString)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+
+	reloaded, err := NewSessionManager(sessions.KeysPath, sessions.RevokedPath, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	_, err = reloaded.Verify(tokenString)
+	assert.ErrorIs(t, err, ErrSessionRevoked, "expected revocation to survive a restart")
+}
+
+func Test_SessionManager_Revoke_other_process(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	tokenString, err := sessions.Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+
+	// Another process, e.g. a second replica, revokes the session in the same file
+	other, err := NewSessionManager(sessions.KeysPath, sessions.RevokedPath, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	token, err := other.Verify(tokenString)
+	require.NoError(t, err)
+	require.NoError(t, other.Revoke(token))
+
+	sessions.revokedRead = time.Time{}
+	_, err = sessions.Verify(tokenString)
+	assert.ErrorIs(t, err, ErrSessionRevoked, "expected revocations of other processes to be picked up")
+}
+
+func Test_SessionManager_RevokeUser(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	revoked, err := sessions.Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+	kept, err := sessions.Issue(&User{Username: "other_user"})
+	require.NoError(t, err)
+
+	require.NoError(t, sessions.RevokeUser("test_user"))
+
+	_, err = sessions.Verify(revoked)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	_, err = sessions.Verify(kept)
+	assert.NoError(t, err, "expected sessions of other users to stay valid")
+
+	// The delete-user command only knows the path of the revocation list
+	command := &SessionManager{RevokedPath: sessions.RevokedPath, TTL: time.Hour}
+	require.NoError(t, command.RevokeUser("other_user"))
+
+	sessions.revokedRead = time.Time{}
+	_, err = sessions.Verify(kept)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	_, err = sessions.Verify(revoked)
+	assert.ErrorIs(t, err, ErrSessionRevoked, "expected earlier revocations to be kept")
+}
+
+func Test_SessionManager_Refresh(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	tokenString, err := sessions.Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+	token, err := sessions.Verify(tokenString)
+	require.NoError(t, err)
+
+	refreshedString, err := sessions.Refresh(token, &User{Username: "test_user", Roles: []Role{RoleReadOnly}})
+	require.NoError(t, err)
+
+	refreshed, err := sessions.Verify(refreshedString)
+	require.NoError(t, err)
+	assert.NotEqual(t, token.JwtID(), refreshed.JwtID())
+	assert.Equal(t, []interface{}{"read-only"}, refreshed.PrivateClaims()["roles"])
+
+	_, err = sessions.Verify(tokenString)
+	assert.ErrorIs(t, err, ErrSessionRevoked, "expected refreshed token to be revoked")
+
+	sessions.MaxAge = 0
+	_, err = sessions.Refresh(refreshed, &User{Username: "test_user"})
+	assert.ErrorIs(t, err, ErrSessionTooOld)
+}
+
+func Test_SessionManager_Rotate(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	tokenString, err := sessions.Issue(&User{Username: "test_user"})
+	require.NoError(t, err)
+
+	_, err = sessions.Rotate(false)
+	require.NoError(t, err)
+	assert.Len(t, sessions.Keys(), 2)
+
+	_, err = sessions.Verify(tokenString)
+	assert.NoError(t, err, "expected previous key to keep verifying")
+
+	// Another process, e.g. the rotate-session-key command, drops all previous keys
+	rotator, err := NewSessionManager(sessions.KeysPath, sessions.RevokedPath, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	_, err = rotator.Rotate(true)
+	require.NoError(t, err)
+	assert.Len(t, rotator.Keys(), 1)
+
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(sessions.KeysPath, future, future))
+
+	_, err = sessions.Verify(tokenString)
+	assert.Error(t, err, "expected sessions to end with the previous keys")
+}
+
+func Test_SessionManager_Verifier(t *testing.T) {
+	sessions := newTestSessions(t)
+
+	tokenString, err := sessions.Issue(&User{Username: "test_user", Webhooks: []string{"c3413cb2-c1d2-7e8b-a329-8dff7bcfac86"}})
+	require.NoError(t, err)
+
+	var current *User
+	handler := sessions.Verifier(RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = UserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: tokenString})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, current)
+	assert.Equal(t, "test_user", current.Username)
+	assert.Equal(t, []string{"c3413cb2-c1d2-7e8b-a329-8dff7bcfac86"}, current.Webhooks)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
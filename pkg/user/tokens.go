@@ -0,0 +1,481 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kekaadrenalin/dockhook/pkg/metrics"
+	"github.com/kekaadrenalin/dockhook/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	tokenPrefix = "dh_"
+
+	// tokenLastUsedSaveInterval limits how often last-used timestamps are written to disk
+	tokenLastUsedSaveInterval = time.Minute
+)
+
+const apiToken contextKey = "apiToken"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+type TokenScope struct {
+	Webhooks []string                `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	Hosts    []string                `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Actions  []types.ContainerAction `json:"actions,omitempty" yaml:"actions,omitempty"`
+}
+
+type Token struct {
+	ID       string     `json:"id" yaml:"-"`
+	Name     string     `json:"name" yaml:"name"`
+	Username string     `json:"username" yaml:"username"`
+	Hash     string     `json:"-" yaml:"hash"`
+	Scope    TokenScope `json:"scope" yaml:"scope"`
+	Created  time.Time  `json:"created" yaml:"created"`
+	Expires  time.Time  `json:"expires" yaml:"expires"`
+	LastUsed *time.Time `json:"lastUsed,omitempty" yaml:"lastUsed,omitempty"`
+}
+
+type TokensDatabase struct {
+	Tokens   map[string]*Token `yaml:"tokens"`
+	LastRead time.Time         `yaml:"-"`
+	LastSave time.Time         `yaml:"-"`
+	Path     string            `yaml:"-"`
+
+	// mu guards Tokens against concurrent reloads and changes, which replace the map instead of changing it
+	mu sync.RWMutex
+}
+
+type tokenAuthContext struct {
+	TokensDatabase *TokensDatabase
+	UsersDatabase  *UsersDatabase
+}
+
+// NewTokenAuth authenticates API tokens sent as "Authorization: Bearer dh_...".
+// The users database is optional and is used to resolve the owner of the token.
+func NewTokenAuth(tokensDatabase *TokensDatabase, usersDatabase *UsersDatabase) *tokenAuthContext {
+	return &tokenAuthContext{
+		TokensDatabase: tokensDatabase,
+		UsersDatabase:  usersDatabase,
+	}
+}
+
+func (a *tokenAuthContext) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := a.TokensDatabase.Authenticate(bearerToken(r))
+		if err != nil {
+			log.Debugf("API token rejected: %s", err)
+			metrics.AuthFailures.WithLabelValues("api_token").Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		owner := newUser(token.Username, "", token.Username)
+		if a.UsersDatabase != nil {
+			found := a.UsersDatabase.Find(token.Username)
+			if found == nil {
+				log.Warnf("API token %s belongs to unknown user %s", token.ID, token.Username)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			owner = *found
+			owner.Password = ""
+		}
+
+		ctx := context.WithValue(r.Context(), remoteUser, owner)
+		ctx = context.WithValue(ctx, apiToken, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// HasAPIToken reports whether the request carries an API token instead of provider credentials
+func HasAPIToken(r *http.Request) bool {
+	return strings.HasPrefix(bearerToken(r), tokenPrefix)
+}
+
+// TokenFromContext returns the API token used to authenticate the request, if any
+func TokenFromContext(ctx context.Context) *Token {
+	if token, ok := ctx.Value(apiToken).(*Token); ok {
+		return token
+	}
+
+	return nil
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+// Allows reports whether the scope permits triggering the webhook; empty lists allow everything
+func (s TokenScope) Allows(webhook *types.Webhook) bool {
+	if len(s.Webhooks) > 0 && !slices.Contains(s.Webhooks, webhook.UUID) {
+		return false
+	}
+
+	if len(s.Hosts) > 0 && !slices.Contains(s.Hosts, webhook.Host) {
+		return false
+	}
+
+	if len(s.Actions) > 0 && !slices.Contains(s.Actions, webhook.Action) {
+		return false
+	}
+
+	return true
+}
+
+func (s TokenScope) String() string {
+	parts := make([]string, 0, 3)
+
+	if len(s.Webhooks) > 0 {
+		parts = append(parts, "webhooks="+strings.Join(s.Webhooks, ","))
+	}
+	if len(s.Hosts) > 0 {
+		parts = append(parts, "hosts="+strings.Join(s.Hosts, ","))
+	}
+	if len(s.Actions) > 0 {
+		actions := make([]string, 0, len(s.Actions))
+		for _, action := range s.Actions {
+			actions = append(actions, string(action))
+		}
+		parts = append(parts, "actions="+strings.Join(actions, ","))
+	}
+
+	if len(parts) == 0 {
+		return "unrestricted"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Validate checks that every action in the scope is a known container action
+func (s TokenScope) Validate() error {
+	for _, action := range s.Actions {
+		if !slices.Contains(types.ContainerActions, action) {
+			return fmt.Errorf("unknown action: %s", action)
+		}
+	}
+
+	return nil
+}
+
+func (t *Token) IsExpired() bool {
+	return !t.Expires.IsZero() && time.Now().After(t.Expires)
+}
+
+func ReadTokensFromFile(path string) (*TokensDatabase, error) {
+	tokens, err := decodeTokensFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokensDatabase{Tokens: tokens, LastRead: time.Now(), Path: path}, nil
+}
+
+// Issue stores a new token and returns it together with its plaintext secret, which is never saved
+func (d *TokensDatabase) Issue(token Token) (Token, string, error) {
+	if token.Username == "" {
+		return token, "", errors.New("token owner is required")
+	}
+
+	if err := token.Scope.Validate(); err != nil {
+		return token, "", err
+	}
+
+	id, err := randomBytes(8)
+	if err != nil {
+		return token, "", err
+	}
+
+	secret, err := randomBytes(32)
+	if err != nil {
+		return token, "", err
+	}
+
+	token.ID = hex.EncodeToString(id)
+	plaintext := tokenPrefix + token.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	token.Hash = hashToken(plaintext)
+	token.Created = time.Now()
+	token.LastUsed = nil
+
+	if err := d.readFileIfChanged(); err != nil {
+		return token, "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tokens := d.copyTokens()
+	tokens[token.ID] = &token
+
+	if err := d.save(tokens); err != nil {
+		return token, "", err
+	}
+
+	return token, plaintext, nil
+}
+
+// Revoke deletes the token with the given ID
+func (d *TokensDatabase) Revoke(id string) error {
+	if err := d.readFileIfChanged(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.Tokens[id]; !exists {
+		return fmt.Errorf("token %s does not exist", id)
+	}
+
+	tokens := d.copyTokens()
+	delete(tokens, id)
+
+	return d.save(tokens)
+}
+
+func (d *TokensDatabase) Find(id string) *Token {
+	if err := d.readFileIfChanged(); err != nil {
+		log.Errorf("Error reading tokens file: %s", err)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	token, ok := d.Tokens[id]
+	if !ok {
+		return nil
+	}
+
+	return token
+}
+
+// List returns the tokens of a user, or every token when username is empty
+func (d *TokensDatabase) List(username string) []Token {
+	if err := d.readFileIfChanged(); err != nil {
+		log.Errorf("Error reading tokens file: %s", err)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	tokens := make([]Token, 0, len(d.Tokens))
+	for _, token := range d.Tokens {
+		if username == "" || token.Username == username {
+			tokens = append(tokens, *token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+
+	return tokens
+}
+
+// Authenticate resolves a plaintext token and records when it was last used
+func (d *TokensDatabase) Authenticate(plaintext string) (*Token, error) {
+	id, _, found := strings.Cut(strings.TrimPrefix(plaintext, tokenPrefix), "_")
+	if !strings.HasPrefix(plaintext, tokenPrefix) || !found {
+		return nil, ErrInvalidToken
+	}
+
+	token := d.Find(id)
+	if token == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashToken(plaintext))) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	if token.IsExpired() {
+		return nil, ErrTokenExpired
+	}
+
+	d.touchLastUsed(token)
+
+	return token, nil
+}
+
+func (d *TokensDatabase) touchLastUsed(token *Token) {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.Tokens[token.ID]; !exists {
+		return
+	}
+
+	lastUsed := token.LastUsed
+	used := *token
+	used.LastUsed = &now
+
+	tokens := d.copyTokens()
+	tokens[token.ID] = &used
+
+	// Usage is kept in memory between saves and when saving fails
+	if lastUsed != nil && now.Sub(*lastUsed) < tokenLastUsedSaveInterval {
+		d.Tokens = tokens
+		return
+	}
+
+	if err := d.save(tokens); err != nil {
+		d.Tokens = tokens
+		log.Errorf("Could not save last usage of token %s: %s", token.ID, err)
+	}
+}
+
+// copyTokens copies the map so that readers holding a previous map are not affected; callers must hold d.mu
+func (d *TokensDatabase) copyTokens() map[string]*Token {
+	tokens := make(map[string]*Token, len(d.Tokens)+1)
+	for id, token := range d.Tokens {
+		tokens[id] = token
+	}
+
+	return tokens
+}
+
+// save replaces the tokens and writes them to the file if the database is file-backed; callers must hold d.mu
+func (d *TokensDatabase) save(tokens map[string]*Token) error {
+	if d.Path != "" {
+		if err := saveTokensToFile(tokens, d.Path); err != nil {
+			return err
+		}
+
+		d.LastRead = time.Now()
+		d.LastSave = d.LastRead
+	}
+
+	d.Tokens = tokens
+
+	return nil
+}
+
+func saveTokensToFile(tokens map[string]*Token, path string) error {
+	// helper.CreateDir would create the file world-readable
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := yaml.Marshal(&TokensDatabase{Tokens: tokens})
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+
+	return err
+}
+
+func decodeTokensFromFile(path string) (map[string]*Token, error) {
+	var tokens struct {
+		Tokens map[string]*Token `yaml:"tokens"`
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return map[string]*Token{}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := yaml.NewDecoder(file).Decode(&tokens); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if tokens.Tokens == nil {
+		tokens.Tokens = map[string]*Token{}
+	}
+
+	for id, token := range tokens.Tokens {
+		token.ID = id
+	}
+
+	return tokens.Tokens, nil
+}
+
+func (d *TokensDatabase) readFileIfChanged() error {
+	if d.Path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(d.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !info.ModTime().After(d.LastRead) {
+		return nil
+	}
+
+	log.Debugf("Found changes to %s. Updating tokens...", d.Path)
+	tokens, err := decodeTokensFromFile(d.Path)
+	if err != nil {
+		return err
+	}
+
+	d.Tokens = tokens
+	d.LastRead = time.Now()
+
+	return nil
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,209 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // RFC 6238 and authenticator apps use HMAC-SHA1
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSecretSize = 20
+	// totpSkew accepts codes of the previous and next period to tolerate clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 10
+)
+
+var ErrSecondFactorRequired = errors.New("second factor required")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpUsed remembers the last accepted period per user so that a code cannot be replayed
+var (
+	totpUsed   = map[string]uint64{}
+	totpUsedMu sync.Mutex
+)
+
+// TOTP is an RFC 6238 second factor. Recovery codes are stored as SHA-256 hashes and can be used once.
+type TOTP struct {
+	Secret        string   `yaml:"secret"`
+	RecoveryCodes []string `yaml:"recoveryCodes,omitempty"`
+}
+
+// GenerateTOTP creates a new secret and returns it together with the plaintext recovery codes
+func GenerateTOTP() (TOTP, []string, error) {
+	secret, err := randomBytes(totpSecretSize)
+	if err != nil {
+		return TOTP{}, nil, err
+	}
+
+	totp := TOTP{Secret: totpEncoding.EncodeToString(secret)}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw, err := randomBytes(recoveryCodeSize)
+		if err != nil {
+			return TOTP{}, nil, err
+		}
+
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))[:recoveryCodeSize]
+		code = code[:recoveryCodeSize/2] + "-" + code[recoveryCodeSize/2:]
+
+		codes = append(codes, code)
+		totp.RecoveryCodes = append(totp.RecoveryCodes, hashRecoveryCode(code))
+	}
+
+	return totp, codes, nil
+}
+
+// URI returns the otpauth:// URI understood by authenticator apps
+func (t *TOTP) URI(issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", t.Secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	uri := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + account, RawQuery: query.Encode()}
+
+	return uri.String()
+}
+
+// Validate checks that the secret can be decoded
+func (t *TOTP) Validate() error {
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(t.Secret))
+	if err != nil {
+		return fmt.Errorf("invalid totp secret: %w", err)
+	}
+
+	if len(secret) < 10 {
+		return errors.New("totp secret is too short")
+	}
+
+	return nil
+}
+
+// verify returns the period of a valid code
+func (t *TOTP) verify(code string, now time.Time) (uint64, bool) {
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(t.Secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := uint64(now.Unix()) / uint64(totpPeriod.Seconds())
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		counter := current + uint64(offset)
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// recoveryCodeIndex returns the position of a matching recovery code or -1
+func (t *TOTP) recoveryCodeIndex(code string) int {
+	hash := hashRecoveryCode(code)
+	for i, stored := range t.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// VerifySecondFactor accepts a current TOTP code or an unused recovery code of the user.
+// Users without TOTP need no second factor.
+func (u *UsersDatabase) VerifySecondFactor(username, code string) error {
+	user := u.Find(username)
+	if user == nil {
+		return ErrInvalidCredentials
+	}
+
+	if user.TOTP == nil {
+		return nil
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if code == "" {
+		return ErrSecondFactorRequired
+	}
+
+	if counter, ok := user.TOTP.verify(code, time.Now()); ok {
+		totpUsedMu.Lock()
+		defer totpUsedMu.Unlock()
+
+		if last, found := totpUsed[username]; found && counter <= last {
+			log.Warnf("Rejected reused one-time code of user %s", username)
+			return ErrInvalidCredentials
+		}
+
+		totpUsed[username] = counter
+
+		return nil
+	}
+
+	if user.TOTP.recoveryCodeIndex(code) < 0 {
+		return ErrInvalidCredentials
+	}
+
+	// Recovery codes are consumed, the update fails if the code was used concurrently
+	_, err := u.Update(username, func(user *User) error {
+		if user.TOTP == nil {
+			return ErrInvalidCredentials
+		}
+
+		index := user.TOTP.recoveryCodeIndex(code)
+		if index < 0 {
+			return ErrInvalidCredentials
+		}
+
+		totp := *user.TOTP
+		totp.RecoveryCodes = append(append([]string{}, totp.RecoveryCodes[:index]...), totp.RecoveryCodes[index+1:]...)
+		user.TOTP = &totp
+
+		log.Warnf("User %s used a recovery code, %d left", username, len(totp.RecoveryCodes))
+
+		return nil
+	})
+
+	return err
+}
+
+func totpCode(secret []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,94 @@
+package user
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kekaadrenalin/dockhook/pkg/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_totpCode_rfc6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	// Last six digits of the SHA-1 test vectors of RFC 6238
+	assert.Equal(t, "287082", totpCode(secret, 59/30))
+	assert.Equal(t, "081804", totpCode(secret, 1111111109/30))
+	assert.Equal(t, "005924", totpCode(secret, 1234567890/30))
+}
+
+func Test_TOTP_verify(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	totp := TOTP{Secret: totpEncoding.EncodeToString(secret)}
+	now := time.Unix(1111111109, 0)
+
+	_, ok := totp.verify("081804", now)
+	assert.True(t, ok, "expected current code to be accepted")
+
+	_, ok = totp.verify("081804", now.Add(totpPeriod))
+	assert.True(t, ok, "expected code of the previous period to be accepted")
+
+	_, ok = totp.verify("081804", now.Add(3*totpPeriod))
+	assert.False(t, ok, "expected old code to be rejected")
+
+	_, ok = totp.verify("000000", now)
+	assert.False(t, ok, "expected wrong code to be rejected")
+}
+
+func Test_TOTP_URI(t *testing.T) {
+	totp, codes, err := GenerateTOTP()
+	require.NoError(t, err)
+	assert.NoError(t, totp.Validate())
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Len(t, totp.RecoveryCodes, recoveryCodeCount)
+	assert.NotContains(t, totp.RecoveryCodes, codes[0], "expected recovery codes to be hashed")
+
+	uri, err := url.Parse(totp.URI("DockHook", "admin"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/DockHook:admin", uri.Path)
+	assert.Equal(t, totp.Secret, uri.Query().Get("secret"))
+}
+
+func Test_AuthSimple_CreateTokenWithCode(t *testing.T) {
+	totp, codes, err := GenerateTOTP()
+	require.NoError(t, err)
+
+	usersDB := &UsersDatabase{
+		Users: map[string]*User{
+			"test_user": {Username: "test_user", Password: helper.Sha512sum("test_pass"), Roles: []Role{RoleAdmin}, TOTP: &totp},
+		},
+	}
+	authContext := NewSimpleAuth(usersDB, newTestSessions(t))
+
+	_, err = authContext.CreateToken("test_user", "test_pass")
+	assert.ErrorIs(t, err, ErrSecondFactorRequired)
+
+	_, err = authContext.CreateTokenWithCode("test_user", "wrong_pass", codes[0])
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "expected the password to be checked first")
+
+	_, err = authContext.CreateTokenWithCode("test_user", "test_pass", "123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	secret, err := totpEncoding.DecodeString(totp.Secret)
+	require.NoError(t, err)
+	code := totpCode(secret, uint64(time.Now().Unix())/uint64(totpPeriod.Seconds()))
+
+	token, err := authContext.CreateTokenWithCode("test_user", "test_pass", code)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	_, err = authContext.CreateTokenWithCode("test_user", "test_pass", code)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "expected a code to be usable once")
+
+	token, err = authContext.CreateTokenWithCode("test_user", "test_pass", codes[1])
+	assert.NoError(t, err, "expected recovery code to be accepted")
+	assert.NotEmpty(t, token)
+	assert.Len(t, authContext.UsersDatabase.Find("test_user").TOTP.RecoveryCodes, recoveryCodeCount-1)
+
+	_, err = authContext.CreateTokenWithCode("test_user", "test_pass", codes[1])
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "expected recovery code to be consumed")
+}
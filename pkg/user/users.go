@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -16,10 +18,14 @@ import (
 )
 
 type User struct {
-	Username string `json:"username" yaml:"-"`
-	Email    string `json:"email" yaml:"email"`
-	Name     string `json:"name" yaml:"name"`
-	Password string `json:"-" yaml:"password"`
+	Username string   `json:"username" yaml:"-"`
+	Email    string   `json:"email" yaml:"email"`
+	Name     string   `json:"name" yaml:"name"`
+	Password string   `json:"-" yaml:"password"`
+	Roles    []Role   `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Webhooks []string `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	Hosts    []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	TOTP     *TOTP    `json:"-" yaml:"totp,omitempty"`
 }
 
 type UsersDatabase struct {
@@ -27,13 +33,23 @@ type UsersDatabase struct {
 	LastRead time.Time        `yaml:"-"`
 	LastSave time.Time        `yaml:"-"`
 	Path     string           `yaml:"-"`
+
+	// mu guards Users against concurrent reloads and changes, which replace the map instead of changing it
+	mu sync.RWMutex
 }
 
 type contextKey string
 
 const remoteUser contextKey = "remoteUser"
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrNotSupported       = errors.New("not supported by this auth provider")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidUser        = errors.New("invalid user")
+	ErrLastAdmin          = errors.New("the last admin cannot be removed or demoted")
+)
 
 func newUser(username, email, name string) User {
 	return User{
@@ -43,21 +59,23 @@ func newUser(username, email, name string) User {
 	}
 }
 
-func ReadUsersFromFile(path string) (UsersDatabase, error) {
+func ReadUsersFromFile(path string) (*UsersDatabase, error) {
 	users, err := decodeUsersFromFile(path)
 	if err != nil {
-		return users, err
+		return nil, err
 	}
 
-	users.LastRead = time.Now()
-	users.Path = path
-
-	return users, nil
+	return &UsersDatabase{Users: users, LastRead: time.Now(), Path: path}, nil
 }
 
 func CreateUser(path string, user User, hashPassword bool) (User, error) {
 	if hashPassword {
-		user.Password = helper.Sha512sum(user.Password)
+		hash, err := helper.HashPassword(user.Password)
+		if err != nil {
+			return user, err
+		}
+
+		user.Password = hash
 	}
 
 	users, err := ReadUsersFromFile(path)
@@ -75,58 +93,55 @@ func CreateUser(path string, user User, hashPassword bool) (User, error) {
 
 	users.Users[user.Username] = &user
 
-	if _, err := saveUsersToFile(users, path); err != nil {
+	if err := saveUsersToFile(users.Users, path); err != nil {
 		return user, err
 	}
 
 	return user, nil
 }
 
-func saveUsersToFile(users UsersDatabase, path string) (UsersDatabase, error) {
+func saveUsersToFile(users map[string]*User, path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if _, err = helper.CreateDir(path); err != nil {
-			return users, err
+			return err
 		}
 	}
 
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	// The file holds password hashes and TOTP secrets
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		return users, err
+		return err
 	}
 	defer file.Close()
 
-	data, err := yaml.Marshal(&users)
+	data, err := yaml.Marshal(&UsersDatabase{Users: users})
 	if err != nil {
-		return users, err
-	}
-
-	if _, err = file.Write(data); err != nil {
-		return users, err
+		return err
 	}
 
-	users.LastSave = time.Now()
+	_, err = file.Write(data)
 
-	return users, nil
+	return err
 }
 
-func decodeUsersFromFile(path string) (UsersDatabase, error) {
-	users := UsersDatabase{}
+func decodeUsersFromFile(path string) (map[string]*User, error) {
+	var users struct {
+		Users map[string]*User `yaml:"users"`
+	}
 
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		users.Users = map[string]*User{}
-
-		return users, nil
+		return map[string]*User{}, nil
 	}
 
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
-		return users, err
+		return nil, err
 	}
 
 	if err := yaml.NewDecoder(file).Decode(&users); err != nil {
 		log.Warningf("wrong file: %s\n", err)
 
-		return users, nil
+		return users.Users, nil
 	}
 	defer file.Close()
 
@@ -136,16 +151,31 @@ func decodeUsersFromFile(path string) (UsersDatabase, error) {
 			log.Fatalf("User %s has no password", username)
 		}
 
-		if len(user.Password) != 128 {
-			log.Fatalf("User %s has an invalid password hash", username)
+		if err := helper.ValidatePasswordHash(user.Password); err != nil {
+			log.Fatalf("User %s has an invalid password hash: %s", username, err)
 		}
 
 		if user.Name == "" {
 			user.Name = username
 		}
+
+		if _, err := ParseRoles(rolesToStrings(user.Roles)); err != nil {
+			log.Fatalf("User %s has an invalid role: %s", username, err)
+		}
+
+		if user.TOTP != nil {
+			if err := user.TOTP.Validate(); err != nil {
+				log.Fatalf("User %s has an invalid second factor: %s", username, err)
+			}
+		}
+
+		// Older versions treated these users as admins, they now get no access until a role is granted
+		if len(user.Roles) == 0 && len(user.Webhooks) == 0 && len(user.Hosts) == 0 {
+			log.Errorf("User %s has no roles or grants and is denied everything, grant a role with: dockhook update-user %s --role admin", username, username)
+		}
 	}
 
-	return users, nil
+	return users.Users, nil
 }
 
 func (u *UsersDatabase) readFileIfChanged() error {
@@ -154,20 +184,29 @@ func (u *UsersDatabase) readFileIfChanged() error {
 	}
 
 	info, err := os.Stat(u.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if info.ModTime().After(u.LastRead) {
-		log.Infof("Found changes to %s. Updating users...", u.Path)
-		users, err := decodeUsersFromFile(u.Path)
-		if err != nil {
-			return err
-		}
-		u.Users = users.Users
-		u.LastRead = time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !info.ModTime().After(u.LastRead) {
+		return nil
+	}
+
+	log.Infof("Found changes to %s. Updating users...", u.Path)
+	users, err := decodeUsersFromFile(u.Path)
+	if err != nil {
+		return err
 	}
 
+	u.Users = users
+	u.LastRead = time.Now()
+
 	return nil
 }
 
@@ -176,6 +215,9 @@ func (u *UsersDatabase) Find(username string) *User {
 		log.Errorf("Error reading users file: %s", err)
 	}
 
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
 	user, ok := u.Users[username]
 	if !ok {
 		return nil
@@ -190,13 +232,55 @@ func (u *UsersDatabase) FindByPassword(username, password string) *User {
 		return nil
 	}
 
-	if user.Password != helper.Sha512sum(password) {
+	valid, needsRehash := helper.VerifyPassword(user.Password, password)
+	if !valid {
 		return nil
 	}
 
+	if needsRehash {
+		upgraded, err := u.rehashPassword(user, password)
+		if err != nil {
+			log.Errorf("Could not upgrade password hash for user %s: %s", username, err)
+
+			return user
+		}
+
+		return upgraded
+	}
+
 	return user
 }
 
+// rehashPassword replaces a legacy password hash with a fresh one and saves it when the database is file-backed
+func (u *UsersDatabase) rehashPassword(user *User, password string) (*User, error) {
+	hash, err := helper.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	// The user may have been changed or removed since the password was checked
+	current, found := u.Users[user.Username]
+	if !found || current.Password != user.Password {
+		return user, nil
+	}
+
+	upgraded := *current
+	upgraded.Password = hash
+
+	users := u.copyUsers()
+	users[upgraded.Username] = &upgraded
+	if err := u.save(users); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Password hash for user %s upgraded", upgraded.Username)
+
+	return &upgraded, nil
+}
+
 //goland:noinspection GoNameStartsWithPackageName
 func UserFromContext(ctx context.Context) *User {
 	if user, ok := ctx.Value(remoteUser).(User); ok {
@@ -209,16 +293,47 @@ func UserFromContext(ctx context.Context) *User {
 			return nil
 		}
 
-		email := claims["email"].(string)
-		name := claims["name"].(string)
+		email, _ := claims["email"].(string)
+		name, _ := claims["name"].(string)
 		user := newUser(username, email, name)
 
+		for _, role := range claimStrings(claims, "roles") {
+			user.Roles = append(user.Roles, Role(role))
+		}
+		user.Webhooks = claimStrings(claims, "webhooks")
+		user.Hosts = claimStrings(claims, "hosts")
+
 		return &user
 	}
 
 	return nil
 }
 
+func claimStrings(claims map[string]interface{}, key string) []string {
+	values, ok := claims[key].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			result = append(result, str)
+		}
+	}
+
+	return result
+}
+
+func rolesToStrings(roles []Role) []string {
+	result := make([]string, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, string(role))
+	}
+
+	return result
+}
+
 func RequireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := UserFromContext(r.Context())
@@ -229,3 +344,192 @@ func RequireAuthentication(next http.Handler) http.Handler {
 		}
 	})
 }
+
+// List returns the users sorted by username, without their password hashes and TOTP secrets
+func (u *UsersDatabase) List() []User {
+	if err := u.readFileIfChanged(); err != nil {
+		log.Errorf("Error reading users file: %s", err)
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	users := make([]User, 0, len(u.Users))
+	for _, user := range u.Users {
+		listed := *user
+		listed.Password = ""
+		if listed.TOTP != nil {
+			// An empty TOTP still tells that the user has a second factor
+			listed.TOTP = &TOTP{}
+		}
+		users = append(users, listed)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users
+}
+
+// Add saves a new user whose password is already hashed
+func (u *UsersDatabase) Add(user User) (User, error) {
+	if err := validateUser(user); err != nil {
+		return user, err
+	}
+
+	if err := u.readFileIfChanged(); err != nil {
+		return user, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, exists := u.Users[user.Username]; exists {
+		return user, ErrUserExists
+	}
+
+	if user.Name == "" {
+		user.Name = user.Username
+	}
+
+	users := u.copyUsers()
+	users[user.Username] = &user
+
+	return user, u.save(users)
+}
+
+// Update applies the changes made by update to a copy of the user and saves it
+func (u *UsersDatabase) Update(username string, update func(*User) error) (User, error) {
+	if err := u.readFileIfChanged(); err != nil {
+		return User{}, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	existing, found := u.Users[username]
+	if !found {
+		return User{}, ErrUserNotFound
+	}
+
+	updated := *existing
+	if err := update(&updated); err != nil {
+		return User{}, err
+	}
+
+	updated.Username = username
+	if err := validateUser(updated); err != nil {
+		return User{}, err
+	}
+
+	if existing.HasRole(RoleAdmin) && !updated.HasRole(RoleAdmin) && !u.hasOtherAdmin(username) {
+		return User{}, ErrLastAdmin
+	}
+
+	users := u.copyUsers()
+	users[username] = &updated
+
+	return updated, u.save(users)
+}
+
+// SetPassword hashes and saves a new password for the user
+func (u *UsersDatabase) SetPassword(username, password string) error {
+	if password == "" {
+		return fmt.Errorf("%w: password is required", ErrInvalidUser)
+	}
+
+	hash, err := helper.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.Update(username, func(user *User) error {
+		user.Password = hash
+		return nil
+	})
+
+	return err
+}
+
+// Delete removes a user, but never the last admin
+func (u *UsersDatabase) Delete(username string) error {
+	if err := u.readFileIfChanged(); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	existing, found := u.Users[username]
+	if !found {
+		return ErrUserNotFound
+	}
+
+	if existing.HasRole(RoleAdmin) && !u.hasOtherAdmin(username) {
+		return ErrLastAdmin
+	}
+
+	users := u.copyUsers()
+	delete(users, username)
+
+	return u.save(users)
+}
+
+// copyUsers copies the map so that readers holding a previous map are not affected; callers must hold u.mu
+func (u *UsersDatabase) copyUsers() map[string]*User {
+	users := make(map[string]*User, len(u.Users)+1)
+	for username, user := range u.Users {
+		users[username] = user
+	}
+
+	return users
+}
+
+// save replaces the users and writes them to the file if the database is file-backed; callers must hold u.mu
+func (u *UsersDatabase) save(users map[string]*User) error {
+	if u.Path != "" {
+		if err := saveUsersToFile(users, u.Path); err != nil {
+			return err
+		}
+
+		u.LastRead = time.Now()
+		u.LastSave = u.LastRead
+	}
+
+	u.Users = users
+
+	return nil
+}
+
+// hasOtherAdmin reports whether a user other than username is an admin; callers must hold u.mu
+func (u *UsersDatabase) hasOtherAdmin(username string) bool {
+	for name, user := range u.Users {
+		if name != username && user.HasRole(RoleAdmin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateUser(user User) error {
+	if user.Username == "" {
+		return fmt.Errorf("%w: username is required", ErrInvalidUser)
+	}
+
+	if err := helper.ValidatePasswordHash(user.Password); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidUser, err)
+	}
+
+	if _, err := ParseRoles(rolesToStrings(user.Roles)); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidUser, err)
+	}
+
+	// Users without grants could not do anything
+	if len(user.Roles) == 0 && len(user.Webhooks) == 0 && len(user.Hosts) == 0 {
+		return fmt.Errorf("%w: at least one role, webhook or host is required", ErrInvalidUser)
+	}
+
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kekaadrenalin/dockhook/pkg/helper"
 	"github.com/stretchr/testify/assert"
@@ -119,6 +121,154 @@ func Test_FindByPassword_wrong_password(t *testing.T) {
 	assert.Nil(t, notFoundUser, "expected no user to be found with incorrect password")
 }
 
+func Test_FindByPassword_upgrade_legacy_hash(t *testing.T) {
+	testUser := User{
+		Username: "test_user",
+		Email:    "test@example.com",
+		Name:     "Test User",
+		Password: helper.Sha512sum("test_password"),
+	}
+	body := generateYml(t, testUser)
+
+	tmpFile, err := createTempFile(t, body)
+	if err != nil {
+		panic(any(err))
+	}
+	defer os.Remove(tmpFile.Name())
+
+	usersDB, err := ReadUsersFromFile(tmpFile.Name())
+	assert.NoError(t, err, "expected no error reading users")
+
+	assert.Nil(t, usersDB.FindByPassword(testUser.Username, "wrong_password"), "expected no user with incorrect password")
+	assert.True(t, helper.IsLegacyPasswordHash(usersDB.Find(testUser.Username).Password), "expected hash to stay on failure")
+
+	foundUser := usersDB.FindByPassword(testUser.Username, "test_password")
+	assert.NotNil(t, foundUser, "expected user to be found with correct password")
+	assert.False(t, helper.IsLegacyPasswordHash(foundUser.Password), "expected hash to be upgraded")
+
+	reloaded, err := ReadUsersFromFile(tmpFile.Name())
+	assert.NoError(t, err, "expected no error reading users")
+	assert.Equal(t, foundUser.Password, reloaded.Users[testUser.Username].Password, "expected upgraded hash to be saved")
+	assert.NotNil(t, reloaded.FindByPassword(testUser.Username, "test_password"), "expected upgraded hash to verify")
+}
+
+func Test_FindByPassword_upgrade_copy_on_write(t *testing.T) {
+	testUser := User{Username: "test_user", Password: helper.Sha512sum("test_password"), Roles: []Role{RoleReadOnly}}
+	usersDB := UsersDatabase{Users: map[string]*User{testUser.Username: &testUser}}
+	snapshot := usersDB.Users
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NotNil(t, usersDB.FindByPassword(testUser.Username, "test_password"))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Len(t, usersDB.List(), 1)
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, helper.IsLegacyPasswordHash(snapshot[testUser.Username].Password), "expected readers of the previous map to be unaffected")
+	assert.False(t, helper.IsLegacyPasswordHash(usersDB.Find(testUser.Username).Password), "expected hash to be upgraded")
+}
+
+func Test_UsersDatabase_manage_users(t *testing.T) {
+	admin := User{Username: "admin", Password: helper.Sha512sum("admin_pass"), Roles: []Role{RoleAdmin}}
+
+	tmpFile, err := createTempFile(t, generateYml(t, admin))
+	if err != nil {
+		panic(any(err))
+	}
+	defer os.Remove(tmpFile.Name())
+
+	usersDB, err := ReadUsersFromFile(tmpFile.Name())
+	assert.NoError(t, err, "expected no error reading users")
+
+	hash, err := helper.HashPassword("deploy_pass")
+	assert.NoError(t, err)
+
+	created, err := usersDB.Add(User{Username: "deployer", Password: hash, Hosts: []string{"edge-1"}})
+	assert.NoError(t, err, "expected no error adding user")
+	assert.Equal(t, "deployer", created.Name, "expected name to default to username")
+
+	_, err = usersDB.Add(User{Username: "deployer", Password: hash, Hosts: []string{"edge-1"}})
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	_, err = usersDB.Add(User{Username: "nobody", Password: hash})
+	assert.ErrorIs(t, err, ErrInvalidUser, "expected user without grants to be rejected")
+
+	updated, err := usersDB.Update("deployer", func(u *User) error {
+		u.Email = "deployer@example.com"
+		u.Roles = []Role{RoleOperator}
+		return nil
+	})
+	assert.NoError(t, err, "expected no error updating user")
+	assert.Equal(t, "deployer@example.com", updated.Email)
+	assert.Equal(t, []string{"edge-1"}, updated.Hosts, "expected untouched fields to be kept")
+
+	assert.NoError(t, usersDB.SetPassword("deployer", "new_pass"))
+	assert.NotNil(t, usersDB.FindByPassword("deployer", "new_pass"), "expected new password to verify")
+	assert.Nil(t, usersDB.FindByPassword("deployer", "deploy_pass"), "expected old password to be rejected")
+
+	users := usersDB.List()
+	assert.Len(t, users, 2)
+	assert.Equal(t, "admin", users[0].Username, "expected users to be sorted")
+	assert.Empty(t, users[1].Password, "expected password hashes to be hidden")
+
+	reloaded, err := ReadUsersFromFile(tmpFile.Name())
+	assert.NoError(t, err, "expected no error reading users")
+	assert.Equal(t, []Role{RoleOperator}, reloaded.Find("deployer").Roles, "expected changes to be saved")
+
+	assert.NoError(t, usersDB.Delete("deployer"))
+	assert.ErrorIs(t, usersDB.Delete("deployer"), ErrUserNotFound)
+	assert.Nil(t, usersDB.Find("deployer"))
+}
+
+func Test_UsersDatabase_last_admin(t *testing.T) {
+	usersDB := UsersDatabase{
+		Users: map[string]*User{
+			"admin": {Username: "admin", Password: helper.Sha512sum("admin_pass"), Roles: []Role{RoleAdmin}},
+		},
+	}
+
+	assert.ErrorIs(t, usersDB.Delete("admin"), ErrLastAdmin)
+
+	_, err := usersDB.Update("admin", func(u *User) error {
+		u.Roles = []Role{RoleReadOnly}
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrLastAdmin)
+
+	_, err = usersDB.Add(User{Username: "second", Password: helper.Sha512sum("second_pass"), Roles: []Role{RoleAdmin}})
+	assert.NoError(t, err)
+	assert.NoError(t, usersDB.Delete("admin"), "expected admin to be deletable once another admin exists")
+}
+
+func Test_UsersDatabase_hot_reload(t *testing.T) {
+	tmpFile, err := createTempFile(t, "users:")
+	if err != nil {
+		panic(any(err))
+	}
+	defer os.Remove(tmpFile.Name())
+
+	usersDB, err := ReadUsersFromFile(tmpFile.Name())
+	assert.NoError(t, err)
+
+	// Another process, e.g. the create-user command, changes the file
+	other, err := ReadUsersFromFile(tmpFile.Name())
+	assert.NoError(t, err)
+	_, err = other.Add(User{Username: "operator", Password: helper.Sha512sum("operator_pass"), Roles: []Role{RoleOperator}})
+	assert.NoError(t, err)
+
+	future := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(tmpFile.Name(), future, future))
+
+	assert.Len(t, usersDB.List(), 1, "expected changes of another process to be picked up")
+}
+
 func Test_RequireAuthentication_happy(t *testing.T) {
 	srv := httptest.NewServer(RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)